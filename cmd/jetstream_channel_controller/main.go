@@ -41,6 +41,6 @@ func main() {
 	}
 
 	sharedmain.MainWithContext(ctx, component, func(ctx context.Context, watcher configmap.Watcher) *kncontroller.Impl {
-		return jetstream.NewController(ctx)
+		return jetstream.NewController(ctx, watcher)
 	})
 }
@@ -11,16 +11,21 @@ require (
 	github.com/influxdata/tdigest v0.0.1 // indirect
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/nats-io/nats.go v1.11.1-0.20210623165838-4b75fc59ae30
+	github.com/nats-io/nkeys v0.3.0
 	github.com/nats-io/stan.go v0.9.0
 	github.com/pkg/errors v0.9.1
+	go.opencensus.io v0.23.0
 	go.uber.org/zap v1.19.0
+	golang.org/x/time v0.0.0-20210723032227-1f47c861a9ac
 	k8s.io/api v0.21.4
 	k8s.io/apimachinery v0.21.4
 	k8s.io/client-go v0.21.4
+	k8s.io/utils v0.0.0-20201110183641-67b214c5f920
 	knative.dev/eventing v0.25.1-0.20210830155228-9b1f09cb571c
 	knative.dev/hack v0.0.0-20210806075220-815cd312d65c
 	knative.dev/pkg v0.0.0-20210830224055-82f3a9f1c5bc
 	knative.dev/reconciler-test v0.0.0-20210820180205-a25de6a08087
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace github.com/cloudevents/sdk-go/v2 => github.com/cloudevents/sdk-go/v2 v2.4.1-0.20210715165402-49fda7a51425
@@ -18,10 +18,21 @@ package v1alpha1
 
 import (
 	"context"
+	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"knative.dev/eventing/pkg/apis/messaging"
 )
 
+const (
+	// DefaultStreamReplicas is the number of replicas of a stream if not specified.
+	DefaultStreamReplicas = 1
+
+	// DefaultDuplicateWindow is the deduplication window of a stream if not specified. It's the
+	// same as the default applied by the JetStream server, capped by the max age of the stream.
+	DefaultDuplicateWindow = 2 * time.Minute
+)
+
 func (c *NatsJetStreamChannel) SetDefaults(ctx context.Context) {
 	// Set the duck subscription to the stored version of the duck
 	// we support. Reason for this is that the stored version will
@@ -39,5 +50,31 @@ func (c *NatsJetStreamChannel) SetDefaults(ctx context.Context) {
 }
 
 func (cs *NatsJetStreamChannelSpec) SetDefaults(ctx context.Context) {
-	// Noop
+	if cs.Stream == nil {
+		cs.Stream = &StreamSpec{}
+	}
+	cs.Stream.SetDefaults(ctx)
+}
+
+func (ss *StreamSpec) SetDefaults(ctx context.Context) {
+	if ss.Retention == "" {
+		ss.Retention = LimitsRetentionPolicy
+	}
+	if ss.Storage == "" {
+		ss.Storage = FileStorageType
+	}
+	if ss.Replicas == 0 {
+		ss.Replicas = DefaultStreamReplicas
+	}
+	if ss.Discard == "" {
+		ss.Discard = DiscardOldPolicy
+	}
+	if ss.DuplicateWindow == nil {
+		window := DefaultDuplicateWindow
+		// JetStream rejects duplicate windows larger than the max age of the messages.
+		if ss.MaxAge != nil && ss.MaxAge.Duration > 0 && ss.MaxAge.Duration < window {
+			window = ss.MaxAge.Duration
+		}
+		ss.DuplicateWindow = &metav1.Duration{Duration: window}
+	}
 }
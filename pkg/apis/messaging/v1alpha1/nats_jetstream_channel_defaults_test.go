@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/eventing/pkg/apis/messaging"
+)
+
+func TestNatsJetStreamChannelSetDefaults(t *testing.T) {
+	testCases := map[string]struct {
+		initial  NatsJetStreamChannel
+		expected NatsJetStreamChannel
+	}{
+		"empty": {
+			expected: NatsJetStreamChannel{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{messaging.SubscribableDuckVersionAnnotation: "v1"},
+				},
+				Spec: NatsJetStreamChannelSpec{
+					Stream: &StreamSpec{
+						Retention:       LimitsRetentionPolicy,
+						Storage:         FileStorageType,
+						Replicas:        DefaultStreamReplicas,
+						Discard:         DiscardOldPolicy,
+						DuplicateWindow: &metav1.Duration{Duration: DefaultDuplicateWindow},
+					},
+				},
+			},
+		},
+		"stream set": {
+			initial: NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					Stream: &StreamSpec{
+						Retention:       InterestRetentionPolicy,
+						Storage:         MemoryStorageType,
+						Replicas:        3,
+						DuplicateWindow: &metav1.Duration{Duration: time.Minute},
+					},
+				},
+			},
+			expected: NatsJetStreamChannel{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{messaging.SubscribableDuckVersionAnnotation: "v1"},
+				},
+				Spec: NatsJetStreamChannelSpec{
+					Stream: &StreamSpec{
+						Retention:       InterestRetentionPolicy,
+						Storage:         MemoryStorageType,
+						Replicas:        3,
+						Discard:         DiscardOldPolicy,
+						DuplicateWindow: &metav1.Duration{Duration: time.Minute},
+					},
+				},
+			},
+		},
+		"max age shorter than the default duplicate window": {
+			initial: NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					Stream: &StreamSpec{
+						MaxAge: &metav1.Duration{Duration: 30 * time.Second},
+					},
+				},
+			},
+			expected: NatsJetStreamChannel{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{messaging.SubscribableDuckVersionAnnotation: "v1"},
+				},
+				Spec: NatsJetStreamChannelSpec{
+					Stream: &StreamSpec{
+						Retention:       LimitsRetentionPolicy,
+						MaxAge:          &metav1.Duration{Duration: 30 * time.Second},
+						Storage:         FileStorageType,
+						Replicas:        DefaultStreamReplicas,
+						Discard:         DiscardOldPolicy,
+						DuplicateWindow: &metav1.Duration{Duration: 30 * time.Second},
+					},
+				},
+			},
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			tc.initial.SetDefaults(context.Background())
+			if diff := cmp.Diff(tc.expected, tc.initial); diff != "" {
+				t.Errorf("SetDefaults (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
@@ -22,6 +22,7 @@ import (
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
 
 	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	duckv1 "knative.dev/pkg/apis/duck/v1"
 )
 
@@ -48,3 +49,36 @@ func TestNatsJetStreamChannelGetStatus(t *testing.T) {
 		t.Errorf("GetStatus did not retrieve status. Got=%v Want=%v", config.GetStatus(), status)
 	}
 }
+
+func TestNatsJetStreamChannelOrdering(t *testing.T) {
+	testCases := map[string]struct {
+		channel NatsJetStreamChannel
+		want    DeliveryOrdering
+	}{
+		"default": {
+			want: UnorderedDeliveryOrdering,
+		},
+		"annotation": {
+			channel: NatsJetStreamChannel{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{DeliveryOrderingAnnotationKey: "Ordered"},
+				},
+			},
+			want: OrderedDeliveryOrdering,
+		},
+		"spec": {
+			channel: NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{DeliveryOrdering: OrderedDeliveryOrdering},
+			},
+			want: OrderedDeliveryOrdering,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if got := tc.channel.Ordering(); got != tc.want {
+				t.Errorf("Ordering() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
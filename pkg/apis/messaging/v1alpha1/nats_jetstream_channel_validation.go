@@ -19,12 +19,17 @@ package v1alpha1
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"k8s.io/apimachinery/pkg/util/validation"
 	"knative.dev/eventing/pkg/apis/eventing"
 
 	"knative.dev/pkg/apis"
 )
 
+// maxStreamReplicas is the maximum number of replicas JetStream supports for a stream.
+const maxStreamReplicas = 5
+
 func (c *NatsJetStreamChannel) Validate(ctx context.Context) *apis.FieldError {
 	errs := c.Spec.Validate(ctx).ViaField("spec")
 
@@ -37,6 +42,35 @@ func (c *NatsJetStreamChannel) Validate(ctx context.Context) *apis.FieldError {
 				errs = errs.Also(iv.ViaFieldKey("annotations", eventing.ScopeAnnotationKey).ViaField("metadata"))
 			}
 		}
+		if profile, ok := c.Annotations[ConnectionProfileAnnotationKey]; ok {
+			errs = errs.Also(validateConnectionProfile(profile).ViaFieldKey("annotations", ConnectionProfileAnnotationKey).ViaField("metadata"))
+			if c.Spec.ConnectionProfile != "" && c.Spec.ConnectionProfile != profile {
+				fe := apis.ErrInvalidValue(profile, "")
+				fe.Details = fmt.Sprintf("the annotation doesn't match spec.connectionProfile %q", c.Spec.ConnectionProfile)
+				errs = errs.Also(fe.ViaFieldKey("annotations", ConnectionProfileAnnotationKey).ViaField("metadata"))
+			}
+		}
+		if ordering, ok := c.Annotations[DeliveryOrderingAnnotationKey]; ok {
+			errs = errs.Also(validateDeliveryOrdering(DeliveryOrdering(ordering)).ViaFieldKey("annotations", DeliveryOrderingAnnotationKey).ViaField("metadata"))
+			if c.Spec.DeliveryOrdering != "" && c.Spec.DeliveryOrdering != DeliveryOrdering(ordering) {
+				fe := apis.ErrInvalidValue(ordering, "")
+				fe.Details = fmt.Sprintf("the annotation doesn't match spec.deliveryOrdering %q", c.Spec.DeliveryOrdering)
+				errs = errs.Also(fe.ViaFieldKey("annotations", DeliveryOrderingAnnotationKey).ViaField("metadata"))
+			}
+		}
+	}
+
+	if apis.IsInUpdate(ctx) {
+		original := apis.GetBaseline(ctx).(*NatsJetStreamChannel)
+		errs = errs.Also(c.Spec.Stream.checkImmutableFields(original.Spec.Stream).ViaField("spec", "stream"))
+		// The stream of the channel lives on the servers of its connection profile, it can't be moved.
+		if profile, originalProfile := c.ConnectionProfileName(), original.ConnectionProfileName(); profile != originalProfile {
+			errs = errs.Also(&apis.FieldError{
+				Message: "Immutable fields changed (-old +new)",
+				Paths:   []string{"spec.connectionProfile"},
+				Details: fmt.Sprintf("{%s} -> {%s}", originalProfile, profile),
+			})
+		}
 	}
 	return errs
 }
@@ -50,5 +84,124 @@ func (cs *NatsJetStreamChannelSpec) Validate(ctx context.Context) *apis.FieldErr
 			errs = errs.Also(fe.ViaField(fmt.Sprintf("subscriber[%d]", i)).ViaField("subscribable"))
 		}
 	}
+	if cs.ConnectionProfile != "" {
+		errs = errs.Also(validateConnectionProfile(cs.ConnectionProfile).ViaField("connectionProfile"))
+	}
+	if cs.DeliveryOrdering != "" {
+		errs = errs.Also(validateDeliveryOrdering(cs.DeliveryOrdering).ViaField("deliveryOrdering"))
+	}
+	if cs.Stream != nil {
+		errs = errs.Also(cs.Stream.Validate(ctx).ViaField("stream"))
+	}
+	if cs.DeadLetterQueue != nil && cs.DeadLetterQueue.Enabled && cs.Delivery != nil && cs.Delivery.DeadLetterSink != nil {
+		errs = errs.Also(apis.ErrMultipleOneOf("deadLetterQueue", "delivery.deadLetterSink"))
+	}
+	if cs.Deduplication != nil {
+		switch cs.Deduplication.MessageID {
+		case "", CloudEventIDMessageIDSource, CloudEventSourceAndIDMessageIDSource, NoneMessageIDSource:
+		default:
+			errs = errs.Also(apis.ErrInvalidValue(cs.Deduplication.MessageID, "messageId").ViaField("deduplication"))
+		}
+	}
+	return errs
+}
+
+func (ss *StreamSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	switch ss.Retention {
+	case "", LimitsRetentionPolicy, InterestRetentionPolicy:
+	case WorkQueueRetentionPolicy:
+		fe := apis.ErrInvalidValue(ss.Retention, "retention")
+		fe.Details = "work queue streams only allow a single consumer, while every subscriber of a channel has its own"
+		errs = errs.Also(fe)
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(ss.Retention, "retention"))
+	}
+	switch ss.Storage {
+	case "", FileStorageType, MemoryStorageType:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(ss.Storage, "storage"))
+	}
+	switch ss.Discard {
+	case "", DiscardOldPolicy, DiscardNewPolicy:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(ss.Discard, "discard"))
+	}
+
+	// Zero replicas aren't set, and defaulted.
+	if ss.Replicas != 0 && (ss.Replicas < 1 || ss.Replicas > maxStreamReplicas) {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(ss.Replicas, 1, maxStreamReplicas, "replicas"))
+	}
+	if ss.MaxBytes != nil && *ss.MaxBytes <= 0 {
+		errs = errs.Also(apis.ErrInvalidValue(*ss.MaxBytes, "maxBytes"))
+	}
+	if ss.MaxMsgs != nil && *ss.MaxMsgs <= 0 {
+		errs = errs.Also(apis.ErrInvalidValue(*ss.MaxMsgs, "maxMsgs"))
+	}
+	if ss.MaxAge != nil && ss.MaxAge.Duration < 0 {
+		errs = errs.Also(apis.ErrInvalidValue(ss.MaxAge.Duration.String(), "maxAge"))
+	}
+	if ss.DuplicateWindow != nil {
+		if ss.DuplicateWindow.Duration < 0 {
+			errs = errs.Also(apis.ErrInvalidValue(ss.DuplicateWindow.Duration.String(), "duplicateWindow"))
+		} else if ss.MaxAge != nil && ss.MaxAge.Duration > 0 && ss.DuplicateWindow.Duration > ss.MaxAge.Duration {
+			fe := apis.ErrInvalidValue(ss.DuplicateWindow.Duration.String(), "duplicateWindow")
+			fe.Details = "duplicateWindow can't be larger than maxAge"
+			errs = errs.Also(fe)
+		}
+	}
+	return errs
+}
+
+// validateConnectionProfile checks the name of a connection profile, which are DNS labels.
+func validateConnectionProfile(profile string) *apis.FieldError {
+	if errs := validation.IsDNS1123Label(profile); len(errs) > 0 {
+		fe := apis.ErrInvalidValue(profile, "")
+		fe.Details = strings.Join(errs, ", ")
+		return fe
+	}
+	return nil
+}
+
+// checkImmutableFields rejects changes JetStream can't apply to an existing stream. Channels created before they
+// had a stream section, or without some of its fields, have the stream created with the defaults.
+func (ss *StreamSpec) checkImmutableFields(original *StreamSpec) *apis.FieldError {
+	ss, original = ss.withDefaults(), original.withDefaults()
+	var errs *apis.FieldError
+	if ss.Storage != original.Storage {
+		errs = errs.Also(&apis.FieldError{
+			Message: "Immutable fields changed (-old +new)",
+			Paths:   []string{"storage"},
+			Details: fmt.Sprintf("{%s} -> {%s}", original.Storage, ss.Storage),
+		})
+	}
+	if ss.Retention != original.Retention {
+		errs = errs.Also(&apis.FieldError{
+			Message: "Immutable fields changed (-old +new)",
+			Paths:   []string{"retention"},
+			Details: fmt.Sprintf("{%s} -> {%s}", original.Retention, ss.Retention),
+		})
+	}
 	return errs
 }
+
+// withDefaults returns a copy of the stream spec with the defaults applied, the defaults only if it's nil.
+func (ss *StreamSpec) withDefaults() *StreamSpec {
+	defaulted := ss.DeepCopy()
+	if defaulted == nil {
+		defaulted = &StreamSpec{}
+	}
+	defaulted.SetDefaults(context.Background())
+	return defaulted
+}
+
+// validateDeliveryOrdering checks the delivery ordering of a channel.
+func validateDeliveryOrdering(ordering DeliveryOrdering) *apis.FieldError {
+	switch ordering {
+	case UnorderedDeliveryOrdering, OrderedDeliveryOrdering:
+		return nil
+	default:
+		return apis.ErrInvalidValue(ordering, "")
+	}
+}
@@ -19,6 +19,9 @@ package v1alpha1
 import (
 	"context"
 	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
 
@@ -26,10 +29,12 @@ import (
 	"knative.dev/pkg/webhook/resourcesemantics"
 
 	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
 )
 
 func TestNatssChannelValidation(t *testing.T) {
 	aURL, _ := apis.ParseURL("http://example.com")
+	negative := int64(-1)
 
 	testCases := map[string]struct {
 		cr   resourcesemantics.GenericCRD
@@ -96,6 +101,193 @@ func TestNatssChannelValidation(t *testing.T) {
 				return errs
 			}(),
 		},
+		"dead letter queue": {
+			cr: &NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					DeadLetterQueue: &DeadLetterQueueSpec{Enabled: true},
+				},
+			},
+			want: nil,
+		},
+		"dead letter queue and dead letter sink": {
+			cr: &NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					DeadLetterQueue: &DeadLetterQueueSpec{Enabled: true},
+					ChannelableSpec: eventingduckv1.ChannelableSpec{
+						Delivery: &eventingduckv1.DeliverySpec{
+							DeadLetterSink: &duckv1.Destination{URI: aURL},
+						},
+					},
+				},
+			},
+			want: apis.ErrMultipleOneOf("spec.deadLetterQueue", "spec.delivery.deadLetterSink"),
+		},
+		"deduplication by source and id": {
+			cr: &NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					Deduplication: &DeduplicationSpec{MessageID: CloudEventSourceAndIDMessageIDSource},
+				},
+			},
+			want: nil,
+		},
+		"invalid deduplication message id": {
+			cr: &NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					Deduplication: &DeduplicationSpec{MessageID: "Subject"},
+				},
+			},
+			want: apis.ErrInvalidValue("Subject", "spec.deduplication.messageId"),
+		},
+		"valid stream": {
+			cr: &NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					Stream: &StreamSpec{
+						Retention:       InterestRetentionPolicy,
+						MaxAge:          &metav1.Duration{Duration: time.Hour},
+						Storage:         MemoryStorageType,
+						Replicas:        3,
+						Discard:         DiscardNewPolicy,
+						DuplicateWindow: &metav1.Duration{Duration: time.Minute},
+					},
+				},
+			},
+			want: nil,
+		},
+		"invalid stream": {
+			cr: &NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					Stream: &StreamSpec{
+						Retention: "Forever",
+						MaxMsgs:   &negative,
+						Storage:   "Tape",
+						Replicas:  7,
+					},
+				},
+			},
+			want: func() *apis.FieldError {
+				var errs *apis.FieldError
+				errs = errs.Also(apis.ErrInvalidValue("Forever", "spec.stream.retention"))
+				errs = errs.Also(apis.ErrInvalidValue("Tape", "spec.stream.storage"))
+				errs = errs.Also(apis.ErrOutOfBoundsValue(7, 1, 5, "spec.stream.replicas"))
+				errs = errs.Also(apis.ErrInvalidValue(-1, "spec.stream.maxMsgs"))
+				return errs
+			}(),
+		},
+		"work queue retention": {
+			cr: &NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					Stream: &StreamSpec{
+						Retention: WorkQueueRetentionPolicy,
+					},
+				},
+			},
+			want: func() *apis.FieldError {
+				fe := apis.ErrInvalidValue("WorkQueue", "spec.stream.retention")
+				fe.Details = "work queue streams only allow a single consumer, while every subscriber of a channel has its own"
+				return fe
+			}(),
+		},
+		"defaulted stream with a short max age": {
+			cr: func() *NatsJetStreamChannel {
+				c := &NatsJetStreamChannel{
+					Spec: NatsJetStreamChannelSpec{
+						Stream: &StreamSpec{
+							MaxAge: &metav1.Duration{Duration: 30 * time.Second},
+						},
+					},
+				}
+				c.SetDefaults(context.Background())
+				return c
+			}(),
+			want: nil,
+		},
+		"valid connection profile": {
+			cr: &NatsJetStreamChannel{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{ConnectionProfileAnnotationKey: "eu-west"},
+				},
+				Spec: NatsJetStreamChannelSpec{
+					ConnectionProfile: "eu-west",
+				},
+			},
+			want: nil,
+		},
+		"invalid connection profile": {
+			cr: &NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					ConnectionProfile: "EU_WEST",
+				},
+			},
+			want: func() *apis.FieldError {
+				fe := apis.ErrInvalidValue("EU_WEST", "spec.connectionProfile")
+				fe.Details = "a lowercase RFC 1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')"
+				return fe
+			}(),
+		},
+		"connection profile annotation not matching the spec": {
+			cr: &NatsJetStreamChannel{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{ConnectionProfileAnnotationKey: "us-east"},
+				},
+				Spec: NatsJetStreamChannelSpec{
+					ConnectionProfile: "eu-west",
+				},
+			},
+			want: func() *apis.FieldError {
+				fe := apis.ErrInvalidValue("us-east", "")
+				fe.Details = `the annotation doesn't match spec.connectionProfile "eu-west"`
+				return fe.ViaFieldKey("annotations", ConnectionProfileAnnotationKey).ViaField("metadata")
+			}(),
+		},
+		"ordered delivery": {
+			cr: &NatsJetStreamChannel{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{DeliveryOrderingAnnotationKey: "Ordered"},
+				},
+				Spec: NatsJetStreamChannelSpec{
+					DeliveryOrdering: OrderedDeliveryOrdering,
+				},
+			},
+			want: nil,
+		},
+		"invalid delivery ordering": {
+			cr: &NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					DeliveryOrdering: "Sorted",
+				},
+			},
+			want: apis.ErrInvalidValue("Sorted", "spec.deliveryOrdering"),
+		},
+		"delivery ordering annotation not matching the spec": {
+			cr: &NatsJetStreamChannel{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{DeliveryOrderingAnnotationKey: "Unordered"},
+				},
+				Spec: NatsJetStreamChannelSpec{
+					DeliveryOrdering: OrderedDeliveryOrdering,
+				},
+			},
+			want: func() *apis.FieldError {
+				fe := apis.ErrInvalidValue("Unordered", "")
+				fe.Details = `the annotation doesn't match spec.deliveryOrdering "Ordered"`
+				return fe.ViaFieldKey("annotations", DeliveryOrderingAnnotationKey).ViaField("metadata")
+			}(),
+		},
+		"duplicate window larger than max age": {
+			cr: &NatsJetStreamChannel{
+				Spec: NatsJetStreamChannelSpec{
+					Stream: &StreamSpec{
+						MaxAge:          &metav1.Duration{Duration: time.Minute},
+						DuplicateWindow: &metav1.Duration{Duration: time.Hour},
+					},
+				},
+			},
+			want: func() *apis.FieldError {
+				fe := apis.ErrInvalidValue("1h0m0s", "spec.stream.duplicateWindow")
+				fe.Details = "duplicateWindow can't be larger than maxAge"
+				return fe
+			}(),
+		},
 	}
 
 	for n, test := range testCases {
@@ -107,3 +299,102 @@ func TestNatssChannelValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestNatssChannelImmutableStreamFields(t *testing.T) {
+	original := &NatsJetStreamChannel{
+		Spec: NatsJetStreamChannelSpec{
+			Stream: &StreamSpec{
+				Retention: LimitsRetentionPolicy,
+				Storage:   FileStorageType,
+			},
+		},
+	}
+	updated := original.DeepCopy()
+	updated.Spec.Stream.Storage = MemoryStorageType
+	updated.Spec.Stream.Replicas = 3
+
+	ctx := apis.WithinUpdate(context.Background(), original)
+	want := &apis.FieldError{
+		Message: "Immutable fields changed (-old +new)",
+		Paths:   []string{"spec.stream.storage"},
+		Details: "{File} -> {Memory}",
+	}
+	if diff := cmp.Diff(want.Error(), updated.Validate(ctx).Error()); diff != "" {
+		t.Errorf("validate (-want, +got) = %v", diff)
+	}
+}
+
+func TestNatssChannelImmutableStreamFieldsWithoutStream(t *testing.T) {
+	// Channels created before the stream section existed have their stream created with the defaults.
+	original := &NatsJetStreamChannel{}
+
+	testCases := map[string]struct {
+		stream *StreamSpec
+		want   *apis.FieldError
+	}{
+		"defaults": {
+			stream: &StreamSpec{Storage: FileStorageType, Retention: LimitsRetentionPolicy, Replicas: 3},
+		},
+		"storage changed": {
+			stream: &StreamSpec{Storage: MemoryStorageType},
+			want: &apis.FieldError{
+				Message: "Immutable fields changed (-old +new)",
+				Paths:   []string{"spec.stream.storage"},
+				Details: "{File} -> {Memory}",
+			},
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			updated := original.DeepCopy()
+			updated.Spec.Stream = tc.stream
+			ctx := apis.WithinUpdate(context.Background(), original)
+			if diff := cmp.Diff(tc.want.Error(), updated.Validate(ctx).Error()); diff != "" {
+				t.Errorf("validate (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestNatssChannelImmutableConnectionProfile(t *testing.T) {
+	original := &NatsJetStreamChannel{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{ConnectionProfileAnnotationKey: "eu-west"},
+		},
+	}
+
+	testCases := map[string]struct {
+		update func(*NatsJetStreamChannel)
+		want   *apis.FieldError
+	}{
+		"annotation moved to the spec": {
+			update: func(c *NatsJetStreamChannel) {
+				c.Annotations = nil
+				c.Spec.ConnectionProfile = "eu-west"
+			},
+		},
+		"profile changed": {
+			update: func(c *NatsJetStreamChannel) {
+				c.Annotations = nil
+				c.Spec.ConnectionProfile = "us-east"
+			},
+			want: &apis.FieldError{
+				Message: "Immutable fields changed (-old +new)",
+				Paths:   []string{"spec.connectionProfile"},
+				Details: "{eu-west} -> {us-east}",
+			},
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			updated := original.DeepCopy()
+			tc.update(updated)
+			ctx := apis.WithinUpdate(context.Background(), original)
+			if diff := cmp.Diff(tc.want.Error(), updated.Validate(ctx).Error()); diff != "" {
+				t.Errorf("validate (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
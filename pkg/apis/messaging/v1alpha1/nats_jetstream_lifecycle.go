@@ -28,7 +28,9 @@ var conditionSet = apis.NewLivingConditionSet(
 	NatssChannelConditionServiceReady,
 	NatssChannelConditionEndpointsReady,
 	NatssChannelConditionAddressable,
-	NatssChannelConditionChannelServiceReady)
+	NatssChannelConditionChannelServiceReady,
+	NatssChannelConditionStreamReady,
+	NatssChannelConditionDeadLetterSinkResolved)
 
 const (
 	// NatssChannelConditionReady has status True when all subconditions below have been set to True.
@@ -55,6 +57,14 @@ const (
 	// NatssChannelConditionChannelServiceReady has status True when a k8s Service representing the channel is ready.
 	// Because this uses ExternalName, there are no endpoints to check.
 	NatssChannelConditionChannelServiceReady apis.ConditionType = "ChannelServiceReady"
+
+	// NatssChannelConditionStreamReady has status True when the JetStream stream backing the channel
+	// exists and matches the desired configuration.
+	NatssChannelConditionStreamReady apis.ConditionType = "StreamReady"
+
+	// NatssChannelConditionDeadLetterSinkResolved has status True when the dead letter sink of the channel
+	// has been resolved, or when the channel has no dead letter sink.
+	NatssChannelConditionDeadLetterSinkResolved apis.ConditionType = "DeadLetterSinkResolved"
 )
 
 // GetConditionSet retrieves the condition set for this resource. Implements the KRShaped interface.
@@ -132,3 +142,26 @@ func (cs *NatsJetStreamChannelStatus) MarkEndpointsFailed(reason, messageFormat
 func (cs *NatsJetStreamChannelStatus) MarkEndpointsTrue() {
 	conditionSet.Manage(cs).MarkTrue(NatssChannelConditionEndpointsReady)
 }
+
+func (cs *NatsJetStreamChannelStatus) MarkStreamFailed(reason, messageFormat string, messageA ...interface{}) {
+	conditionSet.Manage(cs).MarkFalse(NatssChannelConditionStreamReady, reason, messageFormat, messageA...)
+}
+
+func (cs *NatsJetStreamChannelStatus) MarkStreamTrue() {
+	conditionSet.Manage(cs).MarkTrue(NatssChannelConditionStreamReady)
+}
+
+func (cs *NatsJetStreamChannelStatus) MarkDeadLetterSinkResolvedSucceeded(deadLetterSinkURI *apis.URL) {
+	cs.DeadLetterSinkURI = deadLetterSinkURI
+	conditionSet.Manage(cs).MarkTrue(NatssChannelConditionDeadLetterSinkResolved)
+}
+
+func (cs *NatsJetStreamChannelStatus) MarkDeadLetterSinkNotConfigured() {
+	cs.DeadLetterSinkURI = nil
+	conditionSet.Manage(cs).MarkTrueWithReason(NatssChannelConditionDeadLetterSinkResolved, "DeadLetterSinkNotConfigured", "No dead letter sink is configured.")
+}
+
+func (cs *NatsJetStreamChannelStatus) MarkDeadLetterSinkResolvedFailed(reason, messageFormat string, messageA ...interface{}) {
+	cs.DeadLetterSinkURI = nil
+	conditionSet.Manage(cs).MarkFalse(NatssChannelConditionDeadLetterSinkResolved, reason, messageFormat, messageA...)
+}
@@ -126,6 +126,9 @@ func TestChannelInitializeConditions(t *testing.T) {
 					}, {
 						Type:   NatssChannelConditionChannelServiceReady,
 						Status: corev1.ConditionUnknown,
+					}, {
+						Type:   NatssChannelConditionDeadLetterSinkResolved,
+						Status: corev1.ConditionUnknown,
 					}, {
 						Type:   NatssChannelConditionDispatcherReady,
 						Status: corev1.ConditionUnknown,
@@ -138,6 +141,9 @@ func TestChannelInitializeConditions(t *testing.T) {
 					}, {
 						Type:   NatssChannelConditionServiceReady,
 						Status: corev1.ConditionUnknown,
+					}, {
+						Type:   NatssChannelConditionStreamReady,
+						Status: corev1.ConditionUnknown,
 					}},
 				},
 			},
@@ -163,6 +169,9 @@ func TestChannelInitializeConditions(t *testing.T) {
 					}, {
 						Type:   NatssChannelConditionChannelServiceReady,
 						Status: corev1.ConditionUnknown,
+					}, {
+						Type:   NatssChannelConditionDeadLetterSinkResolved,
+						Status: corev1.ConditionUnknown,
 					}, {
 						Type:   NatssChannelConditionDispatcherReady,
 						Status: corev1.ConditionFalse,
@@ -175,6 +184,9 @@ func TestChannelInitializeConditions(t *testing.T) {
 					}, {
 						Type:   NatssChannelConditionServiceReady,
 						Status: corev1.ConditionUnknown,
+					}, {
+						Type:   NatssChannelConditionStreamReady,
+						Status: corev1.ConditionUnknown,
 					}},
 				},
 			},
@@ -200,6 +212,9 @@ func TestChannelInitializeConditions(t *testing.T) {
 					}, {
 						Type:   NatssChannelConditionChannelServiceReady,
 						Status: corev1.ConditionUnknown,
+					}, {
+						Type:   NatssChannelConditionDeadLetterSinkResolved,
+						Status: corev1.ConditionUnknown,
 					}, {
 						Type:   NatssChannelConditionDispatcherReady,
 						Status: corev1.ConditionTrue,
@@ -212,6 +227,9 @@ func TestChannelInitializeConditions(t *testing.T) {
 					}, {
 						Type:   NatssChannelConditionServiceReady,
 						Status: corev1.ConditionUnknown,
+					}, {
+						Type:   NatssChannelConditionStreamReady,
+						Status: corev1.ConditionUnknown,
 					}},
 				},
 			},
@@ -235,6 +253,8 @@ func TestChannelIsReady(t *testing.T) {
 		markChannelServiceReady bool
 		setAddress              bool
 		markEndpointsReady      bool
+		markStreamReady         bool
+		markDeadLetterSinkReady bool
 		wantReady               bool
 		dispatcherStatus        *appsv1.DeploymentStatus
 	}{{
@@ -242,6 +262,8 @@ func TestChannelIsReady(t *testing.T) {
 		markServiceReady:        true,
 		markChannelServiceReady: true,
 		markEndpointsReady:      true,
+		markStreamReady:         true,
+		markDeadLetterSinkReady: true,
 		dispatcherStatus:        deploymentStatusReady,
 		setAddress:              true,
 		wantReady:               true,
@@ -285,6 +307,26 @@ func TestChannelIsReady(t *testing.T) {
 		dispatcherStatus:        deploymentStatusReady,
 		setAddress:              true,
 		wantReady:               false,
+	}, {
+		name:                    "stream not ready",
+		markServiceReady:        true,
+		markChannelServiceReady: true,
+		markEndpointsReady:      true,
+		markStreamReady:         false,
+		markDeadLetterSinkReady: true,
+		dispatcherStatus:        deploymentStatusReady,
+		setAddress:              true,
+		wantReady:               false,
+	}, {
+		name:                    "dead letter sink not resolved",
+		markServiceReady:        true,
+		markChannelServiceReady: true,
+		markEndpointsReady:      true,
+		markStreamReady:         true,
+		markDeadLetterSinkReady: false,
+		dispatcherStatus:        deploymentStatusReady,
+		setAddress:              true,
+		wantReady:               false,
 	}}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -308,6 +350,16 @@ func TestChannelIsReady(t *testing.T) {
 			} else {
 				cs.MarkEndpointsFailed("NotReadyEndpoints", "testing")
 			}
+			if test.markStreamReady {
+				cs.MarkStreamTrue()
+			} else {
+				cs.MarkStreamFailed("NotReadyStream", "testing")
+			}
+			if test.markDeadLetterSinkReady {
+				cs.MarkDeadLetterSinkNotConfigured()
+			} else {
+				cs.MarkDeadLetterSinkResolvedFailed("NotResolvedDeadLetterSink", "testing")
+			}
 			if test.dispatcherStatus != nil {
 				cs.PropagateDispatcherStatus(test.dispatcherStatus)
 			} else {
@@ -383,3 +435,31 @@ func TestNatssChannelStatus_SetAddressable(t *testing.T) {
 		})
 	}
 }
+
+func TestNatssChannelStatus_MarkDeadLetterSink(t *testing.T) {
+	deadLetterSinkURI := apis.HTTP("dead-letter.default.svc.cluster.local")
+
+	cs := &NatsJetStreamChannelStatus{}
+	cs.InitializeConditions()
+
+	cs.MarkDeadLetterSinkResolvedSucceeded(deadLetterSinkURI)
+	if diff := cmp.Diff(deadLetterSinkURI, cs.DeadLetterSinkURI); diff != "" {
+		t.Errorf("unexpected dead letter sink URI (-want, +got) = %v", diff)
+	}
+	if got := cs.GetCondition(NatssChannelConditionDeadLetterSinkResolved); !got.IsTrue() {
+		t.Errorf("unexpected condition, want True, got %v", got)
+	}
+
+	cs.MarkDeadLetterSinkResolvedFailed("Unresolvable", "testing")
+	if cs.DeadLetterSinkURI != nil {
+		t.Errorf("unexpected dead letter sink URI, want nil, got %v", cs.DeadLetterSinkURI)
+	}
+	if got := cs.GetCondition(NatssChannelConditionDeadLetterSinkResolved); !got.IsFalse() {
+		t.Errorf("unexpected condition, want False, got %v", got)
+	}
+
+	cs.MarkDeadLetterSinkNotConfigured()
+	if got := cs.GetCondition(NatssChannelConditionDeadLetterSinkResolved); !got.IsTrue() {
+		t.Errorf("unexpected condition, want True, got %v", got)
+	}
+}
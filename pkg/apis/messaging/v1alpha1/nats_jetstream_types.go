@@ -20,6 +20,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
 	"knative.dev/pkg/apis"
 	duckv1 "knative.dev/pkg/apis/duck/v1"
@@ -57,14 +58,165 @@ var (
 	_ duckv1.KRShaped    = (*NatsJetStreamChannel)(nil)
 )
 
+// ConnectionProfileAnnotationKey is the annotation referencing the connection profile of a NatsJetStreamChannel,
+// for channels created from a template which can't set the spec field.
+const ConnectionProfileAnnotationKey = "messaging.knative.dev/nats-connection-profile"
+
+// DeliveryOrderingAnnotationKey is the annotation setting the delivery ordering of a NatsJetStreamChannel, for
+// channels created from a template which can't set the spec field.
+const DeliveryOrderingAnnotationKey = "messaging.knative.dev/nats-delivery-ordering"
+
 // NatsJetStreamChannelSpec defines the specification for a NatssChannel.
 type NatsJetStreamChannelSpec struct {
+	// ConnectionProfile is the name of the connection profile, defined in the config-nats ConfigMap, of the
+	// NATS JetStream servers the channel is served by. The default servers are used if it's empty.
+	// +optional
+	ConnectionProfile string `json:"connectionProfile,omitempty"`
+
+	// Stream configures the JetStream stream backing the channel.
+	// +optional
+	Stream *StreamSpec `json:"stream,omitempty"`
+
+	// DeadLetterQueue configures the dead letter queue of the channel, an alternative to a dead letter
+	// sink which keeps the events that couldn't be delivered in the stream of the channel.
+	// +optional
+	DeadLetterQueue *DeadLetterQueueSpec `json:"deadLetterQueue,omitempty"`
+
+	// DeliveryOrdering is the order the events of the channel are delivered to each subscriber in.
+	// Defaults to Unordered.
+	// +optional
+	DeliveryOrdering DeliveryOrdering `json:"deliveryOrdering,omitempty"`
+
+	// Deduplication configures how the events published to the channel are deduplicated by the stream.
+	// +optional
+	Deduplication *DeduplicationSpec `json:"deduplication,omitempty"`
+
 	// inherits duck/v1 ChannelableSpec, which currently provides:
 	// * SubscribableSpec - List of subscribers
 	// * DeliverySpec - contains options controlling the event delivery
 	eventingduckv1.ChannelableSpec `json:",inline"`
 }
 
+// DeadLetterQueueSpec defines the dead letter queue of a NatsJetStreamChannel.
+type DeadLetterQueueSpec struct {
+	// Enabled republishes the events which couldn't be delivered to a subscriber to the dead letter
+	// stream of the channel, KNDLQ_<namespace>_<name>, together with headers describing the failure.
+	// The dead letter stream keeps the storage and replicas of the channel stream, but none of its
+	// retention and limits, and is deleted along with the channel.
+	// Subscribers with a dead letter sink of their own keep using it.
+	Enabled bool `json:"enabled"`
+}
+
+// DeliveryOrdering determines the order the events of a channel are delivered to each subscriber in.
+type DeliveryOrdering string
+
+const (
+	// UnorderedDeliveryOrdering doesn't wait for an event to be delivered before delivering the next ones, so
+	// events which are retried can be delivered after the ones published later. The events are sent to a
+	// subscriber one at a time, unless its Subscription opts it into pull mode or key ordering, which deliver
+	// events concurrently.
+	UnorderedDeliveryOrdering DeliveryOrdering = "Unordered"
+
+	// OrderedDeliveryOrdering delivers the events to a subscriber one at a time, in the order of the stream. An
+	// event is only delivered once the previous one was delivered or given up on.
+	OrderedDeliveryOrdering DeliveryOrdering = "Ordered"
+)
+
+// MessageIDSource determines what the ID of the messages published to a stream is taken from. The stream drops
+// messages whose ID it has seen already within its duplicate window.
+type MessageIDSource string
+
+const (
+	// CloudEventIDMessageIDSource uses the ID of the CloudEvent, so that retries of a producer are deduplicated.
+	CloudEventIDMessageIDSource MessageIDSource = "CloudEventID"
+
+	// CloudEventSourceAndIDMessageIDSource uses the source and the ID of the CloudEvent, which are unique
+	// together, for channels receiving events from producers which don't have unique IDs across sources.
+	CloudEventSourceAndIDMessageIDSource MessageIDSource = "CloudEventSourceAndID"
+
+	// NoneMessageIDSource publishes messages without an ID, disabling the deduplication.
+	NoneMessageIDSource MessageIDSource = "None"
+)
+
+// DeduplicationSpec defines the deduplication of the events published to a NatsJetStreamChannel.
+type DeduplicationSpec struct {
+	// MessageID is what the ID of the messages is taken from. Defaults to CloudEventID.
+	// +optional
+	MessageID MessageIDSource `json:"messageId,omitempty"`
+}
+
+// RetentionPolicy determines how messages are removed from a stream.
+type RetentionPolicy string
+
+const (
+	// LimitsRetentionPolicy keeps messages until any of the stream limits is reached.
+	LimitsRetentionPolicy RetentionPolicy = "Limits"
+
+	// InterestRetentionPolicy keeps messages as long as there are consumers that didn't acknowledge them.
+	InterestRetentionPolicy RetentionPolicy = "Interest"
+
+	// WorkQueueRetentionPolicy removes messages as soon as they are acknowledged by a consumer. It isn't supported
+	// by channels: every subscriber has a consumer of its own, which work queue streams don't allow.
+	WorkQueueRetentionPolicy RetentionPolicy = "WorkQueue"
+)
+
+// StorageType determines how messages of a stream are stored.
+type StorageType string
+
+const (
+	// FileStorageType stores the messages on disk.
+	FileStorageType StorageType = "File"
+
+	// MemoryStorageType stores the messages in memory only.
+	MemoryStorageType StorageType = "Memory"
+)
+
+// DiscardPolicy determines which messages are discarded once a stream reaches its limits.
+type DiscardPolicy string
+
+const (
+	// DiscardOldPolicy removes the oldest messages to make room for new ones.
+	DiscardOldPolicy DiscardPolicy = "Old"
+
+	// DiscardNewPolicy rejects new messages.
+	DiscardNewPolicy DiscardPolicy = "New"
+)
+
+// StreamSpec defines the configuration of the JetStream stream backing a NatsJetStreamChannel.
+type StreamSpec struct {
+	// Retention is the policy used to remove messages from the stream.
+	// +optional
+	Retention RetentionPolicy `json:"retention,omitempty"`
+
+	// MaxAge is the maximum age of the messages kept in the stream. Unlimited if not set.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+
+	// MaxBytes is the maximum size in bytes of the stream. Unlimited if not set.
+	// +optional
+	MaxBytes *int64 `json:"maxBytes,omitempty"`
+
+	// MaxMsgs is the maximum number of messages kept in the stream. Unlimited if not set.
+	// +optional
+	MaxMsgs *int64 `json:"maxMsgs,omitempty"`
+
+	// Storage is the type of storage used by the stream.
+	// +optional
+	Storage StorageType `json:"storage,omitempty"`
+
+	// Replicas is the number of replicas of the stream kept in a clustered JetStream. Defaults to 1.
+	// +optional
+	Replicas int `json:"replicas,omitempty"`
+
+	// Discard is the policy used once the stream reaches its limits.
+	// +optional
+	Discard DiscardPolicy `json:"discard,omitempty"`
+
+	// DuplicateWindow is the window within which messages with the same ID are deduplicated.
+	// +optional
+	DuplicateWindow *metav1.Duration `json:"duplicateWindow,omitempty"`
+}
+
 // NatsJetStreamChannelStatus represents the current state of a NatssChannel.
 type NatsJetStreamChannelStatus struct {
 	// inherits duck/v1 ChannelableStatus, which currently provides:
@@ -75,6 +227,35 @@ type NatsJetStreamChannelStatus struct {
 	// * DeadLetterChannel is a KReference and is set by the channel when it supports native error handling via a channel
 	//   Failed messages are delivered here.
 	eventingduckv1.ChannelableStatus `json:",inline"`
+
+	// DeadLetterSinkURI is the resolved URI of the dead letter sink configured in the delivery spec of
+	// the channel. Failed messages of subscribers without their own delivery spec are delivered here.
+	// +optional
+	DeadLetterSinkURI *apis.URL `json:"deadLetterSinkUri,omitempty"`
+
+	// Consumers is populated with the state of the JetStream consumer of each of the channel's subscribers, which
+	// tells how far behind the stream the subscriber is.
+	// +optional
+	Consumers []ConsumerStatus `json:"consumers,omitempty"`
+}
+
+// ConsumerStatus is the state of the JetStream consumer delivering the events of the channel to a subscriber.
+type ConsumerStatus struct {
+	// UID is the UID of the subscriber.
+	UID types.UID `json:"uid"`
+
+	// Pending is the number of events of the stream which weren't delivered to the subscriber yet.
+	Pending uint64 `json:"pending"`
+
+	// AckPending is the number of events delivered to the subscriber which weren't acknowledged yet.
+	AckPending int `json:"ackPending"`
+
+	// Redelivered is the number of events which were delivered to the subscriber more than once and weren't
+	// acknowledged yet.
+	Redelivered int `json:"redelivered"`
+
+	// LastDeliveredSequence is the stream sequence of the last event delivered to the subscriber.
+	LastDeliveredSequence uint64 `json:"lastDeliveredSequence"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -92,6 +273,27 @@ func (*NatsJetStreamChannel) GetGroupVersionKind() schema.GroupVersionKind {
 	return SchemeGroupVersion.WithKind("NatsJetStreamChannel")
 }
 
+// ConnectionProfileName returns the name of the connection profile of the channel, set either in the spec or
+// with the ConnectionProfileAnnotationKey annotation.
+func (n *NatsJetStreamChannel) ConnectionProfileName() string {
+	if n.Spec.ConnectionProfile != "" {
+		return n.Spec.ConnectionProfile
+	}
+	return n.Annotations[ConnectionProfileAnnotationKey]
+}
+
+// Ordering returns the delivery ordering of the channel, set either in the spec or with the
+// DeliveryOrderingAnnotationKey annotation.
+func (n *NatsJetStreamChannel) Ordering() DeliveryOrdering {
+	if n.Spec.DeliveryOrdering != "" {
+		return n.Spec.DeliveryOrdering
+	}
+	if ordering, ok := n.Annotations[DeliveryOrderingAnnotationKey]; ok {
+		return DeliveryOrdering(ordering)
+	}
+	return UnorderedDeliveryOrdering
+}
+
 // GetStatus retrieves the duck status for this resource. Implements the KRShaped interface.
 func (n *NatsJetStreamChannel) GetStatus() *duckv1.Status {
 	return &n.Status.Status
@@ -21,9 +21,59 @@ limitations under the License.
 package v1alpha1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	apis "knative.dev/pkg/apis"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsumerStatus) DeepCopyInto(out *ConsumerStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsumerStatus.
+func (in *ConsumerStatus) DeepCopy() *ConsumerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsumerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeadLetterQueueSpec) DeepCopyInto(out *DeadLetterQueueSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeadLetterQueueSpec.
+func (in *DeadLetterQueueSpec) DeepCopy() *DeadLetterQueueSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DeadLetterQueueSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeduplicationSpec) DeepCopyInto(out *DeduplicationSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeduplicationSpec.
+func (in *DeduplicationSpec) DeepCopy() *DeduplicationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DeduplicationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NatsJetStreamChannel) DeepCopyInto(out *NatsJetStreamChannel) {
 	*out = *in
@@ -88,6 +138,21 @@ func (in *NatsJetStreamChannelList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NatsJetStreamChannelSpec) DeepCopyInto(out *NatsJetStreamChannelSpec) {
 	*out = *in
+	if in.Stream != nil {
+		in, out := &in.Stream, &out.Stream
+		*out = new(StreamSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeadLetterQueue != nil {
+		in, out := &in.DeadLetterQueue, &out.DeadLetterQueue
+		*out = new(DeadLetterQueueSpec)
+		**out = **in
+	}
+	if in.Deduplication != nil {
+		in, out := &in.Deduplication, &out.Deduplication
+		*out = new(DeduplicationSpec)
+		**out = **in
+	}
 	in.ChannelableSpec.DeepCopyInto(&out.ChannelableSpec)
 	return
 }
@@ -106,6 +171,16 @@ func (in *NatsJetStreamChannelSpec) DeepCopy() *NatsJetStreamChannelSpec {
 func (in *NatsJetStreamChannelStatus) DeepCopyInto(out *NatsJetStreamChannelStatus) {
 	*out = *in
 	in.ChannelableStatus.DeepCopyInto(&out.ChannelableStatus)
+	if in.DeadLetterSinkURI != nil {
+		in, out := &in.DeadLetterSinkURI, &out.DeadLetterSinkURI
+		*out = new(apis.URL)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = make([]ConsumerStatus, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -118,3 +193,39 @@ func (in *NatsJetStreamChannelStatus) DeepCopy() *NatsJetStreamChannelStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StreamSpec) DeepCopyInto(out *StreamSpec) {
+	*out = *in
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxBytes != nil {
+		in, out := &in.MaxBytes, &out.MaxBytes
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxMsgs != nil {
+		in, out := &in.MaxMsgs, &out.MaxMsgs
+		*out = new(int64)
+		**out = **in
+	}
+	if in.DuplicateWindow != nil {
+		in, out := &in.DuplicateWindow, &out.DuplicateWindow
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StreamSpec.
+func (in *StreamSpec) DeepCopy() *StreamSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StreamSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"knative.dev/pkg/configmap"
+	"sigs.k8s.io/yaml"
+
+	"knative.dev/eventing-natss/pkg/natsutil"
+	"knative.dev/eventing-natss/pkg/util"
+)
+
+const (
+	// ConfigMapName is the name of the ConfigMap holding the configuration of the connections to NATS.
+	ConfigMapName = "config-nats"
+
+	jetStreamURLKey   = "jetstream-url"
+	natssURLKey       = "natss-url"
+	clusterIDKey      = "cluster-id"
+	ackWaitMinutesKey = "ack-wait-minutes"
+	maxInflightKey    = "max-inflight"
+
+	connectionProfilesKey = "connection-profiles"
+
+	auditLogKey           = "audit-log"
+	auditLogSampleRateKey = "audit-log-sample-rate"
+)
+
+// NatsConfig is the configuration of the connections of the dispatchers to NATS.
+type NatsConfig struct {
+	// JetStreamURL is the URL of the NATS JetStream servers, comma separated.
+	JetStreamURL string
+	// NatssURL is the URL of the NATS Streaming servers, comma separated.
+	NatssURL string
+	// ClusterID is the cluster ID of the NATS Streaming servers.
+	ClusterID string
+	// AckWaitMinutes is how long a message may remain unacknowledged before it's redelivered.
+	AckWaitMinutes int
+	// MaxInflight is the maximum number of unacknowledged messages delivered to a subscriber.
+	MaxInflight int
+	// ConnectionProfiles are the NATS JetStream servers channels can reference by name, besides the default
+	// one at JetStreamURL.
+	ConnectionProfiles map[string]natsutil.ConnectionProfile
+	// AuditLog enables the audit records of the dispatchers, one per event and per hop through the channel.
+	AuditLog bool
+	// AuditLogSampleRate is the fraction of the events the audit records are logged for.
+	AuditLogSampleRate float64
+}
+
+// defaultConfig returns the configuration used for the keys missing from the ConfigMap, which comes from the
+// environment variables configuring the dispatchers before the ConfigMap was introduced.
+func defaultConfig() *NatsConfig {
+	return &NatsConfig{
+		JetStreamURL:       util.GetDefaultJetStreamURL(),
+		NatssURL:           util.GetDefaultNatssURL(),
+		ClusterID:          util.GetDefaultClusterID(),
+		AckWaitMinutes:     util.GetAckWaitMinutes(),
+		MaxInflight:        util.GetMaxInflight(),
+		AuditLogSampleRate: 1,
+	}
+}
+
+// NewConfigFromMap creates a NatsConfig from the data of the ConfigMap.
+func NewConfigFromMap(data map[string]string) (*NatsConfig, error) {
+	nc := defaultConfig()
+	if err := configmap.Parse(data,
+		configmap.AsString(jetStreamURLKey, &nc.JetStreamURL),
+		configmap.AsString(natssURLKey, &nc.NatssURL),
+		configmap.AsString(clusterIDKey, &nc.ClusterID),
+		configmap.AsInt(ackWaitMinutesKey, &nc.AckWaitMinutes),
+		configmap.AsInt(maxInflightKey, &nc.MaxInflight),
+		asConnectionProfiles(connectionProfilesKey, &nc.ConnectionProfiles),
+		configmap.AsBool(auditLogKey, &nc.AuditLog),
+		configmap.AsFloat64(auditLogSampleRateKey, &nc.AuditLogSampleRate),
+	); err != nil {
+		return nil, err
+	}
+	if err := nc.Validate(); err != nil {
+		return nil, err
+	}
+	return nc, nil
+}
+
+// NewConfigFromConfigMap creates a NatsConfig from the ConfigMap.
+func NewConfigFromConfigMap(cm *corev1.ConfigMap) (*NatsConfig, error) {
+	return NewConfigFromMap(cm.Data)
+}
+
+// Validate checks the values of the configuration.
+func (nc *NatsConfig) Validate() error {
+	if err := validateURLs(nc.JetStreamURL); err != nil {
+		return fmt.Errorf("invalid %s: %w", jetStreamURLKey, err)
+	}
+	if err := validateURLs(nc.NatssURL); err != nil {
+		return fmt.Errorf("invalid %s: %w", natssURLKey, err)
+	}
+	if nc.ClusterID == "" {
+		return fmt.Errorf("%s can't be empty", clusterIDKey)
+	}
+	if nc.AckWaitMinutes <= 0 {
+		return fmt.Errorf("%s must be positive, got %d", ackWaitMinutesKey, nc.AckWaitMinutes)
+	}
+	if nc.MaxInflight <= 0 {
+		return fmt.Errorf("%s must be positive, got %d", maxInflightKey, nc.MaxInflight)
+	}
+	if nc.AuditLogSampleRate <= 0 || nc.AuditLogSampleRate > 1 {
+		return fmt.Errorf("%s must be within (0, 1], got %v", auditLogSampleRateKey, nc.AuditLogSampleRate)
+	}
+	for name, profile := range nc.ConnectionProfiles {
+		if err := validateConnectionProfile(name, profile); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", connectionProfilesKey, name, err)
+		}
+	}
+	return nil
+}
+
+// JetStreamProfiles returns the connection profiles of the NATS JetStream servers, including the default one
+// which is connected to with defaultConnection.
+func (nc *NatsConfig) JetStreamProfiles(defaultConnection natsutil.ConnectionConfig) map[string]natsutil.ConnectionProfile {
+	profiles := make(map[string]natsutil.ConnectionProfile, len(nc.ConnectionProfiles)+1)
+	for name, profile := range nc.ConnectionProfiles {
+		profiles[name] = profile
+	}
+	profiles[natsutil.DefaultConnectionProfile] = natsutil.ConnectionProfile{
+		URL:              nc.JetStreamURL,
+		ConnectionConfig: defaultConnection,
+	}
+	return profiles
+}
+
+// asConnectionProfiles parses the YAML map of the connection profiles at key, if present.
+func asConnectionProfiles(key string, target *map[string]natsutil.ConnectionProfile) configmap.ParseFunc {
+	return func(data map[string]string) error {
+		raw, ok := data[key]
+		if !ok {
+			return nil
+		}
+		profiles := make(map[string]natsutil.ConnectionProfile)
+		if err := yaml.UnmarshalStrict([]byte(raw), &profiles); err != nil {
+			return fmt.Errorf("failed to parse %q: %w", key, err)
+		}
+		*target = profiles
+		return nil
+	}
+}
+
+// validateConnectionProfile checks a connection profile, whose name is referenced by channels.
+func validateConnectionProfile(name string, profile natsutil.ConnectionProfile) error {
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	if err := validateURLs(profile.URL); err != nil {
+		return err
+	}
+	if profile.Auth != nil {
+		if err := profile.Auth.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateURLs checks a comma separated list of NATS server URLs.
+func validateURLs(urls string) error {
+	if strings.TrimSpace(urls) == "" {
+		return errors.New("no server URL")
+	}
+	for _, s := range strings.Split(urls, ",") {
+		u, err := url.Parse(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		switch u.Scheme {
+		case "nats", "tls", "ws", "wss":
+		default:
+			return fmt.Errorf("unsupported scheme %q in %q", u.Scheme, s)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("no host in %q", s)
+		}
+	}
+	return nil
+}
+
+// Watch calls onChange with the configuration every time the ConfigMap changes. The ConfigMap is optional when
+// the watcher supports defaults, the environment variables are used for the missing keys. Invalid changes are
+// logged and ignored, so that the dispatchers keep running with the last valid configuration.
+func Watch(cmw configmap.Watcher, logger *zap.SugaredLogger, onChange func(*NatsConfig)) {
+	observer := func(cm *corev1.ConfigMap) {
+		nc, err := NewConfigFromConfigMap(cm)
+		if err != nil {
+			logger.Errorw("Ignoring invalid NATS configuration", zap.String("configmap", ConfigMapName), zap.Error(err))
+			return
+		}
+		logger.Infow("NATS configuration updated", zap.Any("config", nc))
+		onChange(nc)
+	}
+
+	if dw, ok := cmw.(configmap.DefaultingWatcher); ok {
+		dw.WatchWithDefault(corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName}}, observer)
+	} else {
+		cmw.Watch(ConfigMapName, observer)
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/configmap"
+
+	"knative.dev/eventing-natss/pkg/natsutil"
+)
+
+func TestNewConfigFromMap(t *testing.T) {
+	defaults := defaultConfig()
+
+	testCases := map[string]struct {
+		data    map[string]string
+		want    *NatsConfig
+		wantErr bool
+	}{
+		"empty": {
+			data: map[string]string{},
+			want: defaults,
+		},
+		"all keys": {
+			data: map[string]string{
+				jetStreamURLKey:       "nats://nats-0.nats:4222, nats://nats-1.nats:4222",
+				natssURLKey:           "tls://natss.natss:4222",
+				clusterIDKey:          "my-cluster",
+				ackWaitMinutesKey:     "5",
+				maxInflightKey:        "100",
+				auditLogKey:           "true",
+				auditLogSampleRateKey: "0.1",
+			},
+			want: &NatsConfig{
+				JetStreamURL:       "nats://nats-0.nats:4222, nats://nats-1.nats:4222",
+				NatssURL:           "tls://natss.natss:4222",
+				ClusterID:          "my-cluster",
+				AckWaitMinutes:     5,
+				MaxInflight:        100,
+				AuditLog:           true,
+				AuditLogSampleRate: 0.1,
+			},
+		},
+		"connection profiles": {
+			data: map[string]string{
+				connectionProfilesKey: `
+eu-west:
+  url: nats://nats.eu-west.example.com:4222
+  tls:
+    caFile: /etc/nats/eu-west/ca.crt
+  auth:
+    credentialsFile: /etc/nats/eu-west/user.creds
+us-east:
+  url: tls://nats.us-east.example.com:4222
+`,
+			},
+			want: &NatsConfig{
+				JetStreamURL:       defaults.JetStreamURL,
+				NatssURL:           defaults.NatssURL,
+				ClusterID:          defaults.ClusterID,
+				AckWaitMinutes:     defaults.AckWaitMinutes,
+				MaxInflight:        defaults.MaxInflight,
+				AuditLogSampleRate: defaults.AuditLogSampleRate,
+				ConnectionProfiles: map[string]natsutil.ConnectionProfile{
+					"eu-west": {
+						URL: "nats://nats.eu-west.example.com:4222",
+						ConnectionConfig: natsutil.ConnectionConfig{
+							TLS:  &natsutil.TLSConfig{CAFile: "/etc/nats/eu-west/ca.crt"},
+							Auth: &natsutil.AuthConfig{CredentialsFile: "/etc/nats/eu-west/user.creds"},
+						},
+					},
+					"us-east": {
+						URL: "tls://nats.us-east.example.com:4222",
+					},
+				},
+			},
+		},
+		"unknown connection profile field": {
+			data:    map[string]string{connectionProfilesKey: "eu-west:\n  urls: nats://nats.eu-west.example.com:4222\n"},
+			wantErr: true,
+		},
+		"invalid connection profile name": {
+			data:    map[string]string{connectionProfilesKey: "EU_WEST:\n  url: nats://nats.eu-west.example.com:4222\n"},
+			wantErr: true,
+		},
+		"connection profile without url": {
+			data:    map[string]string{connectionProfilesKey: "eu-west:\n  tls: {}\n"},
+			wantErr: true,
+		},
+		"connection profile with two authentication methods": {
+			data:    map[string]string{connectionProfilesKey: "eu-west:\n  url: nats://nats.eu-west.example.com:4222\n  auth:\n    tokenFile: /t\n    nkeySeedFile: /s\n"},
+			wantErr: true,
+		},
+		"not a number": {
+			data:    map[string]string{maxInflightKey: "many"},
+			wantErr: true,
+		},
+		"unsupported scheme": {
+			data:    map[string]string{jetStreamURLKey: "http://nats.nats:4222"},
+			wantErr: true,
+		},
+		"missing host": {
+			data:    map[string]string{natssURLKey: "nats://"},
+			wantErr: true,
+		},
+		"empty url": {
+			data:    map[string]string{jetStreamURLKey: " "},
+			wantErr: true,
+		},
+		"empty cluster id": {
+			data:    map[string]string{clusterIDKey: ""},
+			wantErr: true,
+		},
+		"zero ack wait": {
+			data:    map[string]string{ackWaitMinutesKey: "0"},
+			wantErr: true,
+		},
+		"negative inflight": {
+			data:    map[string]string{maxInflightKey: "-1"},
+			wantErr: true,
+		},
+		"zero audit log sample rate": {
+			data:    map[string]string{auditLogSampleRateKey: "0"},
+			wantErr: true,
+		},
+		"audit log sample rate above one": {
+			data:    map[string]string{auditLogSampleRateKey: "1.5"},
+			wantErr: true,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, err := NewConfigFromMap(tc.data)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("NewConfigFromMap() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewConfigFromMap() unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("NewConfigFromMap() (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestJetStreamProfiles(t *testing.T) {
+	nc := &NatsConfig{
+		JetStreamURL: "nats://jetstream.nats:4222",
+		ConnectionProfiles: map[string]natsutil.ConnectionProfile{
+			"eu-west": {URL: "nats://nats.eu-west.example.com:4222"},
+		},
+	}
+	defaultConnection := natsutil.ConnectionConfig{Auth: &natsutil.AuthConfig{TokenFile: "/etc/nats/token"}}
+
+	want := map[string]natsutil.ConnectionProfile{
+		natsutil.DefaultConnectionProfile: {URL: "nats://jetstream.nats:4222", ConnectionConfig: defaultConnection},
+		"eu-west":                         {URL: "nats://nats.eu-west.example.com:4222"},
+	}
+	if diff := cmp.Diff(want, nc.JetStreamProfiles(defaultConnection)); diff != "" {
+		t.Errorf("JetStreamProfiles() (-want, +got) = %v", diff)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	cmw := configmap.NewStaticWatcher(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName},
+		Data:       map[string]string{maxInflightKey: "42"},
+	})
+
+	var got *NatsConfig
+	Watch(cmw, zap.NewNop().Sugar(), func(nc *NatsConfig) {
+		got = nc
+	})
+	if got == nil {
+		t.Fatal("Watch() didn't call onChange")
+	}
+	if got.MaxInflight != 42 {
+		t.Errorf("MaxInflight = %d, want 42", got.MaxInflight)
+	}
+}
+
+func TestWatchInvalid(t *testing.T) {
+	cmw := configmap.NewStaticWatcher(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName},
+		Data:       map[string]string{ackWaitMinutesKey: "-5"},
+	})
+
+	Watch(cmw, zap.NewNop().Sugar(), func(nc *NatsConfig) {
+		t.Errorf("Watch() called onChange with the invalid configuration %+v", nc)
+	})
+}
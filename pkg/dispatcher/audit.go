@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"sync"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+	eventingchannels "knative.dev/eventing/pkg/channel"
+)
+
+// The hops of an event through a channel, an audit record is logged for each of them.
+const (
+	// auditAccepted is the event accepted by the channel and published to NATS.
+	auditAccepted = "accepted"
+	// auditRejected is the event the channel failed to publish to NATS.
+	auditRejected = "rejected"
+	// auditReceived is the event received from NATS, to be delivered to a subscriber.
+	auditReceived = "received"
+	// auditDelivered is the event delivered to a subscriber.
+	auditDelivered = "delivered"
+	// auditFailed is the event a subscriber failed to receive.
+	auditFailed = "failed"
+	// auditDeadLettered is the event sent to the dead letter sink or queue, after the subscriber failed to receive it.
+	auditDeadLettered = "dead_lettered"
+)
+
+// auditLogger logs the audit records of the events, when the audit mode is enabled. Events are sampled by their
+// source and ID, so that either all the records of an event are logged or none.
+type auditLogger struct {
+	logger *zap.Logger
+
+	mux        sync.RWMutex
+	enabled    bool
+	sampleRate float64
+}
+
+func newAuditLogger(logger *zap.Logger) *auditLogger {
+	return &auditLogger{logger: logger.Named("audit"), sampleRate: 1}
+}
+
+// update applies the audit configuration of the config-nats ConfigMap.
+func (a *auditLogger) update(enabled bool, sampleRate float64) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.enabled, a.sampleRate = enabled, sampleRate
+}
+
+func (a *auditLogger) isEnabled() bool {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	return a.enabled
+}
+
+// sample returns e if its records are logged, or nil if they aren't.
+func (a *auditLogger) sample(e *event.Event) *event.Event {
+	a.mux.RLock()
+	enabled, sampleRate := a.enabled, a.sampleRate
+	a.mux.RUnlock()
+	if !enabled || e == nil {
+		return nil
+	}
+	if sampleRate < 1 {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(e.Source()))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(e.ID()))
+		if float64(h.Sum32())/(math.MaxUint32+1) >= sampleRate {
+			return nil
+		}
+	}
+	return e
+}
+
+// sampleData returns the event of a structured message received from NATS if its records are logged, or nil.
+func (a *auditLogger) sampleData(data []byte) *event.Event {
+	if !a.isEnabled() {
+		return nil
+	}
+	e := event.New()
+	if err := json.Unmarshal(data, &e); err != nil {
+		a.logger.Debug("could not read the event of the message", zap.Error(err))
+		return nil
+	}
+	return a.sample(&e)
+}
+
+// record logs the record of the hop of e through channel, unless e is nil because it isn't sampled. The subscriber
+// is empty for the hops before the event is delivered.
+func (a *auditLogger) record(e *event.Event, hop string, channel eventingchannels.ChannelReference, subscriber types.UID, fields ...zap.Field) {
+	if e == nil {
+		return
+	}
+	fields = append([]zap.Field{
+		zap.String("hop", hop),
+		zap.String("channel", channel.String()),
+		zap.String("event.id", e.ID()),
+		zap.String("event.type", e.Type()),
+		zap.String("event.source", e.Source()),
+	}, fields...)
+	if subscriber != "" {
+		fields = append(fields, zap.String("subscription", string(subscriber)))
+	}
+	a.logger.Info("audit", fields...)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	eventingchannels "knative.dev/eventing/pkg/channel"
+)
+
+func newAuditEvent(id string) *event.Event {
+	e := event.New()
+	e.SetID(id)
+	e.SetType("dev.knative.test")
+	e.SetSource("test")
+	return &e
+}
+
+func TestAuditSample(t *testing.T) {
+	a := newAuditLogger(zap.NewNop())
+	e := newAuditEvent("1")
+	if got := a.sample(e); got != nil {
+		t.Error("events are sampled while the audit log is disabled")
+	}
+
+	a.update(true, 1)
+	if got := a.sample(e); got != e {
+		t.Error("event isn't sampled with a sample rate of 1")
+	}
+	if got := a.sample(nil); got != nil {
+		t.Error("unexpected sample of a nil event")
+	}
+
+	a.update(true, 0.5)
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		e := newAuditEvent(fmt.Sprint(i))
+		first := a.sample(e) != nil
+		if second := a.sample(e) != nil; first != second {
+			t.Fatalf("the sampling of event %d isn't deterministic", i)
+		}
+		if first {
+			sampled++
+		}
+	}
+	if sampled < 400 || sampled > 600 {
+		t.Errorf("unexpected number of sampled events with a sample rate of 0.5, got %d out of 1000", sampled)
+	}
+}
+
+func TestAuditSampleData(t *testing.T) {
+	a := newAuditLogger(zap.NewNop())
+	a.update(true, 1)
+	data, err := json.Marshal(newAuditEvent("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := a.sampleData(data); got == nil || got.ID() != "1" {
+		t.Errorf("unexpected sample of a structured event, got %v", got)
+	}
+	if got := a.sampleData([]byte("not an event")); got != nil {
+		t.Errorf("unexpected sample of an invalid event, got %v", got)
+	}
+}
+
+func TestAuditRecord(t *testing.T) {
+	buf := new(bytes.Buffer)
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"}), zapcore.AddSync(buf), zap.InfoLevel)
+	a := newAuditLogger(zap.New(core))
+	channel := eventingchannels.ChannelReference{Namespace: "ns", Name: "channel"}
+
+	a.record(nil, auditAccepted, channel, "")
+	a.record(newAuditEvent("1"), auditDelivered, channel, "sub-uid", zap.Int("response_code", 202))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("unexpected number of audit records, want 1, got %d", len(lines))
+	}
+	got := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"msg":           "audit",
+		"hop":           auditDelivered,
+		"channel":       channel.String(),
+		"event.id":      "1",
+		"event.type":    "dev.knative.test",
+		"event.source":  "test",
+		"subscription":  "sub-uid",
+		"response_code": float64(202),
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("unexpected %s of the audit record, want %v, got %v", key, value, got[key])
+		}
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+	eventingchannels "knative.dev/eventing/pkg/channel"
+)
+
+var (
+	// circuitFailureThreshold is the number of consecutive deliveries a subscriber must fail for its circuit to open.
+	circuitFailureThreshold = 5
+	// circuitProbeInterval is how long the circuit of a subscriber stays open before a message is dispatched to probe
+	// whether the subscriber recovered.
+	circuitProbeInterval = 30 * time.Second
+
+	errCircuitBreakerStopped = errors.New("the subscriber unsubscribed while its circuit was open")
+)
+
+// subscriberUnavailable returns true if a dispatch failed because the subscriber is down or overloaded, rather than
+// because it rejected the message.
+func subscriberUnavailable(info *eventingchannels.DispatchExecutionInfo, err error) bool {
+	if err == nil {
+		return false
+	}
+	if info == nil {
+		return true
+	}
+	code := info.ResponseCode
+	return code == 0 || code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// circuitBreaker stops dispatching the messages of a subscription while its subscriber is unavailable. The circuit
+// opens after circuitFailureThreshold consecutive failed deliveries. While it's open the messages are held, and a
+// single one is dispatched every circuitProbeInterval, which closes the circuit once it's delivered.
+type circuitBreaker struct {
+	mux      sync.Mutex
+	failures int
+	// openUntil is when the next probe is dispatched, it's zero while the circuit is closed.
+	openUntil time.Time
+	probing   bool
+	// closed is closed when the circuit closes, releasing the held messages.
+	closed chan struct{}
+	// opened is closed when the circuit opens, it's replaced when the circuit closes.
+	opened chan struct{}
+	// changed is called when the circuit opens or closes.
+	changed func(open bool)
+	// stopped is closed once the subscriber unsubscribed, releasing the held messages.
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func newCircuitBreaker(changed func(open bool)) *circuitBreaker {
+	return &circuitBreaker{changed: changed, opened: make(chan struct{}), stopped: make(chan struct{})}
+}
+
+// dispatch dispatches a message through the circuit breaker. While the circuit is open, the message is held rather
+// than reported as failed, so that it stays in the stream instead of being redelivered or dead lettered, and
+// dispatched again once the circuit lets it through. progress is called while the message is held.
+func (b *circuitBreaker) dispatch(ctx context.Context, progress func(), dispatch func() (*eventingchannels.DispatchExecutionInfo, error)) (*eventingchannels.DispatchExecutionInfo, error) {
+	for {
+		if err := b.wait(ctx, progress); err != nil {
+			return nil, err
+		}
+		info, err := dispatch()
+		b.record(!subscriberUnavailable(info, err))
+		if err == nil || !b.isOpen() {
+			return info, err
+		}
+	}
+}
+
+// wait blocks until a message can be dispatched, either because the circuit is closed or as the next probe.
+func (b *circuitBreaker) wait(ctx context.Context, progress func()) error {
+	for {
+		b.mux.Lock()
+		if b.openUntil.IsZero() {
+			b.mux.Unlock()
+			return nil
+		}
+		delay := time.Until(b.openUntil)
+		if !b.probing && delay <= 0 {
+			b.probing = true
+			b.mux.Unlock()
+			return nil
+		}
+		if delay <= 0 {
+			// Wait for the outcome of the probe in flight.
+			delay = circuitProbeInterval
+		}
+		closed := b.closed
+		b.mux.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-closed:
+			timer.Stop()
+			return nil
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-b.stopped:
+			timer.Stop()
+			return errCircuitBreakerStopped
+		case <-timer.C:
+			if progress != nil {
+				progress()
+			}
+		}
+	}
+}
+
+// waitOpen blocks until the circuit is open.
+func (b *circuitBreaker) waitOpen(ctx context.Context) error {
+	b.mux.Lock()
+	opened := b.opened
+	b.mux.Unlock()
+	return b.waitFor(ctx, opened)
+}
+
+// waitClosed blocks until the circuit is closed. Unlike wait, it doesn't let probes through.
+func (b *circuitBreaker) waitClosed(ctx context.Context) error {
+	b.mux.Lock()
+	if b.openUntil.IsZero() {
+		b.mux.Unlock()
+		return nil
+	}
+	closed := b.closed
+	b.mux.Unlock()
+	return b.waitFor(ctx, closed)
+}
+
+func (b *circuitBreaker) waitFor(ctx context.Context, ch <-chan struct{}) error {
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.stopped:
+		return errCircuitBreakerStopped
+	}
+}
+
+// record records the outcome of a dispatch, opening or closing the circuit.
+func (b *circuitBreaker) record(success bool) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	open := !b.openUntil.IsZero()
+	if success {
+		b.failures = 0
+		if open {
+			b.openUntil, b.probing = time.Time{}, false
+			close(b.closed)
+			b.opened = make(chan struct{})
+			b.changed(false)
+		}
+		return
+	}
+
+	b.failures++
+	switch {
+	case open:
+		if b.probing {
+			b.openUntil, b.probing = time.Now().Add(circuitProbeInterval), false
+		}
+	case b.failures >= circuitFailureThreshold:
+		b.openUntil = time.Now().Add(circuitProbeInterval)
+		b.closed = make(chan struct{})
+		close(b.opened)
+		b.changed(true)
+	}
+}
+
+// stop releases the held messages without dispatching them.
+func (b *circuitBreaker) stop() {
+	b.stopOnce.Do(func() {
+		close(b.stopped)
+	})
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return !b.openUntil.IsZero()
+}
+
+// state returns why the circuit is open, or an empty string if it's closed.
+func (b *circuitBreaker) state() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.openUntil.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("circuit breaker open: the subscriber failed %d consecutive deliveries, probing it every %s", b.failures, circuitProbeInterval)
+}
+
+// circuitBreakers holds the circuit breakers of the subscribers of each channel. They're kept across resubscriptions,
+// so that a subscriber doesn't get all the held messages at once when the dispatcher reconnects.
+type circuitBreakers struct {
+	logger *zap.Logger
+	// changed is called when a circuit of the channel opens or closes.
+	changed func(channel eventingchannels.ChannelReference)
+
+	mux      sync.Mutex
+	breakers map[eventingchannels.ChannelReference]map[types.UID]*circuitBreaker
+}
+
+func newCircuitBreakers(logger *zap.Logger, changed func(channel eventingchannels.ChannelReference)) *circuitBreakers {
+	if changed == nil {
+		changed = func(eventingchannels.ChannelReference) {}
+	}
+	return &circuitBreakers{
+		logger:   logger,
+		changed:  changed,
+		breakers: make(map[eventingchannels.ChannelReference]map[types.UID]*circuitBreaker),
+	}
+}
+
+// get returns the circuit breaker of a subscriber, creating it if it has none yet.
+func (c *circuitBreakers) get(channel eventingchannels.ChannelReference, subscriber types.UID) *circuitBreaker {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	breakers, ok := c.breakers[channel]
+	if !ok {
+		breakers = make(map[types.UID]*circuitBreaker)
+		c.breakers[channel] = breakers
+	}
+	if b, ok := breakers[subscriber]; ok {
+		return b
+	}
+	b := newCircuitBreaker(func(open bool) {
+		if open {
+			c.logger.Warn("Subscriber unavailable, circuit breaker opened", zap.String("channel", channel.String()), zap.String("sub", string(subscriber)))
+		} else {
+			c.logger.Info("Subscriber recovered, circuit breaker closed", zap.String("channel", channel.String()), zap.String("sub", string(subscriber)))
+		}
+		go c.changed(channel)
+	})
+	breakers[subscriber] = b
+	return b
+}
+
+// forget drops the circuit breaker of a subscriber which unsubscribed, its held messages aren't dispatched.
+func (c *circuitBreakers) forget(channel eventingchannels.ChannelReference, subscriber types.UID) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if b, ok := c.breakers[channel][subscriber]; ok {
+		b.stop()
+	}
+	delete(c.breakers[channel], subscriber)
+	if len(c.breakers[channel]) == 0 {
+		delete(c.breakers, channel)
+	}
+}
+
+// open returns why the circuits of the subscribers of channel are open, for the ones which are.
+func (c *circuitBreakers) open(channel eventingchannels.ChannelReference) map[types.UID]string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	open := make(map[types.UID]string)
+	for uid, b := range c.breakers[channel] {
+		if state := b.state(); state != "" {
+			open[uid] = state
+		}
+	}
+	return open
+}
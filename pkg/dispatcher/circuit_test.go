@@ -0,0 +1,248 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	eventingchannels "knative.dev/eventing/pkg/channel"
+)
+
+func TestSubscriberUnavailable(t *testing.T) {
+	failure := errors.New("failure")
+	testCases := map[string]struct {
+		info *eventingchannels.DispatchExecutionInfo
+		err  error
+		want bool
+	}{
+		"delivered": {
+			info: &eventingchannels.DispatchExecutionInfo{ResponseCode: 202},
+		},
+		"no response": {
+			info: &eventingchannels.DispatchExecutionInfo{ResponseCode: 0},
+			err:  failure,
+			want: true,
+		},
+		"no execution info": {
+			err:  failure,
+			want: true,
+		},
+		"server error": {
+			info: &eventingchannels.DispatchExecutionInfo{ResponseCode: 503},
+			err:  failure,
+			want: true,
+		},
+		"too many requests": {
+			info: &eventingchannels.DispatchExecutionInfo{ResponseCode: 429},
+			err:  failure,
+			want: true,
+		},
+		"rejected": {
+			info: &eventingchannels.DispatchExecutionInfo{ResponseCode: 400},
+			err:  failure,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if got := subscriberUnavailable(tc.info, tc.err); got != tc.want {
+				t.Errorf("subscriberUnavailable() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	defer func(threshold int, interval time.Duration) {
+		circuitFailureThreshold, circuitProbeInterval = threshold, interval
+	}(circuitFailureThreshold, circuitProbeInterval)
+	circuitFailureThreshold, circuitProbeInterval = 3, 20*time.Millisecond
+
+	var changes []bool
+	b := newCircuitBreaker(func(open bool) {
+		changes = append(changes, open)
+	})
+
+	var down int32 = 1
+	var attempts int32
+	dispatch := func() (*eventingchannels.DispatchExecutionInfo, error) {
+		atomic.AddInt32(&attempts, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			return &eventingchannels.DispatchExecutionInfo{ResponseCode: 503}, errors.New("unavailable")
+		}
+		return &eventingchannels.DispatchExecutionInfo{ResponseCode: 202}, nil
+	}
+
+	// The failures below the threshold are reported.
+	for i := 0; i < circuitFailureThreshold-1; i++ {
+		if _, err := b.dispatch(context.Background(), nil, dispatch); err == nil {
+			t.Fatal("dispatch() succeeded while the subscriber is down")
+		}
+	}
+	if b.isOpen() {
+		t.Fatal("circuit opened below the failure threshold")
+	}
+
+	// The failure reaching the threshold opens the circuit, and the message is held until the subscriber recovers.
+	var progress int32
+	done := make(chan error)
+	go func() {
+		_, err := b.dispatch(context.Background(), func() { atomic.AddInt32(&progress, 1) }, dispatch)
+		done <- err
+	}()
+	time.Sleep(5 * circuitProbeInterval)
+	if !b.isOpen() {
+		t.Fatal("circuit didn't open at the failure threshold")
+	}
+	if b.state() == "" {
+		t.Error("state() of an open circuit is empty")
+	}
+	if got := atomic.LoadInt32(&attempts); got <= int32(circuitFailureThreshold) {
+		t.Errorf("%d attempts, want the subscriber to be probed", got)
+	}
+	if atomic.LoadInt32(&progress) == 0 {
+		t.Error("progress wasn't reported while the message was held")
+	}
+
+	atomic.StoreInt32(&down, 0)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("dispatch() = %v once the subscriber recovered", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the held message wasn't dispatched once the subscriber recovered")
+	}
+	if b.isOpen() || b.state() != "" {
+		t.Error("circuit didn't close once the subscriber recovered")
+	}
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("changes = %v, want [true false]", changes)
+	}
+}
+
+func TestCircuitBreakerWaitOpenClosed(t *testing.T) {
+	defer func(threshold int, interval time.Duration) {
+		circuitFailureThreshold, circuitProbeInterval = threshold, interval
+	}(circuitFailureThreshold, circuitProbeInterval)
+	circuitFailureThreshold, circuitProbeInterval = 1, time.Hour
+
+	b := newCircuitBreaker(func(bool) {})
+	if err := b.waitClosed(context.Background()); err != nil {
+		t.Fatalf("waitClosed() = %v while the circuit is closed", err)
+	}
+
+	opened := make(chan error)
+	go func() { opened <- b.waitOpen(context.Background()) }()
+	select {
+	case <-opened:
+		t.Fatal("waitOpen() returned while the circuit is closed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	b.record(false)
+	select {
+	case err := <-opened:
+		if err != nil {
+			t.Errorf("waitOpen() = %v once the circuit opened", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitOpen() didn't return once the circuit opened")
+	}
+
+	closed := make(chan error)
+	go func() { closed <- b.waitClosed(context.Background()) }()
+	select {
+	case <-closed:
+		t.Fatal("waitClosed() returned while the circuit is open")
+	case <-time.After(10 * time.Millisecond):
+	}
+	b.record(true)
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("waitClosed() = %v once the circuit closed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitClosed() didn't return once the circuit closed")
+	}
+
+	// The circuit can open again once closed.
+	go func() { opened <- b.waitOpen(context.Background()) }()
+	b.stop()
+	select {
+	case err := <-opened:
+		if !errors.Is(err, errCircuitBreakerStopped) {
+			t.Errorf("waitOpen() = %v, want %v", err, errCircuitBreakerStopped)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitOpen() didn't return once the circuit breaker stopped")
+	}
+}
+
+func TestCircuitBreakersForget(t *testing.T) {
+	defer func(threshold int, interval time.Duration) {
+		circuitFailureThreshold, circuitProbeInterval = threshold, interval
+	}(circuitFailureThreshold, circuitProbeInterval)
+	circuitFailureThreshold, circuitProbeInterval = 1, time.Hour
+
+	channel := eventingchannels.ChannelReference{Namespace: "ns", Name: "channel"}
+	changed := make(chan eventingchannels.ChannelReference, 1)
+	breakers := newCircuitBreakers(zap.NewNop(), func(c eventingchannels.ChannelReference) {
+		changed <- c
+	})
+	b := breakers.get(channel, "sub")
+	if breakers.get(channel, "sub") != b {
+		t.Fatal("get() returned another circuit breaker for the same subscriber")
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := b.dispatch(context.Background(), nil, func() (*eventingchannels.DispatchExecutionInfo, error) {
+			return nil, errors.New("unavailable")
+		})
+		done <- err
+	}()
+	select {
+	case c := <-changed:
+		if c != channel {
+			t.Errorf("changed channel = %v, want %v", c, channel)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the circuit didn't open")
+	}
+	if _, ok := breakers.open(channel)["sub"]; !ok {
+		t.Error("open() doesn't report the open circuit")
+	}
+
+	breakers.forget(channel, "sub")
+	select {
+	case err := <-done:
+		if !errors.Is(err, errCircuitBreakerStopped) {
+			t.Errorf("dispatch() = %v, want %v", err, errCircuitBreakerStopped)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the held message wasn't released")
+	}
+	if len(breakers.open(channel)) != 0 {
+		t.Error("open() reports the circuit of a forgotten subscriber")
+	}
+}
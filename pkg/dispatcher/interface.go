@@ -3,6 +3,9 @@ package dispatcher
 import (
 	"context"
 
+	"knative.dev/eventing-natss/pkg/config"
+
+	"k8s.io/apimachinery/pkg/types"
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
 	messagingv1 "knative.dev/eventing/pkg/apis/messaging/v1"
 )
@@ -11,4 +14,32 @@ type NatsDispatcher interface {
 	Start(ctx context.Context) error
 	UpdateSubscriptions(ctx context.Context, name, ns string, subscriptions []eventingduckv1.SubscriberSpec, isFinalizer bool) (map[eventingduckv1.SubscriberSpec]error, error)
 	ProcessChannels(ctx context.Context, chanList []messagingv1.Channel) error
+	// UpdateConfig applies a new configuration of the connection to NATS.
+	UpdateConfig(ctx context.Context, natsConfig *config.NatsConfig)
+	// Ready returns an error explaining why the dispatcher can't accept events, if that's the case.
+	Ready(ctx context.Context) error
+	// UpdateRateLimits sets the rate limits of the subscribers of the given channel, by subscription UID. The
+	// subscribers without a rate limit get the events as fast as they're handled.
+	UpdateRateLimits(name, ns string, limits map[types.UID]RateLimit)
+}
+
+// JetStreamDispatcher is a NatsDispatcher which also takes the configuration of each channel into account.
+type JetStreamDispatcher interface {
+	NatsDispatcher
+	// UpdateChannelConfig sets the configuration used to dispatch the events of the given channel.
+	UpdateChannelConfig(name, ns string, config ChannelConfig)
+	// UpdateSubscriberConfigs sets the configurations of the subscribers of the given channel, by subscription UID.
+	// The subscribers without one get the default configuration.
+	UpdateSubscriberConfigs(name, ns string, configs map[types.UID]SubscriberConfig)
+	// ConnectionStates returns the state of the connections to NATS JetStream, by connection profile.
+	ConnectionStates() map[string]ConnectionState
+	// StreamExists returns whether the stream of the given channel exists. An error is returned when it can't be
+	// told, because the servers of the channel can't be reached for instance.
+	StreamExists(name, ns string) (bool, error)
+	// OpenCircuits returns why the circuit breakers of the subscribers of the given channel are open, by
+	// subscription UID, for the subscribers whose circuit is open.
+	OpenCircuits(name, ns string) map[types.UID]string
+	// ConsumerStates returns the last known states of the JetStream consumers of the subscribers of the given
+	// channel, by subscription UID. They're refreshed periodically.
+	ConsumerStates(name, ns string) map[types.UID]ConsumerState
 }
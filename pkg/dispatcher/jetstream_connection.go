@@ -0,0 +1,269 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing-natss/pkg/natsutil"
+)
+
+// ConnectionState is the state of a connection of the dispatcher to NATS.
+type ConnectionState string
+
+const (
+	// ConnectionStateConnecting means that the connection is being established, for the first time or anew
+	// after it was closed.
+	ConnectionStateConnecting ConnectionState = "Connecting"
+
+	// ConnectionStateConnected means that the connection is established.
+	ConnectionStateConnected ConnectionState = "Connected"
+
+	// ConnectionStateReconnecting means that the connection was lost, and the client is re-establishing it.
+	// Subscriptions are restored by the client once it's reconnected.
+	ConnectionStateReconnecting ConnectionState = "Reconnecting"
+)
+
+// jetConnection is the connection of the dispatcher to the NATS JetStream servers of a connection profile. Lost
+// connections are re-established by the client, connections the client gave up on are replaced by new ones, as
+// well as connections whose configuration files changed, until the jetConnection is closed.
+type jetConnection struct {
+	logger  *zap.Logger
+	profile natsutil.ConnectionProfile
+	// onConnect is called every time a new connection is established, but not when the client reconnects.
+	onConnect func(ctx context.Context)
+
+	// mux protects the fields below, during the transitions between the connection states.
+	mux sync.Mutex
+	// ctx is done once the jetConnection is closed.
+	ctx        context.Context
+	cancel     context.CancelFunc
+	conn       *nats.Conn
+	connState  ConnectionState
+	inProgress bool
+	// js is the JetStream context of conn the events sent to the channels are published on, shared by their
+	// senders. It's created on first use, and dropped together with conn.
+	js nats.JetStreamContext
+	// lostAcks is the number of publishes on js which gave up waiting for their ack.
+	lostAcks int
+}
+
+// maxLostAcks is the number of publishes on a JetStream context which may give up waiting for their ack before
+// the context is replaced. The context keeps waiting for these acks forever, so they would eventually stall every
+// publish once they add up to its maximum pending publishes. The reply subscription of a replaced context is only
+// dropped together with its connection, so contexts are replaced as rarely as possible.
+const maxLostAcks = natsutil.MaxPending / 2
+
+func newJetConnection(name string, profile natsutil.ConnectionProfile, logger *zap.Logger, onConnect func(ctx context.Context)) *jetConnection {
+	return &jetConnection{
+		logger:    logger.With(zap.String("profile", name)),
+		profile:   profile,
+		onConnect: onConnect,
+		connState: ConnectionStateConnecting,
+	}
+}
+
+// start connects to NATS JetStream, and keeps the connection up until ctx is done or the connection is closed.
+func (c *jetConnection) start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	c.mux.Lock()
+	c.ctx, c.cancel = ctx, cancel
+	c.mux.Unlock()
+
+	c.connectAsync()
+	// Reconnect with the new credentials and certificates whenever they're rotated
+	go natsutil.WatchConnectionConfig(ctx, c.profile.ConnectionConfig, connectionConfigWatchInterval, c.reconnect)
+}
+
+// close closes the connection for good.
+func (c *jetConnection) close() {
+	c.mux.Lock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	currentNatsConn := c.conn
+	c.conn = nil
+	c.js, c.lostAcks = nil, 0
+	c.mux.Unlock()
+	if currentNatsConn != nil {
+		currentNatsConn.Close()
+	}
+}
+
+// current returns the connection, if it's established.
+func (c *jetConnection) current() (*nats.Conn, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.conn == nil {
+		return nil, errors.New("no Connection to NATS JetStream")
+	}
+	return c.conn, nil
+}
+
+// publisher returns the JetStream context the events sent to the channels are published on, if the connection
+// is established.
+func (c *jetConnection) publisher() (nats.JetStreamContext, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.conn == nil {
+		return nil, errors.New("no Connection to NATS JetStream")
+	}
+	if c.js == nil {
+		js, err := c.conn.JetStream(nats.PublishAsyncMaxPending(natsutil.MaxPending))
+		if err != nil {
+			return nil, err
+		}
+		c.js = js
+	}
+	return c.js, nil
+}
+
+// ackLost records that a publish on js gave up waiting for its ack, and replaces js once too many did.
+func (c *jetConnection) ackLost(js nats.JetStreamContext) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.js != js {
+		return
+	}
+	c.lostAcks++
+	if c.lostAcks >= maxLostAcks {
+		c.logger.Warn("Too many publishes gave up waiting for their ack, replacing the JetStream context", zap.Int("lostAcks", c.lostAcks))
+		c.js, c.lostAcks = nil, 0
+	}
+}
+
+// state returns the state of the connection.
+func (c *jetConnection) state() ConnectionState {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.connState
+}
+
+// reconnect replaces the connection to NATS JetStream, for instance because the credentials it was established
+// with have been rotated.
+func (c *jetConnection) reconnect() {
+	c.logger.Info("NATS JetStream connection configuration changed, reconnecting")
+	c.replace(nil)
+}
+
+// replace drops nc, or the current connection if nc is nil, and establishes a new one. Connections which were
+// replaced already are ignored.
+func (c *jetConnection) replace(nc *nats.Conn) {
+	c.mux.Lock()
+	currentNatsConn := c.conn
+	if currentNatsConn == nil || (nc != nil && nc != currentNatsConn) {
+		c.mux.Unlock()
+		return
+	}
+	c.conn = nil
+	c.js, c.lostAcks = nil, 0
+	c.connState = ConnectionStateConnecting
+	c.mux.Unlock()
+
+	// The closed handler ignores the connection, since it's not the current one anymore.
+	currentNatsConn.Close()
+	c.connectAsync()
+}
+
+// connectAsync establishes a new connection in the background, unless that's in progress already.
+func (c *jetConnection) connectAsync() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.inProgress || c.ctx == nil || c.ctx.Err() != nil {
+		return
+	}
+	c.inProgress = true
+	go c.connectWithRetry(c.ctx)
+}
+
+func (c *jetConnection) connectWithRetry(ctx context.Context) {
+	// re-attempting evey 1 second until the connection is established.
+	ticker := time.NewTicker(jetRetryInterval)
+	defer ticker.Stop()
+	for {
+		nConn, err := natsutil.JetStreamConnect(c.profile.URL, c.profile.ConnectionConfig, c.logger.Sugar(), c.options()...)
+		if err == nil {
+			// Locking here in order to reduce time in locked state.
+			c.mux.Lock()
+			if ctx.Err() != nil {
+				// The connection was closed in the meantime.
+				c.mux.Unlock()
+				nConn.Close()
+				return
+			}
+			c.conn = nConn
+			c.connState = ConnectionStateConnected
+			c.inProgress = false
+			c.mux.Unlock()
+			c.onConnect(ctx)
+			return
+		}
+		c.logger.Sugar().Errorf("Connect() failed with error: %+v, retrying in %s", err, jetRetryInterval.String())
+		select {
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// options returns the options handling the lifecycle of the connections. The client reconnects on its own,
+// restoring the subscriptions of the connection and buffering the messages published in the meantime, so only
+// connections it gives up on need to be replaced.
+func (c *jetConnection) options() []nats.Option {
+	return []nats.Option{
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(jetRetryInterval),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			if c.setState(nc, ConnectionStateReconnecting) {
+				c.logger.Warn("Disconnected from NATS JetStream, reconnecting", zap.Error(err))
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			if c.setState(nc, ConnectionStateConnected) {
+				c.logger.Info("Reconnected to NATS JetStream", zap.String("url", nc.ConnectedUrl()))
+			}
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			c.mux.Lock()
+			current := c.conn == nc
+			c.mux.Unlock()
+			if current {
+				c.logger.Warn("NATS JetStream connection closed, connecting anew", zap.Error(nc.LastError()))
+				c.replace(nc)
+			}
+		}),
+	}
+}
+
+// setState sets the state of the connection, if nc is the current connection, and returns whether it did.
+func (c *jetConnection) setState(nc *nats.Conn, state ConnectionState) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.conn != nc {
+		return false
+	}
+	c.connState = state
+	return true
+}
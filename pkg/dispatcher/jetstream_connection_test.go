@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing-natss/pkg/natsutil"
+)
+
+func TestJetConnectionState(t *testing.T) {
+	c := newJetConnection("eu-west", natsutil.ConnectionProfile{URL: "nats://127.0.0.1:1"}, zap.NewNop(), func(context.Context) {})
+	if got := c.state(); got != ConnectionStateConnecting {
+		t.Errorf("state() = %q, want %q", got, ConnectionStateConnecting)
+	}
+	if _, err := c.current(); err == nil {
+		t.Error("current() expected an error before connecting")
+	}
+
+	// The handlers of connections which were replaced don't affect the state.
+	current, stale := &nats.Conn{}, &nats.Conn{}
+	c.conn = current
+	if c.setState(stale, ConnectionStateReconnecting) {
+		t.Error("setState() = true for a stale connection, want false")
+	}
+	if !c.setState(current, ConnectionStateConnected) {
+		t.Error("setState() = false for the current connection, want true")
+	}
+	if got := c.state(); got != ConnectionStateConnected {
+		t.Errorf("state() = %q, want %q", got, ConnectionStateConnected)
+	}
+	// Connections which were closed, or never started, stay disconnected.
+	c.conn = nil
+	c.close()
+	c.connectAsync()
+	if c.inProgress {
+		t.Error("connectAsync() started connecting a closed connection")
+	}
+}
+
+func TestJetConnectionPublisher(t *testing.T) {
+	c := newJetConnection("eu-west", natsutil.ConnectionProfile{URL: "nats://127.0.0.1:1"}, zap.NewNop(), func(context.Context) {})
+	if _, err := c.publisher(); err == nil {
+		t.Error("publisher() expected an error before connecting")
+	}
+
+	c.conn = &nats.Conn{}
+	js, err := c.publisher()
+	if err != nil {
+		t.Fatalf("publisher() unexpected error: %v", err)
+	}
+	if got, _ := c.publisher(); got != js {
+		t.Error("publisher() created a new JetStream context for the same connection")
+	}
+
+	// The JetStream context is only replaced once too many publishes gave up waiting for their ack.
+	for i := 0; i < maxLostAcks-1; i++ {
+		c.ackLost(js)
+	}
+	if got, _ := c.publisher(); got != js {
+		t.Error("publisher() replaced the JetStream context before too many acks were lost")
+	}
+	c.ackLost(js)
+	replaced, _ := c.publisher()
+	if replaced == js {
+		t.Error("publisher() kept the JetStream context after too many acks were lost")
+	}
+	// Acks lost on a replaced context don't count.
+	for i := 0; i < maxLostAcks; i++ {
+		c.ackLost(js)
+	}
+	if got, _ := c.publisher(); got != replaced {
+		t.Error("publisher() replaced the JetStream context because of the acks lost on a previous one")
+	}
+}
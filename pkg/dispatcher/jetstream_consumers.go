@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"k8s.io/apimachinery/pkg/types"
+	eventingchannels "knative.dev/eventing/pkg/channel"
+)
+
+// ConsumerState is the state of the JetStream consumer of a subscriber, which tells how far behind the stream the
+// subscriber is.
+type ConsumerState struct {
+	// Pending is the number of events of the stream which weren't delivered yet.
+	Pending uint64
+	// AckPending is the number of delivered events which weren't acknowledged yet.
+	AckPending int
+	// Redelivered is the number of events delivered more than once which weren't acknowledged yet.
+	Redelivered int
+	// LastDeliveredSequence is the stream sequence of the last delivered event.
+	LastDeliveredSequence uint64
+}
+
+// consumerStatusInterval is the minimum interval between two reports of the changes of the consumers of a channel
+// which only tell how far behind the stream the subscribers are.
+var consumerStatusInterval = time.Minute
+
+// caughtUp returns true if all the events of the stream were delivered to the subscriber and acknowledged.
+func (s ConsumerState) caughtUp() bool {
+	return s.Pending == 0 && s.AckPending == 0
+}
+
+func consumerStateFromInfo(info *nats.ConsumerInfo) ConsumerState {
+	return ConsumerState{
+		Pending:               info.NumPending,
+		AckPending:            info.NumAckPending,
+		Redelivered:           info.NumRedelivered,
+		LastDeliveredSequence: info.Delivered.Stream,
+	}
+}
+
+// consumerStates holds the last known state of the consumers of the subscribers of each channel.
+type consumerStates struct {
+	// changed is called when the state of a consumer of the channel changed. The changes of how far behind the
+	// stream the subscribers are, are only reported every consumerStatusInterval.
+	changed func(channel eventingchannels.ChannelReference)
+
+	mux    sync.RWMutex
+	states map[eventingchannels.ChannelReference]map[types.UID]ConsumerState
+	// reported holds the states of the consumers of each channel when they were last reported, and when.
+	reported map[eventingchannels.ChannelReference]reportedConsumerStates
+}
+
+type reportedConsumerStates struct {
+	states map[types.UID]ConsumerState
+	at     time.Time
+}
+
+func newConsumerStates(changed func(channel eventingchannels.ChannelReference)) *consumerStates {
+	if changed == nil {
+		changed = func(eventingchannels.ChannelReference) {}
+	}
+	return &consumerStates{
+		changed:  changed,
+		states:   make(map[eventingchannels.ChannelReference]map[types.UID]ConsumerState),
+		reported: make(map[eventingchannels.ChannelReference]reportedConsumerStates),
+	}
+}
+
+// update replaces the states of all the consumers. The channels which aren't in states have no consumers anymore.
+func (c *consumerStates) update(states map[eventingchannels.ChannelReference]map[types.UID]ConsumerState) {
+	now := time.Now()
+	c.mux.Lock()
+	var changed []eventingchannels.ChannelReference
+	for channel, consumers := range states {
+		reported, ok := c.reported[channel]
+		if ok && reflect.DeepEqual(reported.states, consumers) {
+			continue
+		}
+		if !ok || settledChanged(reported.states, consumers) || now.Sub(reported.at) >= consumerStatusInterval {
+			c.reported[channel] = reportedConsumerStates{states: consumers, at: now}
+			changed = append(changed, channel)
+		}
+	}
+	for channel := range c.reported {
+		if _, ok := states[channel]; !ok {
+			delete(c.reported, channel)
+		}
+	}
+	c.states = states
+	c.mux.Unlock()
+
+	for _, channel := range changed {
+		c.changed(channel)
+	}
+}
+
+// settledChanged returns true if consumers were added or removed, or if a subscriber caught up with the stream,
+// fell behind, or started or stopped getting redeliveries.
+func settledChanged(before, after map[types.UID]ConsumerState) bool {
+	if len(before) != len(after) {
+		return true
+	}
+	for uid, state := range after {
+		previous, ok := before[uid]
+		if !ok || previous.caughtUp() != state.caughtUp() || (previous.Redelivered > 0) != (state.Redelivered > 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the states of the consumers of the subscribers of channel, by subscription UID.
+func (c *consumerStates) get(channel eventingchannels.ChannelReference) map[types.UID]ConsumerState {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	states := make(map[types.UID]ConsumerState, len(c.states[channel]))
+	for uid, state := range c.states[channel] {
+		states[uid] = state
+	}
+	return states
+}
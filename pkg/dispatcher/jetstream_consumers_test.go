@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nats-io/nats.go"
+	"k8s.io/apimachinery/pkg/types"
+	eventingchannels "knative.dev/eventing/pkg/channel"
+)
+
+func TestConsumerStateFromInfo(t *testing.T) {
+	info := &nats.ConsumerInfo{
+		Delivered:      nats.SequencePair{Consumer: 7, Stream: 42},
+		NumAckPending:  2,
+		NumRedelivered: 1,
+		NumPending:     10,
+	}
+	want := ConsumerState{Pending: 10, AckPending: 2, Redelivered: 1, LastDeliveredSequence: 42}
+	if diff := cmp.Diff(want, consumerStateFromInfo(info)); diff != "" {
+		t.Error("unexpected consumer state (-want, +got):", diff)
+	}
+}
+
+// TestConsumerStatesUpdate checks that only the channels whose consumers changed are reported, and that the changes
+// of the lag of the subscribers are throttled.
+func TestConsumerStatesUpdate(t *testing.T) {
+	defer func(interval time.Duration) { consumerStatusInterval = interval }(consumerStatusInterval)
+	consumerStatusInterval = 20 * time.Millisecond
+
+	first := eventingchannels.ChannelReference{Namespace: "ns", Name: "first"}
+	second := eventingchannels.ChannelReference{Namespace: "ns", Name: "second"}
+
+	var changed []eventingchannels.ChannelReference
+	states := newConsumerStates(func(channel eventingchannels.ChannelReference) {
+		changed = append(changed, channel)
+	})
+
+	steps := []struct {
+		name        string
+		states      map[eventingchannels.ChannelReference]map[types.UID]ConsumerState
+		wait        time.Duration
+		wantChanged []eventingchannels.ChannelReference
+	}{{
+		name: "new consumers",
+		states: map[eventingchannels.ChannelReference]map[types.UID]ConsumerState{
+			first: {"sub": {Pending: 1}},
+		},
+		wantChanged: []eventingchannels.ChannelReference{first},
+	}, {
+		name: "unchanged consumers",
+		states: map[eventingchannels.ChannelReference]map[types.UID]ConsumerState{
+			first:  {"sub": {Pending: 1}},
+			second: {},
+		},
+		wantChanged: []eventingchannels.ChannelReference{second},
+	}, {
+		name: "consumer falling further behind",
+		states: map[eventingchannels.ChannelReference]map[types.UID]ConsumerState{
+			first:  {"sub": {Pending: 5}},
+			second: {},
+		},
+	}, {
+		name: "lag reported once the interval is over",
+		states: map[eventingchannels.ChannelReference]map[types.UID]ConsumerState{
+			first:  {"sub": {Pending: 5}},
+			second: {},
+		},
+		wait:        2 * consumerStatusInterval,
+		wantChanged: []eventingchannels.ChannelReference{first},
+	}, {
+		name: "consumer redelivering",
+		states: map[eventingchannels.ChannelReference]map[types.UID]ConsumerState{
+			first:  {"sub": {Pending: 4, AckPending: 1, Redelivered: 1}},
+			second: {},
+		},
+		wantChanged: []eventingchannels.ChannelReference{first},
+	}, {
+		name: "consumer caught up",
+		states: map[eventingchannels.ChannelReference]map[types.UID]ConsumerState{
+			first:  {"sub": {Pending: 0}},
+			second: {},
+		},
+		wantChanged: []eventingchannels.ChannelReference{first},
+	}, {
+		name: "consumer added",
+		states: map[eventingchannels.ChannelReference]map[types.UID]ConsumerState{
+			first:  {"sub": {Pending: 0}},
+			second: {"sub": {Pending: 3}},
+		},
+		wantChanged: []eventingchannels.ChannelReference{second},
+	}}
+
+	for _, step := range steps {
+		changed = nil
+		time.Sleep(step.wait)
+		states.update(step.states)
+		if diff := cmp.Diff(step.wantChanged, changed); diff != "" {
+			t.Errorf("%s: unexpected changed channels (-want, +got): %s", step.name, diff)
+		}
+	}
+
+	if diff := cmp.Diff(map[types.UID]ConsumerState{"sub": {Pending: 0}}, states.get(first)); diff != "" {
+		t.Error("unexpected consumer states (-want, +got):", diff)
+	}
+	if got := states.get(eventingchannels.ChannelReference{Namespace: "ns", Name: "unknown"}); len(got) != 0 {
+		t.Errorf("expected no consumer states, got %v", got)
+	}
+}
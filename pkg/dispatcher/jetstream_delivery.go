@@ -0,0 +1,117 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/nats-io/nats.go"
+
+	eventingchannels "knative.dev/eventing/pkg/channel"
+	"knative.dev/eventing/pkg/channel/attributes"
+	"knative.dev/eventing/pkg/kncloudevents"
+)
+
+const (
+	// Headers describing the failure of the events republished to the dead letter subject of a channel.
+	deadLetterSubscriptionHeader = "Knative-Subscription"
+	deadLetterSubscriberHeader   = "Knative-Subscriber"
+	deadLetterSequenceHeader     = "Knative-Stream-Sequence"
+	deadLetterAttemptsHeader     = "Knative-Delivery-Attempts"
+	deadLetterErrorCodeHeader    = "Knative-Error-Code"
+	deadLetterErrorDataHeader    = "Knative-Error-Data"
+	deadLetterErrorHeader        = "Knative-Error"
+)
+
+// maxDeliver returns how many times JetStream delivers a message to the subscriber, that is the first
+// delivery plus the retries configured in its DeliverySpec.
+func maxDeliver(subscription subscriptionReference) int {
+	if subscription.Delivery != nil && subscription.Delivery.Retry != nil && *subscription.Delivery.Retry > 0 {
+		return int(*subscription.Delivery.Retry) + 1
+	}
+	return 1
+}
+
+// singleDeliveryConfig returns a copy of retryConfig which doesn't retry, since retries are redeliveries
+// of the message by JetStream.
+func singleDeliveryConfig(retryConfig *kncloudevents.RetryConfig) *kncloudevents.RetryConfig {
+	c := *retryConfig
+	c.RetryMax = 0
+	return &c
+}
+
+// redeliveryDelay returns how long JetStream should wait before redelivering a message which has been
+// delivered numDelivered times, according to the backoff configured in the DeliverySpec.
+func redeliveryDelay(retryConfig *kncloudevents.RetryConfig, numDelivered uint64) time.Duration {
+	return retryConfig.Backoff(int(numDelivered), nil)
+}
+
+// deadLetterTransformers adds the knative error extensions describing the last failed delivery to
+// messages sent to a dead letter sink.
+func deadLetterTransformers(executionInfo *eventingchannels.DispatchExecutionInfo) binding.Transformers {
+	if executionInfo == nil {
+		return nil
+	}
+	return attributes.KnativeErrorTransformers(executionInfo.ResponseCode, stripControlCharacters(string(executionInfo.ResponseBody)))
+}
+
+// newDeadLetterMsg returns the message published to subject for msg, which couldn't be delivered to subscription.
+// The data and headers of msg are kept as they are, so that the event can be replayed by publishing it to the
+// channel again, and headers describing the last failed delivery are added.
+func newDeadLetterMsg(subject string, msg *nats.Msg, meta *nats.MsgMetadata, subscription subscriptionReference, executionInfo *eventingchannels.DispatchExecutionInfo, dispatchErr error) *nats.Msg {
+	dlqMsg := nats.NewMsg(subject)
+	dlqMsg.Data = msg.Data
+	for k, v := range msg.Header {
+		dlqMsg.Header[k] = append([]string(nil), v...)
+	}
+
+	// The subscription and the sequence identify the failure, so the message is published once even if it's redelivered.
+	dlqMsg.Header.Set(nats.MsgIdHdr, fmt.Sprintf("%s-%d", subscription.UID, meta.Sequence.Stream))
+	dlqMsg.Header.Set(deadLetterSubscriptionHeader, string(subscription.UID))
+	if !subscription.SubscriberURI.IsEmpty() {
+		dlqMsg.Header.Set(deadLetterSubscriberHeader, subscription.SubscriberURI.String())
+	}
+	dlqMsg.Header.Set(deadLetterSequenceHeader, strconv.FormatUint(meta.Sequence.Stream, 10))
+	dlqMsg.Header.Set(deadLetterAttemptsHeader, strconv.FormatUint(meta.NumDelivered, 10))
+	if executionInfo != nil {
+		if executionInfo.ResponseCode > 0 {
+			dlqMsg.Header.Set(deadLetterErrorCodeHeader, strconv.Itoa(executionInfo.ResponseCode))
+		}
+		if len(executionInfo.ResponseBody) > 0 {
+			dlqMsg.Header.Set(deadLetterErrorDataHeader, stripControlCharacters(string(executionInfo.ResponseBody)))
+		}
+	}
+	if dispatchErr != nil {
+		dlqMsg.Header.Set(deadLetterErrorHeader, stripControlCharacters(dispatchErr.Error()))
+	}
+	return dlqMsg
+}
+
+// stripControlCharacters removes the unprintable control characters, which are not allowed in header values.
+func stripControlCharacters(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nats-io/nats.go"
+	"k8s.io/utils/pointer"
+
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	eventingchannels "knative.dev/eventing/pkg/channel"
+	"knative.dev/pkg/apis"
+)
+
+func TestMaxDeliver(t *testing.T) {
+	testCases := map[string]struct {
+		delivery *eventingduckv1.DeliverySpec
+		want     int
+	}{
+		"no delivery": {
+			want: 1,
+		},
+		"no retry": {
+			delivery: &eventingduckv1.DeliverySpec{},
+			want:     1,
+		},
+		"retries": {
+			delivery: &eventingduckv1.DeliverySpec{Retry: pointer.Int32Ptr(4)},
+			want:     5,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if got := maxDeliver(subscriptionReference{Delivery: tc.delivery}); got != tc.want {
+				t.Errorf("maxDeliver() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRedeliveryDelay(t *testing.T) {
+	exponential := eventingduckv1.BackoffPolicyExponential
+	retryConfig, err := newRetryConfig(subscriptionReference{Delivery: &eventingduckv1.DeliverySpec{
+		Retry:         pointer.Int32Ptr(3),
+		BackoffPolicy: &exponential,
+		BackoffDelay:  pointer.StringPtr("PT1S"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveryConfig := singleDeliveryConfig(retryConfig)
+	if deliveryConfig.RetryMax != 0 {
+		t.Errorf("RetryMax = %d, want 0", deliveryConfig.RetryMax)
+	}
+	if retryConfig.RetryMax != 3 {
+		t.Errorf("singleDeliveryConfig() modified the original RetryMax = %d", retryConfig.RetryMax)
+	}
+
+	for numDelivered, want := range map[uint64]time.Duration{1: 2 * time.Second, 2: 4 * time.Second} {
+		if got := redeliveryDelay(retryConfig, numDelivered); got != want {
+			t.Errorf("redeliveryDelay(%d) = %v, want %v", numDelivered, got, want)
+		}
+	}
+}
+
+func TestNewDeadLetterMsg(t *testing.T) {
+	msg := nats.NewMsg("KN_DEFAULT_CH.events")
+	msg.Data = []byte(`{"specversion":"1.0","id":"1","source":"test","type":"test"}`)
+	msg.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	meta := &nats.MsgMetadata{Sequence: nats.SequencePair{Stream: 42}, NumDelivered: 3}
+	subscription := subscriptionReference{UID: "sub-uid", SubscriberURI: apis.HTTP("subscriber.default.svc.cluster.local")}
+	executionInfo := &eventingchannels.DispatchExecutionInfo{ResponseCode: http.StatusInternalServerError, ResponseBody: []byte("boom\n")}
+
+	got := newDeadLetterMsg("KNDLQ_DEFAULT_CH.events", msg, meta, subscription, executionInfo, errors.New("unexpected HTTP response, expected 2xx, got 500"))
+
+	if got.Subject != "KNDLQ_DEFAULT_CH.events" {
+		t.Errorf("Subject = %q, want %q", got.Subject, "KNDLQ_DEFAULT_CH.events")
+	}
+	if diff := cmp.Diff(msg.Data, got.Data); diff != "" {
+		t.Errorf("unexpected data (-want, +got) = %v", diff)
+	}
+	want := nats.Header{
+		"Traceparent":                []string{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+		nats.MsgIdHdr:                []string{"sub-uid-42"},
+		deadLetterSubscriptionHeader: []string{"sub-uid"},
+		deadLetterSubscriberHeader:   []string{"http://subscriber.default.svc.cluster.local"},
+		deadLetterSequenceHeader:     []string{"42"},
+		deadLetterAttemptsHeader:     []string{"3"},
+		deadLetterErrorCodeHeader:    []string{"500"},
+		deadLetterErrorDataHeader:    []string{"boom"},
+		deadLetterErrorHeader:        []string{"unexpected HTTP response, expected 2xx, got 500"},
+	}
+	if diff := cmp.Diff(want, got.Header); diff != "" {
+		t.Errorf("unexpected headers (-want, +got) = %v", diff)
+	}
+	if len(msg.Header) != 1 {
+		t.Errorf("newDeadLetterMsg() modified the headers of the original message: %v", msg.Header)
+	}
+}
+
+func TestConsumerConfigChanged(t *testing.T) {
+	want := nats.ConsumerConfig{
+		AckWait:       time.Minute,
+		MaxAckPending: 10,
+		MaxDeliver:    3,
+	}
+
+	testCases := map[string]struct {
+		got  nats.ConsumerConfig
+		want bool
+	}{
+		"same": {
+			got: nats.ConsumerConfig{
+				Durable:       "sub",
+				AckWait:       time.Minute,
+				MaxAckPending: 10,
+				MaxDeliver:    3,
+			},
+			want: false,
+		},
+		"ack wait": {
+			got:  nats.ConsumerConfig{AckWait: 2 * time.Minute, MaxAckPending: 10, MaxDeliver: 3},
+			want: true,
+		},
+		"max ack pending": {
+			got:  nats.ConsumerConfig{AckWait: time.Minute, MaxAckPending: 20, MaxDeliver: 3},
+			want: true,
+		},
+		"max deliver": {
+			got:  nats.ConsumerConfig{AckWait: time.Minute, MaxAckPending: 10, MaxDeliver: 1},
+			want: true,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if got := consumerConfigChanged(tc.got, want); got != tc.want {
+				t.Errorf("consumerConfigChanged() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConsumerModeChanged(t *testing.T) {
+	testCases := map[string]struct {
+		got  nats.ConsumerConfig
+		pull bool
+		want bool
+	}{
+		"push": {
+			got:  nats.ConsumerConfig{DeliverSubject: "deliver"},
+			want: false,
+		},
+		"pull": {
+			got:  nats.ConsumerConfig{},
+			pull: true,
+			want: false,
+		},
+		"push to pull": {
+			got:  nats.ConsumerConfig{DeliverSubject: "deliver"},
+			pull: true,
+			want: true,
+		},
+		"pull to push": {
+			got:  nats.ConsumerConfig{},
+			want: true,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if got := consumerModeChanged(tc.got, tc.pull); got != tc.want {
+				t.Errorf("consumerModeChanged() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
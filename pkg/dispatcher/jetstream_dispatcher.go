@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,81 +31,218 @@ import (
 	jsmcloudevents "github.com/cloudevents/sdk-go/protocol/nats_jetstream/v2"
 	"github.com/cloudevents/sdk-go/v2/binding"
 	"github.com/nats-io/nats.go"
-	"github.com/nats-io/stan.go"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
+	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
+	"knative.dev/eventing-natss/pkg/config"
 	"knative.dev/eventing-natss/pkg/natsutil"
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
 	messagingv1 "knative.dev/eventing/pkg/apis/messaging/v1"
 	eventingchannels "knative.dev/eventing/pkg/channel"
-)
-
-const (
-	// maxJetElements defines a maximum number of outstanding re-connect requests
-	maxJetElements = 10
+	"knative.dev/eventing/pkg/kncloudevents"
 )
 
 var (
 	// jetRetryInterval defines delay in seconds for the next attempt to reconnect to NATS JetStream server
 	jetRetryInterval = 1 * time.Second
+	// connectionConfigWatchInterval defines how often the files of the connection configuration are checked for changes
+	connectionConfigWatchInterval = 10 * time.Second
 )
 
-type JetSubscriptionChannelMapping map[eventingchannels.ChannelReference]map[types.UID]*nats.Subscription
+// jetSubscription is the subscription of a subscriber to a channel. The subscriber and the connection profile
+// of the channel are kept so that the subscription can be re-established on a new connection.
+type jetSubscription struct {
+	ref     subscriptionReference
+	profile string
+	// settings are the settings of the channel when the subscription was established.
+	settings dispatchSettings
+	// stop stops the goroutines fetching and handling the messages of the subscription, if any.
+	stop func()
+
+	// mux protects the NATS subscription, which is drained while the subscription is paused and replaced when
+	// it resumes.
+	mux    sync.Mutex
+	sub    natsSubscription
+	paused bool
+	// drained is true once the subscription was drained for good.
+	drained bool
+	// resubscribe subscribes to the consumer again, to resume the subscription.
+	resubscribe func() (natsSubscription, error)
+}
+
+// natsSubscription is the NATS subscription to the consumer of a subscriber.
+type natsSubscription interface {
+	Drain() error
+	ConsumerInfo() (*nats.ConsumerInfo, error)
+}
+
+// outdated returns true if the subscription was established for another version of the subscriber, or with other
+// settings of the channel.
+func (s *jetSubscription) outdated(subscriber subscriptionReference, settings dispatchSettings) bool {
+	return s.ref.changed(subscriber) || s.settings != settings
+}
+
+// drain drains the subscription, leaving its durable consumer in place, and stops its goroutines. The messages
+// which weren't handled yet are redelivered by JetStream.
+func (s *jetSubscription) drain() error {
+	if s.stop != nil {
+		defer s.stop()
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.drained = true
+	if s.paused {
+		// The NATS subscription was drained when the subscription was paused.
+		return nil
+	}
+	return s.sub.Drain()
+}
+
+// pause drains the NATS subscription, so that the consumer stops pushing messages, leaving the durable consumer in
+// place. The messages received already are still handled.
+func (s *jetSubscription) pause() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.paused || s.drained {
+		return nil
+	}
+	if err := s.sub.Drain(); err != nil {
+		return err
+	}
+	s.paused = true
+	return nil
+}
+
+// resume subscribes to the consumer of a paused subscription again.
+func (s *jetSubscription) resume() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.paused || s.drained {
+		return nil
+	}
+	sub, err := s.resubscribe()
+	if err != nil {
+		return err
+	}
+	s.sub, s.paused = sub, false
+	return nil
+}
+
+func (s *jetSubscription) consumerInfo() (*nats.ConsumerInfo, error) {
+	s.mux.Lock()
+	sub := s.sub
+	s.mux.Unlock()
+	return sub.ConsumerInfo()
+}
+
+type JetSubscriptionChannelMapping map[eventingchannels.ChannelReference]map[types.UID]*jetSubscription
 
 // jetSubscriptionsSupervisor manages the state of NATS Streaming subscriptions
 type jetSubscriptionsSupervisor struct {
 	logger *zap.Logger
 
+	ingress    *kncloudevents.HTTPMessageReceiver
 	receiver   *eventingchannels.MessageReceiver
 	dispatcher *eventingchannels.MessageDispatcherImpl
 
 	subscriptionsMux sync.Mutex
 	subscriptions    JetSubscriptionChannelMapping
+	rateLimiters     *rateLimiters
+	circuitBreakers  *circuitBreakers
+	consumers        *consumerStates
+	audit            *auditLogger
+	// connectionStateChanged is called when the dispatcher connects to or disconnects from the servers of a
+	// connection profile.
+	connectionStateChanged func(profile string)
+	// streamNotFound is called when an event sent to a channel is refused because its stream doesn't exist.
+	streamNotFound func(channel eventingchannels.ChannelReference)
+
+	// channelConfigsMux protects the configurations of the channels and of their subscribers.
+	channelConfigsMux sync.RWMutex
+	channelConfigs    map[eventingchannels.ChannelReference]ChannelConfig
+	subscriberConfigs map[eventingchannels.ChannelReference]map[types.UID]SubscriberConfig
+
+	// sendersMux protects the senders of the channels, which are kept for as long as their connection profile.
+	sendersMux sync.Mutex
+	senders    map[eventingchannels.ChannelReference]*jetSender
 
-	connect      chan struct{}
-	jetStreamURL string
+	// connection is the configuration of the connection to the default NATS JetStream servers.
+	connection natsutil.ConnectionConfig
+	// configMux protects the settings below, which are updated when the config-nats ConfigMap changes.
+	configMux      sync.RWMutex
+	ackWaitMinutes int
+	maxInflight    int
 
-	//ackWaitMinutes int
-	//maxInflight    int
-	// natConnMux is used to protect natsConn and natsConnInProgress during
-	// the transition from not connected to connected states.
-	natsConnMux        sync.Mutex
-	natsConn           *nats.Conn
-	natsConnInProgress bool
+	// connectionsMux protects the connection profiles, the connections to the profiles in use and ctx,
+	// which the connections are started with once the dispatcher is started.
+	connectionsMux sync.Mutex
+	profiles       map[string]natsutil.ConnectionProfile
+	connections    map[string]*jetConnection
+	ctx            context.Context
 
 	hostToChannelMap atomic.Value
 }
 
 type JetArgs struct {
-	JetStreamURL string
-	//ClusterID      string
-	//ClientID       string
-	//AckWaitMinutes int
-	//MaxInflight    int
+	JetStreamURL   string
+	Connection     natsutil.ConnectionConfig
+	AckWaitMinutes int
+	MaxInflight    int
 	//Cargs          kncloudevents.ConnectionArgs
 	Logger   *zap.Logger
 	Reporter eventingchannels.StatsReporter
+	// CircuitStateChanged is called when the circuit breaker of a subscriber of the channel opens or closes.
+	CircuitStateChanged func(channel eventingchannels.ChannelReference)
+	// ConsumerStateChanged is called when the state of the consumer of a subscriber of the channel changed. The
+	// changes of how far behind the stream the subscriber is are reported every minute at most.
+	ConsumerStateChanged func(channel eventingchannels.ChannelReference)
+	// ConnectionStateChanged is called when the dispatcher connects to or disconnects from the servers of a
+	// connection profile.
+	ConnectionStateChanged func(profile string)
+	// StreamNotFound is called when an event sent to the channel is refused because its stream doesn't exist.
+	StreamNotFound func(channel eventingchannels.ChannelReference)
 }
 
-var _ NatsDispatcher = (*jetSubscriptionsSupervisor)(nil)
+var _ JetStreamDispatcher = (*jetSubscriptionsSupervisor)(nil)
 
-// NewJetStreamDispatcher returns a new NatsDispatcher.
-func NewJetStreamDispatcher(args JetArgs) (NatsDispatcher, error) {
+// NewJetStreamDispatcher returns a new JetStreamDispatcher.
+func NewJetStreamDispatcher(args JetArgs) (JetStreamDispatcher, error) {
 	if args.Logger == nil {
 		args.Logger = zap.NewNop()
 	}
+	if args.ConnectionStateChanged == nil {
+		args.ConnectionStateChanged = func(string) {}
+	}
+	if args.StreamNotFound == nil {
+		args.StreamNotFound = func(eventingchannels.ChannelReference) {}
+	}
 
 	d := &jetSubscriptionsSupervisor{
-		logger:        args.Logger,
-		dispatcher:    eventingchannels.NewMessageDispatcher(args.Logger),
-		subscriptions: make(JetSubscriptionChannelMapping),
-		connect:       make(chan struct{}, maxJetElements),
-		jetStreamURL:  args.JetStreamURL,
-		//clusterID:      args.ClusterID,
-		//clientID:       args.ClientID,
-		//ackWaitMinutes: args.AckWaitMinutes,
-		//maxInflight:    args.MaxInflight,
+		logger:                 args.Logger,
+		ingress:                kncloudevents.NewHTTPMessageReceiver(ingressPort),
+		dispatcher:             eventingchannels.NewMessageDispatcher(args.Logger),
+		subscriptions:          make(JetSubscriptionChannelMapping),
+		rateLimiters:           newRateLimiters(),
+		circuitBreakers:        newCircuitBreakers(args.Logger, args.CircuitStateChanged),
+		consumers:              newConsumerStates(args.ConsumerStateChanged),
+		audit:                  newAuditLogger(args.Logger),
+		connectionStateChanged: args.ConnectionStateChanged,
+		streamNotFound:         args.StreamNotFound,
+		channelConfigs:         make(map[eventingchannels.ChannelReference]ChannelConfig),
+		subscriberConfigs:      make(map[eventingchannels.ChannelReference]map[types.UID]SubscriberConfig),
+		senders:                make(map[eventingchannels.ChannelReference]*jetSender),
+		connection:             args.Connection,
+		ackWaitMinutes:         args.AckWaitMinutes,
+		maxInflight:            args.MaxInflight,
+		profiles: map[string]natsutil.ConnectionProfile{
+			natsutil.DefaultConnectionProfile: {URL: args.JetStreamURL, ConnectionConfig: args.Connection},
+		},
+		connections: make(map[string]*jetConnection),
+	}
+	// The default servers are connected to right away, the others once a channel served by them shows up.
+	if _, err := d.getConnection(natsutil.DefaultConnectionProfile); err != nil {
+		return nil, err
 	}
 
 	receiver, err := eventingchannels.NewMessageReceiver(
@@ -120,95 +258,301 @@ func NewJetStreamDispatcher(args JetArgs) (NatsDispatcher, error) {
 	return d, nil
 }
 
-func (s *jetSubscriptionsSupervisor) signalReconnect() {
-	select {
-	case s.connect <- struct{}{}:
-		// Sent.
-	default:
-		// The Channel is already full, so a reconnection attempt will occur.
-	}
-}
-
 func jetmessageReceiverFunc(s *jetSubscriptionsSupervisor) eventingchannels.UnbufferedMessageReceiverFunc {
 	return func(ctx context.Context, channel eventingchannels.ChannelReference, message binding.Message, transformers []binding.Transformer, header http.Header) error {
-		s.logger.Info("Received event", zap.String("channel", channel.String()))
+		s.logger.Debug("Received event", zap.String("channel", channel.String()))
 
-		s.natsConnMux.Lock()
-		currentNatssConn := s.natsConn
-		s.natsConnMux.Unlock()
-		if currentNatssConn == nil {
-			s.logger.Error("no Connection to NATS JetStream")
-			return errors.New("no Connection to NATS JetStream")
+		profile := s.channelConfig(channel).ConnectionProfile
+		conn, err := s.getConnection(profile)
+		if err != nil {
+			s.logger.Error("no Connection to NATS JetStream", zap.String("profile", profile), zap.Error(err))
+			return err
 		}
-
-		sender, err := jsmcloudevents.NewSenderFromConn(currentNatssConn, natsutil.StreamName, getJetStreamSubject(channel), nil)
+		sender := s.getSender(channel, conn)
+		start := time.Now()
+		e, ack, err := publishEvent(ctx, sender, s.channelConfig(channel).MessageID, message, transformers...)
+		audited := s.audit.sample(e)
 		if err != nil {
-			s.logger.Error("could not create nats jetstream sender", zap.Error(err))
-			return errors.Wrap(err, "could not create nats jetstream sender")
-		}
-		if err := sender.Send(ctx, message); err != nil {
-			errMsg := "error during send"
-			if err.Error() == stan.ErrConnectionClosed.Error() {
-				errMsg += " - connection to NATSS has been lost, attempting to reconnect"
-				s.signalReconnect()
+			s.audit.record(audited, auditRejected, channel, "", zap.Error(err))
+			var limitErr *streamLimitExceededError
+			if errors.As(err, &limitErr) {
+				reportPublish(channel, publishResultStreamLimitExceeded, time.Since(start))
+				s.logger.Warn("stream rejected the event", zap.String("channel", channel.String()), zap.Error(err))
+				setIngressStatus(ctx, StatusStreamLimitExceeded)
+				return err
 			}
-			s.logger.Error(errMsg, zap.Error(err))
-			return errors.Wrap(err, errMsg)
+			var notFoundErr *streamNotFoundError
+			if errors.As(err, &notFoundErr) {
+				reportPublish(channel, publishResultError, time.Since(start))
+				s.logger.Warn("stream of the channel not found", zap.String("channel", channel.String()), zap.Error(err))
+				setIngressStatus(ctx, StatusStreamNotFound)
+				// The missing stream is reported in the status of the channel.
+				s.streamNotFound(channel)
+				return err
+			}
+			reportPublish(channel, publishResultError, time.Since(start))
+			// Lost connections are re-established by the connection handlers, there's nothing to do here.
+			s.logger.Error("error during send", zap.String("connectionState", string(conn.state())), zap.Error(err))
+			return errors.Wrap(err, "error during send")
+		}
+		s.audit.record(audited, auditAccepted, channel, "", zap.Uint64("stream_sequence", ack.Sequence), zap.Bool("duplicate", ack.Duplicate))
+		if ack.Duplicate {
+			reportPublish(channel, publishResultDuplicate, time.Since(start))
+			s.logger.Debug("duplicate event dropped by the stream", zap.String("channel", channel.String()), zap.Uint64("sequence", ack.Sequence))
+			return nil
 		}
+		reportPublish(channel, publishResultSuccess, time.Since(start))
 		s.logger.Debug("published", zap.String("channel", channel.String()))
 		return nil
 	}
 }
 
+// getSender returns the sender of the channel publishing on conn, creating it if the channel has none yet or its
+// sender publishes on the connection of another connection profile.
+func (s *jetSubscriptionsSupervisor) getSender(channel eventingchannels.ChannelReference, conn *jetConnection) *jetSender {
+	s.sendersMux.Lock()
+	defer s.sendersMux.Unlock()
+
+	if sender, ok := s.senders[channel]; ok && sender.usable(conn) {
+		return sender
+	}
+	sender := newJetSender(conn, getJetStreamSubject(channel))
+	s.senders[channel] = sender
+	return sender
+}
+
 func (s *jetSubscriptionsSupervisor) Start(ctx context.Context) error {
-	// Starting Connect to establish connection with NATS
-	go s.Connect(ctx)
-	// Trigger Connect to establish connection with NATS
-	s.signalReconnect()
-	return s.receiver.Start(ctx)
+	s.connectionsMux.Lock()
+	s.ctx = ctx
+	for _, conn := range s.connections {
+		conn.start(ctx)
+	}
+	s.connectionsMux.Unlock()
+	go s.reportMetrics(ctx)
+	return s.ingress.StartListen(ctx, &ingressHandler{next: s.receiver})
 }
 
-func (s *jetSubscriptionsSupervisor) connectWithRetry(ctx context.Context) {
-	// re-attempting evey 1 second until the connection is established.
-	ticker := time.NewTicker(jetRetryInterval)
+// reportMetrics reports the state of the connections and of the consumers of the subscriptions periodically,
+// until ctx is done. The states of the consumers are also kept for the statuses of the channels, and the changes
+// of the states of the connections are reported.
+func (s *jetSubscriptionsSupervisor) reportMetrics(ctx context.Context) {
+	ticker := time.NewTicker(metricsReportInterval)
 	defer ticker.Stop()
+	connected := make(map[string]bool)
 	for {
-		nConn, err := natsutil.JetStreamConnect(s.jetStreamURL, s.logger.Sugar())
-		if err == nil {
-			// Locking here in order to reduce time in locked state.
-			s.natsConnMux.Lock()
-			s.natsConn = nConn
-			s.natsConnInProgress = false
-			s.natsConnMux.Unlock()
-			return
-		}
-		s.logger.Sugar().Errorf("Connect() failed with error: %+v, retrying in %s", err, jetRetryInterval.String())
 		select {
-		case <-ticker.C:
-			continue
 		case <-ctx.Done():
 			return
+		case <-ticker.C:
+		}
+
+		for profile, state := range s.ConnectionStates() {
+			isConnected := state == ConnectionStateConnected
+			reportConnection(profile, isConnected)
+			if connected[profile] != isConnected {
+				connected[profile] = isConnected
+				s.connectionStateChanged(profile)
+			}
+		}
+
+		type consumer struct {
+			channel eventingchannels.ChannelReference
+			sub     *jetSubscription
+		}
+		var consumers []consumer
+		s.subscriptionsMux.Lock()
+		for channel, subs := range s.subscriptions {
+			for _, sub := range subs {
+				consumers = append(consumers, consumer{channel: channel, sub: sub})
+			}
+		}
+		s.subscriptionsMux.Unlock()
+
+		states := make(map[eventingchannels.ChannelReference]map[types.UID]ConsumerState)
+		for _, c := range consumers {
+			if _, ok := states[c.channel]; !ok {
+				states[c.channel] = make(map[types.UID]ConsumerState)
+			}
+			info, err := c.sub.consumerInfo()
+			if err != nil {
+				s.logger.Debug("could not read the consumer info", zap.String("sub", string(c.sub.ref.UID)), zap.Error(err))
+				// Keep the last known state rather than dropping the consumer from the status of the channel.
+				if state, ok := s.consumers.get(c.channel)[c.sub.ref.UID]; ok {
+					states[c.channel][c.sub.ref.UID] = state
+				}
+				continue
+			}
+			reportConsumer(c.channel, c.sub.ref.UID, int64(info.NumPending), int64(info.NumAckPending))
+			states[c.channel][c.sub.ref.UID] = consumerStateFromInfo(info)
 		}
+		s.consumers.update(states)
 	}
 }
 
-// Connect is called for initial connection as well as after every disconnect
-func (s *jetSubscriptionsSupervisor) Connect(ctx context.Context) {
-	for {
-		select {
-		case <-s.connect:
-			s.natsConnMux.Lock()
-			currentConnProgress := s.natsConnInProgress
-			s.natsConnMux.Unlock()
-			if !currentConnProgress {
-				// Case for lost connectivity, setting InProgress to true to prevent recursion
-				s.natsConnMux.Lock()
-				s.natsConnInProgress = true
-				s.natsConnMux.Unlock()
-				go s.connectWithRetry(ctx)
+// getConnection returns the connection to the servers of the named connection profile, creating it on first use.
+func (s *jetSubscriptionsSupervisor) getConnection(profile string) (*jetConnection, error) {
+	s.connectionsMux.Lock()
+	defer s.connectionsMux.Unlock()
+
+	if conn, ok := s.connections[profile]; ok {
+		return conn, nil
+	}
+	p, ok := s.profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown connection profile %q", profile)
+	}
+	conn := s.newConnection(profile, p)
+	s.connections[profile] = conn
+	return conn, nil
+}
+
+// newConnection creates the connection to the servers of a connection profile, and starts it if the dispatcher
+// is started already. Should be called only while holding connectionsMux.
+func (s *jetSubscriptionsSupervisor) newConnection(name string, profile natsutil.ConnectionProfile) *jetConnection {
+	conn := newJetConnection(name, profile, s.logger, func(ctx context.Context) {
+		s.resubscribe(ctx, func(sub *jetSubscription) bool {
+			return sub.profile == name
+		})
+	})
+	if s.ctx != nil {
+		conn.start(s.ctx)
+	}
+	return conn
+}
+
+// Ready returns an error unless the dispatcher is connected to the default servers. The servers of the other
+// connection profiles and the streams only affect their channels, so they're reported in the statuses of the
+// channels rather than making the whole dispatcher unready.
+func (s *jetSubscriptionsSupervisor) Ready(_ context.Context) error {
+	conn, err := s.getConnection(natsutil.DefaultConnectionProfile)
+	if err != nil {
+		return err
+	}
+	if state := conn.state(); state != ConnectionStateConnected {
+		return fmt.Errorf("connection to NATS JetStream is %s", state)
+	}
+	return nil
+}
+
+// StreamExists returns whether the stream of the given channel exists on the servers of the channel.
+func (s *jetSubscriptionsSupervisor) StreamExists(name, ns string) (bool, error) {
+	channel := eventingchannels.ChannelReference{Namespace: ns, Name: name}
+	conn, err := s.getConnection(s.channelConfig(channel).ConnectionProfile)
+	if err != nil {
+		return false, err
+	}
+	js, err := conn.publisher()
+	if err != nil {
+		return false, err
+	}
+	if _, err := js.StreamInfo(getJetStreamName(channel)); err != nil {
+		if natsutil.IsStreamNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ConnectionStates returns the state of the connections to the servers of the connection profiles in use.
+func (s *jetSubscriptionsSupervisor) ConnectionStates() map[string]ConnectionState {
+	s.connectionsMux.Lock()
+	defer s.connectionsMux.Unlock()
+
+	states := make(map[string]ConnectionState, len(s.connections))
+	for name, conn := range s.connections {
+		states[name] = conn.state()
+	}
+	return states
+}
+
+// UpdateConfig applies a new configuration of the connections to NATS JetStream. The dispatcher reconnects to the
+// servers of the connection profiles which changed, and re-establishes the subscriptions when their settings change.
+func (s *jetSubscriptionsSupervisor) UpdateConfig(ctx context.Context, natsConfig *config.NatsConfig) {
+	s.configMux.Lock()
+	subscriptionsChanged := s.ackWaitMinutes != natsConfig.AckWaitMinutes || s.maxInflight != natsConfig.MaxInflight
+	s.ackWaitMinutes = natsConfig.AckWaitMinutes
+	s.maxInflight = natsConfig.MaxInflight
+	s.configMux.Unlock()
+	s.audit.update(natsConfig.AuditLog, natsConfig.AuditLogSampleRate)
+
+	profiles := natsConfig.JetStreamProfiles(s.connection)
+	var removed []string
+	s.connectionsMux.Lock()
+	s.profiles = profiles
+	for name, conn := range s.connections {
+		profile, ok := profiles[name]
+		if ok && reflect.DeepEqual(profile, conn.profile) {
+			continue
+		}
+		conn.close()
+		delete(s.connections, name)
+		if !ok {
+			s.logger.Warn("Connection profile removed", zap.String("profile", name))
+			removed = append(removed, name)
+			continue
+		}
+		// The subscriptions are re-established with the new settings once connected.
+		s.logger.Info("Connection profile changed, reconnecting", zap.String("profile", name))
+		s.connections[name] = s.newConnection(name, profile)
+	}
+	s.connectionsMux.Unlock()
+
+	if len(removed) > 0 {
+		s.forgetSubscriptions(removed)
+	}
+	if subscriptionsChanged {
+		s.logger.Info("NATS JetStream subscription configuration changed, resubscribing")
+		s.resubscribe(ctx, func(*jetSubscription) bool {
+			return true
+		})
+	}
+}
+
+// forgetSubscriptions drops the subscriptions of channels served by the given connection profiles, which were
+// removed, so that the next reconciliation of the channels reports them as failed.
+func (s *jetSubscriptionsSupervisor) forgetSubscriptions(profiles []string) {
+	s.subscriptionsMux.Lock()
+	defer s.subscriptionsMux.Unlock()
+
+	for cRef, chMap := range s.subscriptions {
+		for uid, sub := range chMap {
+			for _, profile := range profiles {
+				if sub.profile == profile {
+					s.logger.Error("Connection profile of the channel removed, dropping subscription", zap.String("channel", cRef.String()), zap.String("sub", string(uid)), zap.String("profile", profile))
+					if sub.stop != nil {
+						sub.stop()
+					}
+					delete(chMap, uid)
+				}
 			}
-		case <-ctx.Done():
-			return
+		}
+	}
+}
+
+// resubscribe re-establishes the active subscriptions matching filter on the current connections. The durable
+// consumers are kept by the server, so the subscribers continue where they left off.
+func (s *jetSubscriptionsSupervisor) resubscribe(ctx context.Context, filter func(*jetSubscription) bool) {
+	s.subscriptionsMux.Lock()
+	defer s.subscriptionsMux.Unlock()
+
+	for cRef, chMap := range s.subscriptions {
+		for uid, sub := range chMap {
+			if !filter(sub) {
+				continue
+			}
+			// Subscriptions of a closed connection are gone already. Draining keeps the durable consumer.
+			if err := sub.drain(); err != nil && err != nats.ErrConnectionClosed {
+				s.logger.Warn("failed to drain subscription", zap.String("channel", cRef.String()), zap.String("sub", string(uid)), zap.Error(err))
+			}
+			natsSub, err := s.subscribe(ctx, cRef, sub.ref)
+			if err != nil {
+				// Forgetting the subscription lets the next reconciliation of the channel subscribe again.
+				s.logger.Error("failed to re-establish subscription", zap.String("channel", cRef.String()), zap.String("sub", string(uid)), zap.Error(err))
+				delete(chMap, uid)
+				continue
+			}
+			chMap[uid] = natsSub
 		}
 	}
 }
@@ -226,6 +570,19 @@ func (s *jetSubscriptionsSupervisor) UpdateSubscriptions(ctx context.Context, na
 	if len(subscribers) == 0 || isFinalizer {
 		s.logger.Sugar().Infof("Empty subscriptions for channel Ref: %v; unsubscribe all active subscriptions, if any", cRef)
 
+		if isFinalizer {
+			s.channelConfigsMux.Lock()
+			delete(s.channelConfigs, cRef)
+			delete(s.subscriberConfigs, cRef)
+			s.channelConfigsMux.Unlock()
+
+			s.sendersMux.Lock()
+			delete(s.senders, cRef)
+			s.sendersMux.Unlock()
+
+			s.rateLimiters.update(cRef, nil)
+		}
+
 		chMap, ok := s.subscriptions[cRef]
 		if !ok {
 			// nothing to do
@@ -243,17 +600,26 @@ func (s *jetSubscriptionsSupervisor) UpdateSubscriptions(ctx context.Context, na
 
 	chMap, ok := s.subscriptions[cRef]
 	if !ok {
-		chMap = make(map[types.UID]*nats.Subscription)
+		chMap = make(map[types.UID]*jetSubscription)
 		s.subscriptions[cRef] = chMap
 	}
 
 	for _, sub := range subscribers {
 		// check if the subscription already exist and do nothing in this case
 		subRef := newSubscriptionReference(sub)
-		if _, ok := chMap[subRef.UID]; ok {
-			activeSubs[subRef.UID] = true
-			s.logger.Sugar().Infof("Subscription: %v already active for channel: %v", sub, cRef)
-			continue
+		settings := s.dispatchSettings(cRef, subRef.UID)
+		if existing, ok := chMap[subRef.UID]; ok {
+			if !existing.outdated(subRef, settings) {
+				activeSubs[subRef.UID] = true
+				s.logger.Sugar().Infof("Subscription: %v already active for channel: %v", sub, cRef)
+				continue
+			}
+			// The consumer is recreated with the new settings when subscribing again.
+			s.logger.Info("Subscriber or dispatch settings of the channel changed, resubscribing", zap.String("channel", cRef.String()), zap.String("sub", string(subRef.UID)), zap.Any("settings", settings))
+			if err := existing.drain(); err != nil && err != nats.ErrConnectionClosed {
+				s.logger.Warn("failed to drain subscription", zap.String("channel", cRef.String()), zap.String("sub", string(subRef.UID)), zap.Error(err))
+			}
+			delete(chMap, subRef.UID)
 		}
 		// subscribe and update failedSubscription if subscribe fails
 		natssSub, err := s.subscribe(ctx, cRef, subRef)
@@ -280,8 +646,107 @@ func (s *jetSubscriptionsSupervisor) UpdateSubscriptions(ctx context.Context, na
 	return failedToSubscribe, nil
 }
 
-func (s *jetSubscriptionsSupervisor) subscribe(ctx context.Context, channel eventingchannels.ChannelReference, subscription subscriptionReference) (*nats.Subscription, error) {
-	s.logger.Info("Subscribe to channel:", zap.Any("channel", channel), zap.Any("subscription", subscription))
+// natsConn returns the current connection to the servers of the named connection profile.
+func (s *jetSubscriptionsSupervisor) natsConn(profile string) (*nats.Conn, error) {
+	conn, err := s.getConnection(profile)
+	if err != nil {
+		return nil, err
+	}
+	return conn.current()
+}
+
+// publishDeadLetter publishes a message which couldn't be delivered to the stream of its channel, on the servers
+// of the given connection profile.
+func (s *jetSubscriptionsSupervisor) publishDeadLetter(profile string, msg *nats.Msg) error {
+	currentNatssConn, err := s.natsConn(profile)
+	if err != nil {
+		return err
+	}
+
+	js, err := currentNatssConn.JetStream()
+	if err != nil {
+		return err
+	}
+	_, err = js.PublishMsg(msg)
+	return err
+}
+
+// UpdateChannelConfig sets the configuration used to dispatch the events of the given channel. It applies
+// to the messages handled from now on, including the ones of existing subscriptions.
+func (s *jetSubscriptionsSupervisor) UpdateChannelConfig(name, ns string, config ChannelConfig) {
+	s.channelConfigsMux.Lock()
+	defer s.channelConfigsMux.Unlock()
+	s.channelConfigs[eventingchannels.ChannelReference{Namespace: ns, Name: name}] = config
+}
+
+// UpdateSubscriberConfigs sets the configurations of the subscribers of the given channel. The subscriptions whose
+// configuration changed are established again by the next UpdateSubscriptions.
+func (s *jetSubscriptionsSupervisor) UpdateSubscriberConfigs(name, ns string, configs map[types.UID]SubscriberConfig) {
+	s.channelConfigsMux.Lock()
+	defer s.channelConfigsMux.Unlock()
+	cRef := eventingchannels.ChannelReference{Namespace: ns, Name: name}
+	if len(configs) == 0 {
+		delete(s.subscriberConfigs, cRef)
+		return
+	}
+	s.subscriberConfigs[cRef] = configs
+}
+
+// UpdateRateLimits sets the rate limits of the subscribers of the given channel. They apply to the messages
+// handled from now on, including the ones of existing subscriptions.
+func (s *jetSubscriptionsSupervisor) UpdateRateLimits(name, ns string, limits map[types.UID]RateLimit) {
+	s.rateLimiters.update(eventingchannels.ChannelReference{Namespace: ns, Name: name}, limits)
+}
+
+// OpenCircuits returns why the circuit breakers of the subscribers of the given channel are open.
+func (s *jetSubscriptionsSupervisor) OpenCircuits(name, ns string) map[types.UID]string {
+	return s.circuitBreakers.open(eventingchannels.ChannelReference{Namespace: ns, Name: name})
+}
+
+// ConsumerStates returns the last known states of the consumers of the subscribers of the given channel.
+func (s *jetSubscriptionsSupervisor) ConsumerStates(name, ns string) map[types.UID]ConsumerState {
+	return s.consumers.get(eventingchannels.ChannelReference{Namespace: ns, Name: name})
+}
+
+func (s *jetSubscriptionsSupervisor) channelConfig(channel eventingchannels.ChannelReference) ChannelConfig {
+	s.channelConfigsMux.RLock()
+	defer s.channelConfigsMux.RUnlock()
+	return s.channelConfigs[channel]
+}
+
+// dispatchSettings returns the settings the subscription of the subscriber to channel is established with.
+func (s *jetSubscriptionsSupervisor) dispatchSettings(channel eventingchannels.ChannelReference, subscriber types.UID) dispatchSettings {
+	s.channelConfigsMux.RLock()
+	defer s.channelConfigsMux.RUnlock()
+	return s.channelConfigs[channel].dispatchSettings(s.subscriberConfigs[channel][subscriber])
+}
+
+func (s *jetSubscriptionsSupervisor) subscribe(ctx context.Context, channel eventingchannels.ChannelReference, subscription subscriptionReference) (*jetSubscription, error) {
+	s.logger.Info("Subscribe to channel:", zap.String("channel", channel.String()), zap.String("sub", string(subscription.UID)))
+
+	profile := s.channelConfig(channel).ConnectionProfile
+	conn, err := s.getConnection(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	retryConfig, err := newRetryConfig(subscription)
+	if err != nil {
+		s.logger.Error("Invalid delivery spec", zap.String("sub", string(subscription.UID)), zap.Error(err))
+		return nil, fmt.Errorf("invalid delivery spec: %w", err)
+	}
+	deliveryConfig := singleDeliveryConfig(retryConfig)
+	maxDeliveries := maxDeliver(subscription)
+
+	settings := s.dispatchSettings(channel, subscription.UID)
+	consumerConfig := s.consumerConfig(maxDeliveries, settings.ordering)
+	keyOrdered := settings.keyOrdered()
+	breaker := s.circuitBreakers.get(channel, subscription.UID)
+
+	// The messages of the subscription are handled with subCtx rather than the context of the reconciliation, so
+	// that the messages held by the circuit breaker or the rate limiter are released when the subscriber
+	// unsubscribes.
+	subCtx, cancel := context.WithCancel(context.Background())
 
 	mcb := func(stanMsg *nats.Msg) {
 		defer func() {
@@ -296,7 +761,17 @@ func (s *jetSubscriptionsSupervisor) subscribe(ctx context.Context, channel even
 
 		message := jsmcloudevents.NewMessage(stanMsg)
 
-		s.logger.Debug("NATS JetStream message received", zap.String("subject", stanMsg.Subject))
+		meta, err := stanMsg.Metadata()
+		if err != nil {
+			s.logger.Error("could not read the metadata of the message", zap.Error(err))
+			return
+		}
+		s.logger.Debug("NATS JetStream message received", zap.String("subject", stanMsg.Subject), zap.Uint64("sequence", meta.Sequence.Stream), zap.Uint64("delivered", meta.NumDelivered))
+		if meta.NumDelivered > 1 {
+			reportRedelivery(channel, subscription.UID)
+		}
+		audited := s.audit.sampleData(stanMsg.Data)
+		s.audit.record(audited, auditReceived, channel, subscription.UID, zap.Uint64("stream_sequence", meta.Sequence.Stream), zap.Uint64("attempt", meta.NumDelivered))
 
 		var destination *url.URL
 		if !subscription.SubscriberURI.IsEmpty() {
@@ -316,65 +791,309 @@ func (s *jetSubscriptionsSupervisor) subscribe(ctx context.Context, channel even
 			s.logger.Debug("dispatch message", zap.String("deadLetter", deadLetter.String()))
 		}
 
-		executionInfo, err := s.dispatcher.DispatchMessage(ctx, message, nil, destination, reply, deadLetter)
-		if err != nil {
-			s.logger.Error("Failed to dispatch message: ", zap.Error(err))
+		// The wait span ends when the message is first dispatched, it only spans the rate limit and the circuit breaker.
+		waitCtx, waitSpan := startWaitSpan(subCtx, stanMsg, meta)
+		defer waitSpan.End()
+
+		if err := s.rateLimiters.wait(waitCtx, channel, subscription.UID, func() { _ = stanMsg.InProgress() }); err != nil {
+			// The message isn't acknowledged, so it's redelivered once the ack wait is over.
+			s.logger.Warn("Gave up waiting for the rate limit of the subscriber", zap.String("sub", string(subscription.UID)), zap.Error(err))
+			return
+		}
+
+		// Every delivery is dispatched once, retries are redeliveries of the message by JetStream. Key ordered
+		// subscriptions retry right away instead, so that the next messages with the same key wait for the retries.
+		config := deliveryConfig
+		if keyOrdered {
+			config = reportProgress(retryConfig, stanMsg)
+		}
+		// While the subscriber is unavailable, the message is held and kept from being redelivered, until the
+		// circuit breaker lets it through.
+		executionInfo, err := breaker.dispatch(waitCtx, func() { _ = stanMsg.InProgress() }, func() (*eventingchannels.DispatchExecutionInfo, error) {
+			waitSpan.End()
+			deliverCtx, deliverSpan := startMessageSpan(subCtx, deliverSpanName, stanMsg)
+			deliverSpan.AddAttributes(messagingAttributes(stanMsg.Subject)...)
+			start := time.Now()
+			info, err := s.dispatcher.DispatchMessageWithRetries(deliverCtx, message, nil, destination, reply, nil, config)
+			reportDispatch(channel, subscription.UID, dispatchResponseCode(info), time.Since(start))
+			endSpan(deliverSpan, err)
+			return info, err
+		})
+		if errors.Is(err, errCircuitBreakerStopped) || subCtx.Err() != nil {
+			// The message was held until the subscription went away, it's redelivered once the ack wait is over.
+			s.logger.Debug("message released without being dispatched", zap.String("sub", string(subscription.UID)), zap.Error(err))
+			return
+		}
+		if err == nil {
+			s.audit.record(audited, auditDelivered, channel, subscription.UID, zap.Uint64("attempt", meta.NumDelivered), zap.Int("response_code", dispatchResponseCode(executionInfo)))
+			// TODO: Actually report the stats
+			// https://github.com/knative-sandbox/eventing-natss/issues/39
+			s.logger.Debug("Dispatch details", zap.Any("DispatchExecutionInfo", executionInfo), zap.Uint64("attempts", meta.NumDelivered))
+			if err := stanMsg.Ack(); err != nil {
+				s.logger.Error("failed to acknowledge message", zap.Error(err))
+			}
+			s.logger.Debug("message dispatched", zap.Any("channel", channel))
 			return
 		}
-		// TODO: Actually report the stats
-		// https://github.com/knative-sandbox/eventing-natss/issues/39
-		s.logger.Debug("Dispatch details", zap.Any("DispatchExecutionInfo", executionInfo))
-		if err := stanMsg.Ack(); err != nil {
-			s.logger.Error("failed to acknowledge message", zap.Error(err))
+
+		redelivered := !keyOrdered && meta.NumDelivered < uint64(maxDeliveries)
+		s.audit.record(audited, auditFailed, channel, subscription.UID, zap.Uint64("attempt", meta.NumDelivered), zap.Int("response_code", dispatchResponseCode(executionInfo)), zap.Bool("redelivered", redelivered), zap.Error(err))
+		if redelivered {
+			delay := redeliveryDelay(retryConfig, meta.NumDelivered)
+			s.logger.Warn("Failed to dispatch message, requesting redelivery", zap.Uint64("attempts", meta.NumDelivered), zap.Duration("delay", delay), zap.Error(err))
+			if err := natsutil.NakWithDelay(stanMsg, delay); err != nil {
+				s.logger.Error("failed to negatively acknowledge message", zap.Error(err))
+			}
+			return
 		}
 
-		s.logger.Debug("message dispatched", zap.Any("channel", channel))
+		s.logger.Error("Failed to dispatch message, no attempts left", zap.Uint64("attempts", meta.NumDelivered), zap.Error(err))
+		switch {
+		case deadLetter != nil:
+			executionInfo, err := s.dispatcher.DispatchMessageWithRetries(subCtx, message, nil, deadLetter, nil, nil, deliveryConfig, deadLetterTransformers(executionInfo)...)
+			if err != nil {
+				s.logger.Error("Failed to dispatch message to the dead letter sink", zap.Error(err))
+			} else {
+				s.logger.Debug("Dead letter dispatch details", zap.Any("DispatchExecutionInfo", executionInfo))
+				s.audit.record(audited, auditDeadLettered, channel, subscription.UID, zap.String("dead_letter", deadLetter.String()))
+			}
+		case s.channelConfig(channel).DeadLetterQueue:
+			dlqMsg := newDeadLetterMsg(getJetStreamDeadLetterSubject(channel), stanMsg, meta, subscription, executionInfo, err)
+			if err := s.publishDeadLetter(profile, dlqMsg); err != nil {
+				s.logger.Error("Failed to publish message to the dead letter queue", zap.String("subject", dlqMsg.Subject), zap.Error(err))
+			} else {
+				s.logger.Debug("message published to the dead letter queue", zap.String("subject", dlqMsg.Subject))
+				s.audit.record(audited, auditDeadLettered, channel, subscription.UID, zap.String("dead_letter", dlqMsg.Subject))
+			}
+		}
+		// The message won't be redelivered, whether the dead letter sink accepted it or not.
+		if err := stanMsg.Term(); err != nil {
+			s.logger.Error("failed to terminate message", zap.Error(err))
+		}
 	}
 
 	ch := getJetStreamSubject(channel)
-	//sub := subscription.String()
+	durable := getConsumerName(subscription.UID)
 
-	s.natsConnMux.Lock()
-	currentNatssConn := s.natsConn
-	s.natsConnMux.Unlock()
-
-	if currentNatssConn == nil {
-		return nil, errors.New("no Connection to NATS JetStream")
+	currentNatssConn, err := conn.current()
+	if err != nil {
+		cancel()
+		return nil, err
 	}
 
 	jsm, err := currentNatssConn.JetStream(nil...)
 	if jsm == nil || err != nil {
+		cancel()
 		return nil, fmt.Errorf("get JetStream Context from Connection err,err:%s", err.Error())
 	}
 
-	subscriber := &jsmcloudevents.RegularSubscriber{}
-	natssSub, err := subscriber.Subscribe(jsm, ch, mcb)
-	s.logger.Sugar().Infof("====nats jetstream subject %s", ch)
+	// The durable consumer keeps track of the position of the subscriber in the stream across
+	// dispatcher restarts and reconnects. The options are only used when the consumer is created,
+	// existing consumers are attached to as they are.
+	deliverPolicy, err := s.prepareConsumer(jsm, getJetStreamName(channel), durable, consumerConfig, settings.pullMode())
+	if err != nil {
+		s.logger.Error("Preparing NATS JetStream consumer failed: ", zap.Error(err))
+		cancel()
+		return nil, err
+	}
+
+	// The messages queued behind the ones being handled are kept from being redelivered while they wait.
+	progress := func(msg *nats.Msg) { _ = msg.InProgress() }
+	handler := mcb
+	var workers *keyedWorkers
+	switch {
+	case keyOrdered:
+		// The messages are handled by one worker per partition, the messages of a partition one after the other.
+		workers = newKeyedWorkers(settings.partitions, mcb, progress)
+		handler = func(msg *nats.Msg) {
+			workers.dispatch(partitionKey(msg, settings.partitionKeyExtension), msg)
+		}
+	case !settings.pullMode():
+		// The pushed messages are queued rather than left in the pending messages of the NATS subscription, so
+		// that they're kept in progress while the circuit breaker holds the one ahead of them.
+		workers = newKeyedWorkers(1, mcb, progress)
+		handler = func(msg *nats.Msg) {
+			workers.dispatch("", msg)
+		}
+	}
+
+	opts := []nats.SubOpt{
+		nats.BindStream(getJetStreamName(channel)),
+		deliverPolicy,
+		nats.AckExplicit(),
+		nats.AckWait(consumerConfig.AckWait),
+		nats.MaxAckPending(consumerConfig.MaxAckPending),
+		nats.MaxDeliver(consumerConfig.MaxDeliver),
+	}
+	pushSubscribe := func() (natsSubscription, error) {
+		subscriber := &jsmcloudevents.RegularSubscriber{}
+		return subscriber.Subscribe(jsm, ch, handler, append(opts, nats.Durable(durable), nats.ManualAck())...)
+	}
+	var natssSub *nats.Subscription
+	if settings.pullMode() {
+		natssSub, err = jsm.PullSubscribe(ch, durable, opts...)
+	} else {
+		var sub natsSubscription
+		sub, err = pushSubscribe()
+		natssSub, _ = sub.(*nats.Subscription)
+	}
 	if err != nil {
 		s.logger.Error(" Create new NATS JetStream Subscription failed: ", zap.Error(err))
-		if err.Error() == stan.ErrConnectionClosed.Error() {
-			s.logger.Error("Connection to NATS JetStream has been lost, attempting to reconnect.")
-			// Informing subscriptionsSupervisor to re-establish connection to NATS
-			s.signalReconnect()
-			return nil, err
+		cancel()
+		if workers != nil {
+			workers.close()
 		}
 		return nil, err
 	}
 
-	s.logger.Sugar().Infof("NATS JetStream Subscription created: %+v", natssSub)
-	return natssSub, nil
+	jetSub := &jetSubscription{ref: subscription, profile: profile, settings: settings, sub: natssSub, resubscribe: pushSubscribe}
+	logger := s.logger.With(zap.String("channel", channel.String()), zap.String("sub", string(subscription.UID)))
+	if settings.pullMode() {
+		// Ordered and key ordered messages aren't handled concurrently by the pulling goroutine. No messages are
+		// fetched while the circuit of the subscriber is open.
+		concurrent := !keyOrdered && settings.ordering != v1alpha1.OrderedDeliveryOrdering
+		stopPulling := startPulling(natssSub, settings.pull, handler, concurrent, breaker.waitClosed, logger)
+		go func() {
+			<-subCtx.Done()
+			stopPulling()
+		}()
+	} else {
+		// The consumer stops pushing messages while the circuit of the subscriber is open.
+		go pauseWhileOpen(subCtx, jetSub, breaker, logger)
+	}
+	jetSub.stop = func() {
+		cancel()
+		if workers != nil {
+			workers.close()
+		}
+	}
+
+	logger.Debug("NATS JetStream Subscription created")
+	return jetSub, nil
+}
+
+// pauseWhileOpen pauses the push subscription of a subscriber while its circuit is open, until ctx is done or the
+// subscriber unsubscribed.
+func pauseWhileOpen(ctx context.Context, sub *jetSubscription, breaker *circuitBreaker, logger *zap.Logger) {
+	for {
+		if err := breaker.waitOpen(ctx); err != nil {
+			return
+		}
+		logger.Info("Circuit breaker of the subscriber opened, pausing the subscription")
+		if err := sub.pause(); err != nil {
+			logger.Warn("failed to pause the subscription", zap.Error(err))
+		}
+		if err := breaker.waitClosed(ctx); err != nil {
+			return
+		}
+		logger.Info("Circuit breaker of the subscriber closed, resuming the subscription")
+		// A subscription which can't be resumed, because the connection was lost for instance, is re-established
+		// along with the others once connected again.
+		for err := sub.resume(); err != nil; err = sub.resume() {
+			logger.Warn("failed to resume the subscription", zap.Error(err))
+			select {
+			case <-time.After(jetRetryInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// consumerConfig returns the settings of the durable consumer of a subscriber, for a channel with the given
+// delivery ordering.
+func (s *jetSubscriptionsSupervisor) consumerConfig(maxDeliveries int, ordering v1alpha1.DeliveryOrdering) nats.ConsumerConfig {
+	s.configMux.RLock()
+	defer s.configMux.RUnlock()
+
+	consumerConfig := nats.ConsumerConfig{
+		AckWait:       time.Duration(s.ackWaitMinutes) * time.Minute,
+		MaxAckPending: s.maxInflight,
+		MaxDeliver:    maxDeliveries,
+	}
+	if ordering == v1alpha1.OrderedDeliveryOrdering {
+		// With a single message in flight, the next message is delivered once the current one was acknowledged
+		// or terminated, and redeliveries come before it.
+		consumerConfig.MaxAckPending = 1
+	}
+	return consumerConfig
+}
+
+// prepareConsumer returns the deliver policy of the durable consumer of a subscription. Consumers can't be updated,
+// so a consumer created with other settings than want is deleted, and recreated starting from the first message it
+// didn't acknowledge. The same goes for consumers of the other kind than wanted, push or pull. New consumers only
+// receive the events published from now on.
+func (s *jetSubscriptionsSupervisor) prepareConsumer(jsm nats.JetStreamContext, stream, durable string, want nats.ConsumerConfig, pull bool) (nats.SubOpt, error) {
+	info, err := jsm.ConsumerInfo(stream, durable)
+	if natsutil.IsConsumerNotFound(err) {
+		return nats.DeliverNew(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !consumerConfigChanged(info.Config, want) && !consumerModeChanged(info.Config, pull) {
+		return nats.DeliverNew(), nil
+	}
+
+	s.logger.Info("NATS JetStream consumer configuration changed, recreating the consumer",
+		zap.String("stream", stream),
+		zap.String("consumer", durable),
+		zap.Uint64("ackFloor", info.AckFloor.Stream))
+	if err := jsm.DeleteConsumer(stream, durable); err != nil && !natsutil.IsConsumerNotFound(err) {
+		return nil, err
+	}
+	return nats.StartSequence(info.AckFloor.Stream + 1), nil
+}
+
+// consumerConfigChanged returns true if the settings of an existing consumer managed by the dispatcher differ from
+// the wanted ones.
+func consumerConfigChanged(got, want nats.ConsumerConfig) bool {
+	return got.AckWait != want.AckWait ||
+		got.MaxAckPending != want.MaxAckPending ||
+		got.MaxDeliver != want.MaxDeliver
+}
+
+// consumerModeChanged returns true if an existing consumer is a push consumer while a pull consumer is wanted, or
+// the other way around.
+func consumerModeChanged(got nats.ConsumerConfig, pull bool) bool {
+	return (got.DeliverSubject == "") != pull
 }
 
 // should be called only while holding subscriptionsMux
 func (s *jetSubscriptionsSupervisor) unsubscribe(channel eventingchannels.ChannelReference, subscription types.UID) error {
-	s.logger.Info("Unsubscribe from channel:", zap.Any("channel", channel), zap.Any("subscription", subscription))
+	s.logger.Info("Unsubscribe from channel:", zap.String("channel", channel.String()), zap.String("sub", string(subscription)))
 
 	if stanSub, ok := s.subscriptions[channel][subscription]; ok {
-		if err := (*stanSub).Unsubscribe(); err != nil {
-			s.logger.Error("Unsubscribing NATS JetStream subscription failed: ", zap.Error(err))
+		// Drain leaves the durable consumer in place, it's deleted below since the subscriber is gone for good.
+		if err := stanSub.drain(); err != nil {
+			s.logger.Error("Draining NATS JetStream subscription failed: ", zap.Error(err))
 			return err
 		}
 		delete(s.subscriptions[channel], subscription)
+		s.circuitBreakers.forget(channel, subscription)
+		if err := s.deleteConsumer(stanSub.profile, channel, subscription); err != nil {
+			s.logger.Error("Deleting NATS JetStream consumer failed: ", zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteConsumer deletes the durable consumer of the subscription. Consumers that are already gone,
+// for instance because the stream was deleted together with the channel, are ignored.
+func (s *jetSubscriptionsSupervisor) deleteConsumer(profile string, channel eventingchannels.ChannelReference, subscription types.UID) error {
+	currentNatssConn, err := s.natsConn(profile)
+	if err != nil {
+		return err
+	}
+
+	jsm, err := currentNatssConn.JetStream()
+	if err != nil {
+		return err
+	}
+	err = jsm.DeleteConsumer(getJetStreamName(channel), getConsumerName(subscription))
+	if err != nil && !natsutil.IsStreamNotFound(err) && !natsutil.IsConsumerNotFound(err) {
+		return err
 	}
 	return nil
 }
@@ -411,6 +1130,21 @@ func (s *jetSubscriptionsSupervisor) getChannelReferenceFromHost(host string) (e
 	return cr, nil
 }
 
+// getJetStreamName returns the name of the stream created by the controller for the channel.
+func getJetStreamName(channel eventingchannels.ChannelReference) string {
+	return natsutil.ChannelStreamName(channel.Namespace, channel.Name)
+}
+
 func getJetStreamSubject(channel eventingchannels.ChannelReference) string {
-	return natsutil.StreamName + "." + channel.Name + "-" + channel.Namespace
+	return natsutil.ChannelSubject(channel.Namespace, channel.Name)
+}
+
+func getJetStreamDeadLetterSubject(channel eventingchannels.ChannelReference) string {
+	return natsutil.ChannelDeadLetterSubject(channel.Namespace, channel.Name)
+}
+
+// getConsumerName returns the name of the durable consumer of the subscription, which is unique within
+// the stream of a channel.
+func getConsumerName(subscription types.UID) string {
+	return string(subscription)
 }
@@ -0,0 +1,319 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+	"k8s.io/utils/pointer"
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+
+	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
+	"knative.dev/eventing-natss/pkg/config"
+	"knative.dev/eventing-natss/pkg/natsutil"
+)
+
+func TestJetStreamConnectionProfiles(t *testing.T) {
+	d, err := NewJetStreamDispatcher(JetArgs{
+		JetStreamURL:   "nats://127.0.0.1:1",
+		AckWaitMinutes: 1,
+		MaxInflight:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := d.(*jetSubscriptionsSupervisor)
+
+	defaultConn, err := s.getConnection(natsutil.DefaultConnectionProfile)
+	if err != nil {
+		t.Fatalf("getConnection() unexpected error: %v", err)
+	}
+	if _, err := s.getConnection("eu-west"); err == nil {
+		t.Error("getConnection(eu-west) expected an error for an unknown profile")
+	}
+	if diff := cmp.Diff(map[string]ConnectionState{natsutil.DefaultConnectionProfile: ConnectionStateConnecting}, s.ConnectionStates()); diff != "" {
+		t.Errorf("ConnectionStates() (-want, +got) = %v", diff)
+	}
+
+	natsConfig := &config.NatsConfig{
+		JetStreamURL:   "nats://127.0.0.1:1",
+		AckWaitMinutes: 1,
+		MaxInflight:    10,
+		ConnectionProfiles: map[string]natsutil.ConnectionProfile{
+			"eu-west": {URL: "nats://127.0.0.2:1"},
+		},
+	}
+	s.UpdateConfig(context.Background(), natsConfig)
+
+	euWestConn, err := s.getConnection("eu-west")
+	if err != nil {
+		t.Fatalf("getConnection(eu-west) unexpected error: %v", err)
+	}
+	if euWestConn.profile.URL != "nats://127.0.0.2:1" {
+		t.Errorf("eu-west URL = %q, want nats://127.0.0.2:1", euWestConn.profile.URL)
+	}
+	if conn, _ := s.getConnection(natsutil.DefaultConnectionProfile); conn != defaultConn {
+		t.Error("the default connection was replaced although its profile didn't change")
+	}
+
+	// Changing the default server replaces its connection only, removing a profile drops its connection.
+	natsConfig.JetStreamURL = "nats://127.0.0.3:1"
+	natsConfig.ConnectionProfiles = nil
+	s.UpdateConfig(context.Background(), natsConfig)
+
+	conn, err := s.getConnection(natsutil.DefaultConnectionProfile)
+	if err != nil {
+		t.Fatalf("getConnection() unexpected error: %v", err)
+	}
+	if conn == defaultConn || conn.profile.URL != "nats://127.0.0.3:1" {
+		t.Errorf("default connection URL = %q, want a new connection to nats://127.0.0.3:1", conn.profile.URL)
+	}
+	if _, err := s.getConnection("eu-west"); err == nil {
+		t.Error("getConnection(eu-west) expected an error for a removed profile")
+	}
+}
+
+func TestJetStreamConsumerConfig(t *testing.T) {
+	d, err := NewJetStreamDispatcher(JetArgs{
+		JetStreamURL:   "nats://127.0.0.1:1",
+		AckWaitMinutes: 1,
+		MaxInflight:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := d.(*jetSubscriptionsSupervisor)
+
+	testCases := map[string]struct {
+		ordering v1alpha1.DeliveryOrdering
+		want     nats.ConsumerConfig
+	}{
+		"unordered": {
+			ordering: v1alpha1.UnorderedDeliveryOrdering,
+			want:     nats.ConsumerConfig{AckWait: time.Minute, MaxAckPending: 10, MaxDeliver: 3},
+		},
+		"ordered": {
+			ordering: v1alpha1.OrderedDeliveryOrdering,
+			want:     nats.ConsumerConfig{AckWait: time.Minute, MaxAckPending: 1, MaxDeliver: 3},
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, s.consumerConfig(3, tc.ordering)); diff != "" {
+				t.Errorf("consumerConfig() (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestDispatchSettings(t *testing.T) {
+	keyOrdered := SubscriberConfig{PartitionKeyExtension: "orderid", Partitions: 4}
+
+	if got := (ChannelConfig{}).dispatchSettings(keyOrdered); !got.keyOrdered() || got.partitionKeyExtension != "orderid" || got.partitions != 4 {
+		t.Errorf("dispatchSettings() of a key ordered subscriber = %+v, want the events key ordered by orderid over 4 partitions", got)
+	}
+	if got := (ChannelConfig{}).dispatchSettings(SubscriberConfig{}); got.keyOrdered() {
+		t.Errorf("dispatchSettings() of a subscriber which didn't opt into key ordering = %+v, want the events not key ordered", got)
+	}
+	pull := SubscriberConfig{PullConsumer: &PullConsumerConfig{BatchSize: 10, FetchTimeout: time.Second, Workers: 4}}
+	if got := (ChannelConfig{}).dispatchSettings(pull); !got.pullMode() || got.pull != *pull.PullConsumer {
+		t.Errorf("dispatchSettings() of a pulling subscriber = %+v, want the pull consumer settings of the subscriber", got)
+	}
+	if got := (ChannelConfig{}).dispatchSettings(SubscriberConfig{}); got.pullMode() {
+		t.Errorf("dispatchSettings() of a subscriber without pull annotations = %+v, want push mode", got)
+	}
+	// The events of ordered channels are delivered one at a time to every subscriber.
+	if got := (ChannelConfig{DeliveryOrdering: v1alpha1.OrderedDeliveryOrdering}).dispatchSettings(keyOrdered); got.keyOrdered() {
+		t.Errorf("dispatchSettings() of a key ordered subscriber of an ordered channel = %+v, want the events not key ordered", got)
+	}
+}
+
+func TestJetSubscriptionOutdated(t *testing.T) {
+	subscriberURI := apis.HTTP("subscriber.example.com")
+	deadLetterURI := apis.HTTP("dls.example.com")
+	subscriber := newSubscriptionReference(eventingduckv1.SubscriberSpec{
+		UID:           "sub-uid",
+		Generation:    1,
+		SubscriberURI: subscriberURI,
+	})
+	settings := ChannelConfig{}.dispatchSettings(SubscriberConfig{})
+	sub := &jetSubscription{ref: subscriber, settings: settings}
+
+	testCases := map[string]struct {
+		subscriber subscriptionReference
+		settings   dispatchSettings
+		want       bool
+	}{
+		"unchanged": {
+			subscriber: newSubscriptionReference(eventingduckv1.SubscriberSpec{
+				UID:           "sub-uid",
+				Generation:    1,
+				SubscriberURI: apis.HTTP("subscriber.example.com"),
+			}),
+			settings: settings,
+		},
+		"dead letter sink resolved after subscribe": {
+			subscriber: newSubscriptionReference(eventingduckv1.SubscriberSpec{
+				UID:           "sub-uid",
+				Generation:    1,
+				SubscriberURI: subscriberURI,
+				Delivery: &eventingduckv1.DeliverySpec{
+					DeadLetterSink: &duckv1.Destination{URI: deadLetterURI},
+				},
+			}),
+			settings: settings,
+			want:     true,
+		},
+		"subscriber URI changed": {
+			subscriber: newSubscriptionReference(eventingduckv1.SubscriberSpec{
+				UID:           "sub-uid",
+				Generation:    2,
+				SubscriberURI: apis.HTTP("other.example.com"),
+			}),
+			settings: settings,
+			want:     true,
+		},
+		"retries changed": {
+			subscriber: newSubscriptionReference(eventingduckv1.SubscriberSpec{
+				UID:           "sub-uid",
+				Generation:    2,
+				SubscriberURI: subscriberURI,
+				Delivery:      &eventingduckv1.DeliverySpec{Retry: pointer.Int32Ptr(5)},
+			}),
+			settings: settings,
+			want:     true,
+		},
+		"dispatch settings changed": {
+			subscriber: subscriber,
+			settings:   ChannelConfig{DeliveryOrdering: v1alpha1.OrderedDeliveryOrdering}.dispatchSettings(SubscriberConfig{}),
+			want:       true,
+		},
+		"subscriber opted into key ordering": {
+			subscriber: subscriber,
+			settings:   ChannelConfig{}.dispatchSettings(SubscriberConfig{PartitionKeyExtension: "orderid"}),
+			want:       true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := sub.outdated(tc.subscriber, tc.settings); got != tc.want {
+				t.Errorf("outdated() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// fakeNatsSubscription counts the drains of a NATS subscription.
+type fakeNatsSubscription struct {
+	drains int32
+}
+
+func (s *fakeNatsSubscription) Drain() error {
+	atomic.AddInt32(&s.drains, 1)
+	return nil
+}
+
+func (s *fakeNatsSubscription) ConsumerInfo() (*nats.ConsumerInfo, error) {
+	return &nats.ConsumerInfo{}, nil
+}
+
+func TestPauseWhileOpen(t *testing.T) {
+	defer func(threshold int, interval time.Duration) {
+		circuitFailureThreshold, circuitProbeInterval = threshold, interval
+	}(circuitFailureThreshold, circuitProbeInterval)
+	circuitFailureThreshold, circuitProbeInterval = 1, time.Hour
+
+	first := &fakeNatsSubscription{}
+	resubscribed := make(chan *fakeNatsSubscription, 1)
+	sub := &jetSubscription{sub: first, resubscribe: func() (natsSubscription, error) {
+		s := &fakeNatsSubscription{}
+		resubscribed <- s
+		return s, nil
+	}}
+	breaker := newCircuitBreaker(func(bool) {})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pauseWhileOpen(ctx, sub, breaker, zap.NewNop())
+		close(done)
+	}()
+
+	// The subscription is drained when the circuit opens, and not resubscribed while it's open.
+	breaker.record(false)
+	waitFor(t, "the subscription to be paused", func() bool { return atomic.LoadInt32(&first.drains) == 1 })
+	select {
+	case <-resubscribed:
+		t.Fatal("resubscribed while the circuit is open")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// The consumer is subscribed to again when the circuit closes.
+	breaker.record(true)
+	var second *fakeNatsSubscription
+	select {
+	case second = <-resubscribed:
+	case <-time.After(time.Second):
+		t.Fatal("not resubscribed once the circuit closed")
+	}
+	info, err := sub.consumerInfo()
+	if err != nil || info == nil {
+		t.Errorf("consumerInfo() = %v, %v once resumed", info, err)
+	}
+
+	// Draining a paused subscription doesn't drain the NATS subscription again.
+	breaker.record(false)
+	waitFor(t, "the subscription to be paused again", func() bool { return atomic.LoadInt32(&second.drains) == 1 })
+	if err := sub.drain(); err != nil {
+		t.Errorf("drain() = %v", err)
+	}
+	if got := atomic.LoadInt32(&second.drains); got != 1 {
+		t.Errorf("NATS subscription drained %d times, want 1", got)
+	}
+	breaker.record(true)
+	select {
+	case <-resubscribed:
+		t.Error("resubscribed once drained")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pauseWhileOpen() didn't return once the context was done")
+	}
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
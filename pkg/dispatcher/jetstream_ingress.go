@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	jsmcloudevents "github.com/cloudevents/sdk-go/protocol/nats_jetstream/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+
+	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
+	"knative.dev/eventing-natss/pkg/natsutil"
+	"knative.dev/eventing/pkg/tracing"
+)
+
+const (
+	// ingressPort is the port the events sent to the channels are received on.
+	ingressPort = 8080
+
+	// StatusStreamLimitExceeded is the status of the response to an event the stream of the channel rejected
+	// because it reached its limits, so that producers can tell it apart from other failures.
+	StatusStreamLimitExceeded = http.StatusInsufficientStorage
+
+	// StatusStreamNotFound is the status of the response to an event sent to a channel whose stream doesn't
+	// exist, until the controller creates it.
+	StatusStreamNotFound = http.StatusServiceUnavailable
+)
+
+// streamLimitExceededError is returned when the stream of a channel rejects an event because of its limits.
+type streamLimitExceededError struct {
+	err error
+}
+
+func (e *streamLimitExceededError) Error() string {
+	return fmt.Sprintf("stream limits exceeded: %v", e.err)
+}
+
+func (e *streamLimitExceededError) Unwrap() error {
+	return e.err
+}
+
+// streamNotFoundError is returned when an event is sent to a channel whose stream doesn't exist.
+type streamNotFoundError struct {
+	subject string
+}
+
+func (e *streamNotFoundError) Error() string {
+	return fmt.Sprintf("no stream captures subject %s", e.subject)
+}
+
+// ingressStatusKey is the context key of the status of the response to an event, set when the receiver function
+// fails with an error which isn't an internal one.
+type ingressStatusKey struct{}
+
+// setIngressStatus sets the status of the response to the event received with ctx, when publishing it fails.
+func setIngressStatus(ctx context.Context, status int) {
+	if s, ok := ctx.Value(ingressStatusKey{}).(*int); ok {
+		*s = status
+	}
+}
+
+// ingressHandler receives the events sent to the channels. The MessageReceiver answers every error of the
+// receiver function with 500, which is replaced by the status set with setIngressStatus.
+type ingressHandler struct {
+	next http.Handler
+}
+
+func (h *ingressHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := new(int)
+	ctx := context.WithValue(r.Context(), ingressStatusKey{}, status)
+	h.next.ServeHTTP(&ingressResponseWriter{ResponseWriter: w, status: status}, r.WithContext(ctx))
+}
+
+type ingressResponseWriter struct {
+	http.ResponseWriter
+	status *int
+}
+
+func (w *ingressResponseWriter) WriteHeader(code int) {
+	if code == http.StatusInternalServerError && *w.status != 0 {
+		code = *w.status
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// messageID returns the ID the stream deduplicates the event by, or an empty string if it shouldn't be.
+func messageID(e *event.Event, source v1alpha1.MessageIDSource) string {
+	switch source {
+	case v1alpha1.NoneMessageIDSource:
+		return ""
+	case v1alpha1.CloudEventSourceAndIDMessageIDSource:
+		// The length of the source keeps the ID unambiguous, whatever characters the source and the ID contain.
+		return fmt.Sprintf("%d:%s%s", len(e.Source()), e.Source(), e.ID())
+	default:
+		return e.ID()
+	}
+}
+
+// publishEvent publishes an event sent to a channel to its stream with the sender of the channel, with the message
+// ID it's deduplicated by and the trace context of the publish span. The message is finished once the event is
+// published. The event is returned once it was read from the message, even if it couldn't be published.
+func publishEvent(ctx context.Context, sender *jetSender, idSource v1alpha1.MessageIDSource, message binding.Message, transformers ...binding.Transformer) (e *event.Event, ack *nats.PubAck, err error) {
+	ctx, span := trace.StartSpan(ctx, publishSpanName, trace.WithSpanKind(trace.SpanKindClient))
+	span.AddAttributes(messagingAttributes(sender.subject)...)
+	defer func() {
+		if err2 := message.Finish(err); err2 != nil && err == nil {
+			err = err2
+		}
+		endSpan(span, err)
+	}()
+
+	e, err = binding.ToEvent(ctx, message, transformers...)
+	if err != nil {
+		return nil, nil, err
+	}
+	writer := new(bytes.Buffer)
+	if err := jsmcloudevents.WriteMsg(ctx, binding.ToMessage(e), writer); err != nil {
+		return e, nil, err
+	}
+
+	msg := nats.NewMsg("")
+	msg.Data = writer.Bytes()
+	if id := messageID(e, idSource); id != "" {
+		msg.Header.Set(nats.MsgIdHdr, id)
+	}
+	span.AddAttributes(tracing.MessagingMessageIDAttribute(e.ID()))
+	injectTraceContext(ctx, msg)
+	ack, err = sender.publish(ctx, msg)
+	if natsutil.IsStreamLimitExceeded(err) {
+		return e, nil, &streamLimitExceededError{err: err}
+	}
+	if errors.Is(err, nats.ErrNoResponders) {
+		// JetStream doesn't answer publishes to subjects no stream captures.
+		return e, nil, &streamNotFoundError{subject: sender.subject}
+	}
+	return e, ack, err
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+
+	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
+)
+
+func TestMessageID(t *testing.T) {
+	e := event.New()
+	e.SetID("abc-123")
+	e.SetSource("/orders")
+
+	testCases := map[string]struct {
+		source v1alpha1.MessageIDSource
+		want   string
+	}{
+		"default": {
+			want: "abc-123",
+		},
+		"cloudevent id": {
+			source: v1alpha1.CloudEventIDMessageIDSource,
+			want:   "abc-123",
+		},
+		"cloudevent source and id": {
+			source: v1alpha1.CloudEventSourceAndIDMessageIDSource,
+			want:   "7:/ordersabc-123",
+		},
+		"none": {
+			source: v1alpha1.NoneMessageIDSource,
+			want:   "",
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if got := messageID(&e, tc.source); got != tc.want {
+				t.Errorf("messageID() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIngressHandler(t *testing.T) {
+	testCases := map[string]struct {
+		status     int
+		ingress    int
+		wantStatus int
+	}{
+		"accepted": {
+			status:     http.StatusAccepted,
+			wantStatus: http.StatusAccepted,
+		},
+		"internal error": {
+			status:     http.StatusInternalServerError,
+			wantStatus: http.StatusInternalServerError,
+		},
+		"stream limits exceeded": {
+			status:     http.StatusInternalServerError,
+			ingress:    StatusStreamLimitExceeded,
+			wantStatus: StatusStreamLimitExceeded,
+		},
+		"stream not found": {
+			status:     http.StatusInternalServerError,
+			ingress:    StatusStreamNotFound,
+			wantStatus: StatusStreamNotFound,
+		},
+		"unknown channel": {
+			status:     http.StatusNotFound,
+			ingress:    StatusStreamLimitExceeded,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			handler := &ingressHandler{next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.ingress != 0 {
+					setIngressStatus(r.Context(), tc.ingress)
+				}
+				w.WriteHeader(tc.status)
+			})}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+		})
+	}
+}
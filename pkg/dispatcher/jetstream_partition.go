@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	jsmcloudevents "github.com/cloudevents/sdk-go/protocol/nats_jetstream/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"github.com/nats-io/nats.go"
+)
+
+// keyedWorkers handles messages on a fixed set of workers. The worker of a message is picked by its partition key,
+// so that the messages with the same key are handled one after the other, in the order they were received, while
+// the messages with different keys are handled concurrently. The messages queued to a worker are reported in
+// progress while they wait, so that JetStream doesn't redeliver them.
+type keyedWorkers struct {
+	// mux protects the queues of the workers. They aren't bounded, the consumer doesn't deliver more messages
+	// than its max ack pending.
+	mux    sync.Mutex
+	queues [][]*nats.Msg
+	// ready wakes up the worker of a queue when a message is queued to it.
+	ready []chan struct{}
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// newKeyedWorkers starts the given number of workers calling handle with the messages queued to them. progress is
+// called with the queued messages every progressInterval, while they wait for the messages ahead of them.
+func newKeyedWorkers(workers int, handle func(*nats.Msg), progress func(*nats.Msg)) *keyedWorkers {
+	if workers < 1 {
+		workers = 1
+	}
+	w := &keyedWorkers{
+		queues: make([][]*nats.Msg, workers),
+		ready:  make([]chan struct{}, workers),
+		stop:   make(chan struct{}),
+	}
+	for i := range w.queues {
+		w.ready[i] = make(chan struct{}, 1)
+		go w.work(i, handle)
+	}
+	go w.reportProgress(progress, progressInterval)
+	return w
+}
+
+// work handles the messages of queue i until the workers are closed.
+func (w *keyedWorkers) work(i int, handle func(*nats.Msg)) {
+	for {
+		select {
+		case <-w.ready[i]:
+		case <-w.stop:
+			return
+		}
+		for {
+			w.mux.Lock()
+			if len(w.queues[i]) == 0 || w.stopped() {
+				w.mux.Unlock()
+				break
+			}
+			msg := w.queues[i][0]
+			w.queues[i][0] = nil
+			w.queues[i] = w.queues[i][1:]
+			w.mux.Unlock()
+			handle(msg)
+		}
+	}
+}
+
+// dispatch queues msg to the worker of its partition key, it doesn't block. Messages dispatched after the workers
+// are closed are dropped, they are redelivered by JetStream since they aren't acknowledged.
+func (w *keyedWorkers) dispatch(key string, msg *nats.Msg) {
+	if w.stopped() {
+		return
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	i := h.Sum32() % uint32(len(w.queues))
+	w.mux.Lock()
+	w.queues[i] = append(w.queues[i], msg)
+	w.mux.Unlock()
+	select {
+	case w.ready[i] <- struct{}{}:
+	default:
+	}
+}
+
+// reportProgress calls progress with the queued messages every interval, until the workers are closed.
+func (w *keyedWorkers) reportProgress(progress func(*nats.Msg), interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.stop:
+			return
+		}
+		var queued []*nats.Msg
+		w.mux.Lock()
+		for _, queue := range w.queues {
+			queued = append(queued, queue...)
+		}
+		w.mux.Unlock()
+		for _, msg := range queued {
+			progress(msg)
+		}
+	}
+}
+
+func (w *keyedWorkers) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops the workers once they're done with the message they're handling.
+func (w *keyedWorkers) close() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+}
+
+// partitionKey returns the value of the given CloudEvent extension of the event in msg, or an empty string if
+// the event doesn't have it.
+func partitionKey(msg *nats.Msg, extension string) string {
+	e, err := binding.ToEvent(context.Background(), jsmcloudevents.NewMessage(msg))
+	if err != nil {
+		return ""
+	}
+	value, ok := e.Extensions()[extension]
+	if !ok {
+		return ""
+	}
+	key, err := types.Format(value)
+	if err != nil {
+		return ""
+	}
+	return key
+}
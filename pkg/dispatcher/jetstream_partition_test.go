@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nats-io/nats.go"
+)
+
+func TestKeyedWorkers(t *testing.T) {
+	const keys, messagesPerKey = 5, 20
+
+	var (
+		mux      sync.Mutex
+		received = make(map[string][]int)
+		wg       sync.WaitGroup
+	)
+	wg.Add(keys * messagesPerKey)
+	workers := newKeyedWorkers(3, func(msg *nats.Msg) {
+		defer wg.Done()
+		n, _ := strconv.Atoi(string(msg.Data))
+		mux.Lock()
+		received[msg.Subject] = append(received[msg.Subject], n)
+		mux.Unlock()
+	}, func(*nats.Msg) {})
+	defer workers.close()
+
+	for i := 0; i < messagesPerKey; i++ {
+		for k := 0; k < keys; k++ {
+			key := fmt.Sprintf("key-%d", k)
+			workers.dispatch(key, &nats.Msg{Subject: key, Data: []byte(strconv.Itoa(i))})
+		}
+	}
+	wg.Wait()
+
+	want := make([]int, messagesPerKey)
+	for i := range want {
+		want[i] = i
+	}
+	for k := 0; k < keys; k++ {
+		key := fmt.Sprintf("key-%d", k)
+		if diff := cmp.Diff(want, received[key]); diff != "" {
+			t.Errorf("messages of %s (-want, +got) = %v", key, diff)
+		}
+	}
+}
+
+func TestKeyedWorkersClosed(t *testing.T) {
+	workers := newKeyedWorkers(1, func(*nats.Msg) {
+		t.Error("message handled after the workers were closed")
+	}, func(*nats.Msg) {})
+	workers.close()
+	workers.close()
+
+	// Dispatching to closed workers must neither block nor panic.
+	for i := 0; i < 10; i++ {
+		workers.dispatch("key", &nats.Msg{})
+	}
+}
+
+func TestKeyedWorkersProgress(t *testing.T) {
+	defer func(interval time.Duration) { progressInterval = interval }(progressInterval)
+	progressInterval = 10 * time.Millisecond
+
+	var (
+		mux      sync.Mutex
+		progress = make(map[*nats.Msg]int)
+	)
+	handling, release := make(chan struct{}), make(chan struct{})
+	workers := newKeyedWorkers(1, func(*nats.Msg) {
+		handling <- struct{}{}
+		<-release
+	}, func(msg *nats.Msg) {
+		mux.Lock()
+		progress[msg]++
+		mux.Unlock()
+	})
+	defer workers.close()
+
+	slow, queued := &nats.Msg{Subject: "slow"}, &nats.Msg{Subject: "queued"}
+	workers.dispatch("key", slow)
+	<-handling
+	workers.dispatch("key", queued)
+	time.Sleep(5 * progressInterval)
+
+	mux.Lock()
+	if progress[queued] == 0 {
+		t.Error("the message queued behind the one being handled wasn't reported in progress")
+	}
+	if progress[slow] != 0 {
+		t.Error("the message being handled was reported in progress by the workers")
+	}
+	mux.Unlock()
+
+	close(release)
+	<-handling
+}
+
+func TestPartitionKey(t *testing.T) {
+	testCases := map[string]struct {
+		data      string
+		extension string
+		want      string
+	}{
+		"string key": {
+			data:      `{"specversion":"1.0","id":"1","source":"/orders","type":"order.created","partitionkey":"order-42"}`,
+			extension: "partitionkey",
+			want:      "order-42",
+		},
+		"custom extension": {
+			data:      `{"specversion":"1.0","id":"1","source":"/orders","type":"order.created","orderid":"42"}`,
+			extension: "orderid",
+			want:      "42",
+		},
+		"missing extension": {
+			data:      `{"specversion":"1.0","id":"1","source":"/orders","type":"order.created"}`,
+			extension: "partitionkey",
+			want:      "",
+		},
+		"not an event": {
+			data:      `not json`,
+			extension: "partitionkey",
+			want:      "",
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if got := partitionKey(&nats.Msg{Data: []byte(tc.data)}, tc.extension); got != tc.want {
+				t.Errorf("partitionKey() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
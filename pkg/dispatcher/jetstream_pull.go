@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// pullRetryInterval is how long the dispatcher waits before fetching again, after a fetch failed.
+var pullRetryInterval = 1 * time.Second
+
+// fetcher fetches the messages of a pull subscription.
+type fetcher interface {
+	Fetch(batch int, opts ...nats.PullOpt) ([]*nats.Msg, error)
+	IsValid() bool
+}
+
+// startPulling fetches the messages of sub in batches and hands them to handle, until the returned function is
+// called or the subscription is closed. With concurrent, the messages are handled on up to config.Workers
+// goroutines, and a batch is only fetched once a worker is free. Otherwise they're handled one after the other.
+// Unless it's nil, gate is called before every fetch and blocks while no messages should be fetched, the pulling
+// stops if it returns an error.
+func startPulling(sub fetcher, config PullConsumerConfig, handle func(*nats.Msg), concurrent bool, gate func(context.Context) error, logger *zap.Logger) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	workers := make(chan struct{}, config.Workers)
+
+	go func() {
+		for {
+			if concurrent {
+				// Wait for a free worker, so that messages aren't fetched while none can be handled.
+				select {
+				case workers <- struct{}{}:
+					<-workers
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if gate != nil {
+				if err := gate(ctx); err != nil {
+					return
+				}
+			}
+
+			fetchCtx, fetchCancel := context.WithTimeout(ctx, config.FetchTimeout)
+			msgs, err := sub.Fetch(config.BatchSize, nats.Context(fetchCtx))
+			fetchCancel()
+			switch {
+			case ctx.Err() != nil:
+				return
+			case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout):
+				continue
+			case err != nil:
+				if !sub.IsValid() {
+					return
+				}
+				logger.Warn("Failed to fetch messages", zap.Error(err))
+				select {
+				case <-time.After(pullRetryInterval):
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			for _, msg := range msgs {
+				if !concurrent {
+					handle(msg)
+					continue
+				}
+				select {
+				case workers <- struct{}{}:
+				case <-ctx.Done():
+					// The messages which weren't handled are redelivered by JetStream.
+					return
+				}
+				go func(msg *nats.Msg) {
+					defer func() { <-workers }()
+					handle(msg)
+				}(msg)
+			}
+		}
+	}()
+	return cancel
+}
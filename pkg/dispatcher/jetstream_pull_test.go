@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// fakeFetcher returns the queued messages in batches, and times out once there are none left.
+type fakeFetcher struct {
+	mux     sync.Mutex
+	msgs    []*nats.Msg
+	batches []int
+}
+
+func (f *fakeFetcher) Fetch(batch int, _ ...nats.PullOpt) ([]*nats.Msg, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if len(f.msgs) == 0 {
+		time.Sleep(time.Millisecond)
+		return nil, nats.ErrTimeout
+	}
+	if batch > len(f.msgs) {
+		batch = len(f.msgs)
+	}
+	msgs := f.msgs[:batch]
+	f.msgs = f.msgs[batch:]
+	f.batches = append(f.batches, len(msgs))
+	return msgs, nil
+}
+
+func (f *fakeFetcher) IsValid() bool {
+	return true
+}
+
+func newFakeFetcher(n int) *fakeFetcher {
+	f := &fakeFetcher{}
+	for i := 0; i < n; i++ {
+		f.msgs = append(f.msgs, &nats.Msg{Data: []byte(strconv.Itoa(i))})
+	}
+	return f
+}
+
+func TestStartPullingInOrder(t *testing.T) {
+	const messages = 25
+	f := newFakeFetcher(messages)
+
+	var received []string
+	done := make(chan struct{})
+	stop := startPulling(f, PullConsumerConfig{BatchSize: 10, FetchTimeout: time.Second, Workers: 4}, func(msg *nats.Msg) {
+		received = append(received, string(msg.Data))
+		if len(received) == messages {
+			close(done)
+		}
+	}, false, nil, zap.NewNop())
+	defer stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the messages")
+	}
+	for i, data := range received {
+		if data != strconv.Itoa(i) {
+			t.Fatalf("received %v, want the messages in order", received)
+		}
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if len(f.batches) != 3 || f.batches[0] != 10 || f.batches[2] != 5 {
+		t.Errorf("fetched batches %v, want [10 10 5]", f.batches)
+	}
+}
+
+func TestStartPullingConcurrent(t *testing.T) {
+	const messages, workers = 50, 3
+	f := newFakeFetcher(messages)
+
+	var (
+		running, maxRunning int32
+		wg                  sync.WaitGroup
+	)
+	wg.Add(messages)
+	stop := startPulling(f, PullConsumerConfig{BatchSize: 10, FetchTimeout: time.Second, Workers: workers}, func(msg *nats.Msg) {
+		defer wg.Done()
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}, true, nil, zap.NewNop())
+	defer stop()
+
+	wg.Wait()
+	if max := atomic.LoadInt32(&maxRunning); max > workers {
+		t.Errorf("handled %d messages concurrently, want at most %d", max, workers)
+	}
+}
+
+func TestStartPullingStop(t *testing.T) {
+	f := newFakeFetcher(0)
+	stop := startPulling(f, PullConsumerConfig{BatchSize: 10, FetchTimeout: time.Second, Workers: 1}, func(*nats.Msg) {
+		t.Error("unexpected message")
+	}, true, nil, zap.NewNop())
+	stop()
+
+	// Messages queued after stopping aren't fetched.
+	time.Sleep(10 * time.Millisecond)
+	f.mux.Lock()
+	f.msgs = append(f.msgs, &nats.Msg{})
+	f.mux.Unlock()
+	time.Sleep(10 * time.Millisecond)
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if len(f.batches) != 0 {
+		t.Errorf("fetched batches %v after stopping", f.batches)
+	}
+}
+
+func TestStartPullingGate(t *testing.T) {
+	f := newFakeFetcher(3)
+	var received int32
+	open := make(chan struct{})
+	gate := func(ctx context.Context) error {
+		select {
+		case <-open:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	stop := startPulling(f, PullConsumerConfig{BatchSize: 10, FetchTimeout: time.Second, Workers: 1}, func(*nats.Msg) {
+		atomic.AddInt32(&received, 1)
+	}, true, gate, zap.NewNop())
+	defer stop()
+
+	// No messages are fetched while the gate is closed.
+	time.Sleep(10 * time.Millisecond)
+	f.mux.Lock()
+	batches := len(f.batches)
+	f.mux.Unlock()
+	if batches != 0 {
+		t.Fatalf("fetched %d batches while the gate is closed", batches)
+	}
+
+	close(open)
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&received) != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d messages once the gate opened, want 3", atomic.LoadInt32(&received))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
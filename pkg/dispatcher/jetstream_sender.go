@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+
+	"knative.dev/eventing-natss/pkg/natsutil"
+)
+
+// publishAckTimeout is how long a publish waits for its ack before failing, unless the request is done earlier.
+var publishAckTimeout = 5 * time.Second
+
+// jetSender publishes the events sent to a channel to its stream. The events are published asynchronously on the
+// JetStream context of the connection of the channel, shared by the senders of all its channels, so that
+// concurrent publishes don't wait for one another, while every publish still waits for its own ack.
+type jetSender struct {
+	conn    *jetConnection
+	subject string
+	// inflight bounds the publishes of the channel waiting for their ack.
+	inflight chan struct{}
+}
+
+func newJetSender(conn *jetConnection, subject string) *jetSender {
+	return &jetSender{
+		conn:     conn,
+		subject:  subject,
+		inflight: make(chan struct{}, natsutil.MaxPending),
+	}
+}
+
+// usable returns true if the sender publishes on the given connection.
+func (s *jetSender) usable(conn *jetConnection) bool {
+	return s.conn == conn
+}
+
+// publish publishes msg to the subject of the sender, and waits for its ack until ctx is done.
+func (s *jetSender) publish(ctx context.Context, msg *nats.Msg) (*nats.PubAck, error) {
+	ctx, cancel := context.WithTimeout(ctx, publishAckTimeout)
+	defer cancel()
+
+	select {
+	case s.inflight <- struct{}{}:
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "too many events waiting for their ack")
+	}
+	defer func() { <-s.inflight }()
+
+	js, err := s.conn.publisher()
+	if err != nil {
+		return nil, err
+	}
+	msg.Subject = s.subject
+	future, err := js.PublishMsgAsync(msg)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case ack := <-future.Ok():
+		return ack, nil
+	case err := <-future.Err():
+		return nil, err
+	case <-ctx.Done():
+		s.conn.ackLost(js)
+		return nil, errors.Wrap(ctx.Err(), "no ack received")
+	}
+}
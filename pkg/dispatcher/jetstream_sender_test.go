@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	eventingchannels "knative.dev/eventing/pkg/channel"
+
+	"knative.dev/eventing-natss/pkg/natsutil"
+)
+
+func TestGetSender(t *testing.T) {
+	d, err := NewJetStreamDispatcher(JetArgs{
+		JetStreamURL:   "nats://127.0.0.1:1",
+		AckWaitMinutes: 1,
+		MaxInflight:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := d.(*jetSubscriptionsSupervisor)
+	channel := eventingchannels.ChannelReference{Namespace: "default", Name: "orders"}
+	conn, err := s.getConnection(natsutil.DefaultConnectionProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := s.getSender(channel, conn)
+	if sender.subject != getJetStreamSubject(channel) {
+		t.Errorf("subject = %q, want %q", sender.subject, getJetStreamSubject(channel))
+	}
+	if got := s.getSender(channel, conn); got != sender {
+		t.Error("getSender() created a new sender for the same connection")
+	}
+
+	// The connection is replaced when the connection profile of the channel changes.
+	otherConn := newJetConnection("eu-west", natsutil.ConnectionProfile{URL: "nats://127.0.0.1:1"}, zap.NewNop(), func(context.Context) {})
+	if got := s.getSender(channel, otherConn); got == sender {
+		t.Error("getSender() kept the sender of the previous connection")
+	}
+}
+
+func TestJetSenderInflightLimit(t *testing.T) {
+	conn := newJetConnection("eu-west", natsutil.ConnectionProfile{URL: "nats://127.0.0.1:1"}, zap.NewNop(), func(context.Context) {})
+	sender := newJetSender(conn, "KN_DEFAULT_ORDERS.events")
+	for i := 0; i < cap(sender.inflight); i++ {
+		sender.inflight <- struct{}{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := sender.publish(ctx, nats.NewMsg("")); err == nil {
+		t.Error("publish() expected an error while too many events wait for their ack")
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.opencensus.io/trace"
+	"knative.dev/eventing/pkg/tracing"
+	"knative.dev/pkg/tracing/propagation/tracecontextb3"
+)
+
+// The names of the spans of an event going through NATS JetStream.
+const (
+	// publishSpanName is the span of publishing an event to the stream of its channel.
+	publishSpanName = "nats.publish"
+	// waitSpanName is the span of an event received from the stream waiting for its delivery, for the rate limit or
+	// the circuit breaker of the subscriber.
+	waitSpanName = "nats.wait"
+	// deliverSpanName is the span of delivering an event received from the stream to a subscriber.
+	deliverSpanName = "nats.deliver"
+)
+
+const (
+	streamSequenceAttributeName = "nats.stream.sequence"
+	numDeliveredAttributeName   = "nats.delivered"
+	// streamTimeAttributeName is the time an event spent in the stream before it was received, in milliseconds. It
+	// can't be a span of its own, since spans can't start before they're created.
+	streamTimeAttributeName = "nats.stream.time_ms"
+)
+
+// traceFormat is the format of the trace context in the headers of the NATS messages, the same as in the headers of
+// the requests to the subscribers.
+var traceFormat = tracecontextb3.TraceContextEgress
+
+// injectTraceContext writes the trace context of the span of ctx to the headers of msg, so that the spans of its
+// delivery belong to the same trace.
+func injectTraceContext(ctx context.Context, msg *nats.Msg) {
+	span := trace.FromContext(ctx)
+	if span == nil {
+		return
+	}
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	traceFormat.SpanContextToRequest(span.SpanContext(), &http.Request{Header: http.Header(msg.Header)})
+}
+
+// extractTraceContext reads the trace context written to the headers of msg when it was published.
+func extractTraceContext(msg *nats.Msg) (trace.SpanContext, bool) {
+	if msg.Header == nil {
+		return trace.SpanContext{}, false
+	}
+	return traceFormat.SpanContextFromRequest(&http.Request{Header: http.Header(msg.Header)})
+}
+
+// startMessageSpan starts a span of handling msg, as a child of the span it was published in if it carries one.
+func startMessageSpan(ctx context.Context, name string, msg *nats.Msg) (context.Context, *trace.Span) {
+	if sc, ok := extractTraceContext(msg); ok {
+		return trace.StartSpanWithRemoteParent(ctx, name, sc)
+	}
+	return trace.StartSpan(ctx, name)
+}
+
+// startWaitSpan starts the span of msg waiting for its delivery, with the time it spent in the stream.
+func startWaitSpan(ctx context.Context, msg *nats.Msg, meta *nats.MsgMetadata) (context.Context, *trace.Span) {
+	ctx, span := startMessageSpan(ctx, waitSpanName, msg)
+	span.AddAttributes(append(messagingAttributes(msg.Subject),
+		trace.Int64Attribute(streamSequenceAttributeName, int64(meta.Sequence.Stream)),
+		trace.Int64Attribute(numDeliveredAttributeName, int64(meta.NumDelivered)),
+		trace.Int64Attribute(streamTimeAttributeName, int64(time.Since(meta.Timestamp)/time.Millisecond)),
+	)...)
+	return ctx, span
+}
+
+func messagingAttributes(subject string) []trace.Attribute {
+	return []trace.Attribute{
+		trace.StringAttribute(tracing.MessagingSystemAttributeName, "nats"),
+		tracing.MessagingProtocolAttribute("NATS JetStream"),
+		trace.StringAttribute(tracing.MessagingDestinationAttributeName, subject),
+	}
+}
+
+// endSpan ends span with the outcome of the operation it spans.
+func endSpan(span *trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+	span.End()
+}
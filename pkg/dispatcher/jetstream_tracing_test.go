@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"go.opencensus.io/trace"
+)
+
+// TestTraceContextPropagation checks that the spans of the delivery of a message belong to the trace it was
+// published in.
+func TestTraceContextPropagation(t *testing.T) {
+	ctx, publishSpan := trace.StartSpan(context.Background(), publishSpanName, trace.WithSampler(trace.AlwaysSample()))
+	defer publishSpan.End()
+
+	msg := nats.NewMsg("subject")
+	msg.Header.Set(nats.MsgIdHdr, "id")
+	injectTraceContext(ctx, msg)
+	if got := msg.Header.Get(nats.MsgIdHdr); got != "id" {
+		t.Errorf("unexpected message ID header, got %q", got)
+	}
+
+	sc, ok := extractTraceContext(msg)
+	if !ok {
+		t.Fatal("no trace context in the headers of the message")
+	}
+	if sc.TraceID != publishSpan.SpanContext().TraceID || sc.SpanID != publishSpan.SpanContext().SpanID {
+		t.Errorf("unexpected trace context, want %v, got %v", publishSpan.SpanContext(), sc)
+	}
+
+	_, deliverSpan := startMessageSpan(context.Background(), deliverSpanName, msg)
+	defer deliverSpan.End()
+	if got := deliverSpan.SpanContext().TraceID; got != publishSpan.SpanContext().TraceID {
+		t.Errorf("the delivery span isn't part of the trace of the publish span, got trace %v", got)
+	}
+}
+
+// TestExtractTraceContextWithoutHeaders checks that messages published without trace context start a new trace.
+func TestExtractTraceContextWithoutHeaders(t *testing.T) {
+	for name, msg := range map[string]*nats.Msg{
+		"no headers":    {Subject: "subject"},
+		"other headers": nats.NewMsg("subject"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := extractTraceContext(msg); ok {
+				t.Error("unexpected trace context in the headers of the message")
+			}
+		})
+	}
+}
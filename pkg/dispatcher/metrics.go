@@ -0,0 +1,222 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"k8s.io/apimachinery/pkg/types"
+	eventingchannels "knative.dev/eventing/pkg/channel"
+	eventingmetrics "knative.dev/eventing/pkg/metrics"
+	"knative.dev/pkg/metrics"
+)
+
+// metricsReportInterval is how often the state of the connections and consumers is reported.
+var metricsReportInterval = 10 * time.Second
+
+// The results of publishing an event.
+const (
+	publishResultSuccess             = "success"
+	publishResultDuplicate           = "duplicate"
+	publishResultStreamLimitExceeded = "stream_limit_exceeded"
+	publishResultError               = "error"
+)
+
+var (
+	// publishTimeInMsecM records the time spent publishing an event to NATS, in milliseconds.
+	publishTimeInMsecM = stats.Float64(
+		"nats_publish_latencies",
+		"The time spent publishing an event to NATS",
+		stats.UnitMilliseconds,
+	)
+
+	// dispatchTimeInMsecM records the time spent dispatching an event received from NATS to a subscriber,
+	// in milliseconds.
+	dispatchTimeInMsecM = stats.Float64(
+		"nats_dispatch_latencies",
+		"The time spent dispatching an event received from NATS to a subscriber",
+		stats.UnitMilliseconds,
+	)
+
+	// redeliveryCountM is a counter which records the number of events NATS redelivered to a subscriber.
+	redeliveryCountM = stats.Int64(
+		"nats_redelivery_count",
+		"Number of events NATS redelivered to a subscriber",
+		stats.UnitDimensionless,
+	)
+
+	// consumerPendingM records the number of events of a stream the consumer of a subscriber didn't receive yet.
+	consumerPendingM = stats.Int64(
+		"nats_consumer_pending",
+		"Number of events of the stream the consumer of a subscriber didn't receive yet",
+		stats.UnitDimensionless,
+	)
+
+	// consumerAckPendingM records the number of events delivered to a subscriber which weren't acknowledged yet.
+	consumerAckPendingM = stats.Int64(
+		"nats_consumer_ack_pending",
+		"Number of events delivered to a subscriber which weren't acknowledged yet",
+		stats.UnitDimensionless,
+	)
+
+	// connectedM records whether the dispatcher is connected to NATS, 1 if it is and 0 otherwise.
+	connectedM = stats.Int64(
+		"nats_connected",
+		"Whether the dispatcher is connected to NATS",
+		stats.UnitDimensionless,
+	)
+
+	namespaceKey         = tag.MustNewKey(eventingmetrics.LabelNamespaceName)
+	channelKey           = tag.MustNewKey("channel_name")
+	subscriptionKey      = tag.MustNewKey("subscription_uid")
+	resultKey            = tag.MustNewKey("result")
+	responseCodeKey      = tag.MustNewKey(eventingmetrics.LabelResponseCode)
+	responseCodeClassKey = tag.MustNewKey(eventingmetrics.LabelResponseCodeClass)
+	connectionProfileKey = tag.MustNewKey("connection_profile")
+)
+
+func init() {
+	registerMetrics()
+}
+
+func registerMetrics() {
+	publishTagKeys := []tag.Key{namespaceKey, channelKey, resultKey}
+	dispatchTagKeys := []tag.Key{namespaceKey, channelKey, subscriptionKey, responseCodeKey, responseCodeClassKey}
+	subscriptionTagKeys := []tag.Key{namespaceKey, channelKey, subscriptionKey}
+
+	err := metrics.RegisterResourceView(
+		&view.View{
+			Description: publishTimeInMsecM.Description(),
+			Measure:     publishTimeInMsecM,
+			Aggregation: view.Distribution(metrics.Buckets125(1, 10000)...),
+			TagKeys:     publishTagKeys,
+		},
+		&view.View{
+			Name:        "nats_publish_count",
+			Description: "Number of events published to NATS",
+			Measure:     publishTimeInMsecM,
+			Aggregation: view.Count(),
+			TagKeys:     publishTagKeys,
+		},
+		&view.View{
+			Description: dispatchTimeInMsecM.Description(),
+			Measure:     dispatchTimeInMsecM,
+			Aggregation: view.Distribution(metrics.Buckets125(1, 10000)...),
+			TagKeys:     dispatchTagKeys,
+		},
+		&view.View{
+			Name:        "nats_dispatch_count",
+			Description: "Number of events dispatched from NATS to subscribers",
+			Measure:     dispatchTimeInMsecM,
+			Aggregation: view.Count(),
+			TagKeys:     dispatchTagKeys,
+		},
+		&view.View{
+			Description: redeliveryCountM.Description(),
+			Measure:     redeliveryCountM,
+			Aggregation: view.Count(),
+			TagKeys:     subscriptionTagKeys,
+		},
+		&view.View{
+			Description: consumerPendingM.Description(),
+			Measure:     consumerPendingM,
+			Aggregation: view.LastValue(),
+			TagKeys:     subscriptionTagKeys,
+		},
+		&view.View{
+			Description: consumerAckPendingM.Description(),
+			Measure:     consumerAckPendingM,
+			Aggregation: view.LastValue(),
+			TagKeys:     subscriptionTagKeys,
+		},
+		&view.View{
+			Description: connectedM.Description(),
+			Measure:     connectedM,
+			Aggregation: view.LastValue(),
+			TagKeys:     []tag.Key{connectionProfileKey},
+		},
+	)
+	if err != nil {
+		log.Print("failed to register opencensus views, " + err.Error())
+	}
+}
+
+// record records the measurements with the given tags, measurements which can't be tagged are dropped.
+func record(mutators []tag.Mutator, ms ...stats.Measurement) {
+	ctx, err := tag.New(context.Background(), mutators...)
+	if err != nil {
+		return
+	}
+	metrics.RecordBatch(ctx, ms...)
+}
+
+func channelTags(channel eventingchannels.ChannelReference, mutators ...tag.Mutator) []tag.Mutator {
+	return append([]tag.Mutator{
+		tag.Insert(namespaceKey, channel.Namespace),
+		tag.Insert(channelKey, channel.Name),
+	}, mutators...)
+}
+
+// reportPublish records the outcome of publishing an event sent to channel.
+func reportPublish(channel eventingchannels.ChannelReference, result string, d time.Duration) {
+	record(channelTags(channel, tag.Insert(resultKey, result)), publishTimeInMsecM.M(float64(d/time.Millisecond)))
+}
+
+// reportDispatch records the outcome of dispatching an event of channel to a subscriber.
+func reportDispatch(channel eventingchannels.ChannelReference, subscription types.UID, responseCode int, d time.Duration) {
+	record(channelTags(channel,
+		tag.Insert(subscriptionKey, string(subscription)),
+		tag.Insert(responseCodeKey, strconv.Itoa(responseCode)),
+		tag.Insert(responseCodeClassKey, metrics.ResponseCodeClass(responseCode)),
+	), dispatchTimeInMsecM.M(float64(d/time.Millisecond)))
+}
+
+// reportRedelivery records that an event of channel was redelivered to a subscriber.
+func reportRedelivery(channel eventingchannels.ChannelReference, subscription types.UID) {
+	record(channelTags(channel, tag.Insert(subscriptionKey, string(subscription))), redeliveryCountM.M(1))
+}
+
+// reportConsumer records the number of pending events of the consumer of a subscriber.
+func reportConsumer(channel eventingchannels.ChannelReference, subscription types.UID, pending, ackPending int64) {
+	record(channelTags(channel, tag.Insert(subscriptionKey, string(subscription))),
+		consumerPendingM.M(pending),
+		consumerAckPendingM.M(ackPending),
+	)
+}
+
+// reportConnection records whether the dispatcher is connected to the servers of a connection profile.
+func reportConnection(profile string, connected bool) {
+	var value int64
+	if connected {
+		value = 1
+	}
+	record([]tag.Mutator{tag.Insert(connectionProfileKey, profile)}, connectedM.M(value))
+}
+
+// dispatchResponseCode returns the response code of a dispatch, or NoResponse if there was none.
+func dispatchResponseCode(info *eventingchannels.DispatchExecutionInfo) int {
+	if info == nil {
+		return eventingchannels.NoResponse
+	}
+	return info.ResponseCode
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	eventingchannels "knative.dev/eventing/pkg/channel"
+	"knative.dev/pkg/metrics"
+)
+
+// rowTags returns the tags of a row of a view by name.
+func rowTags(row *view.Row) map[string]string {
+	tags := make(map[string]string, len(row.Tags))
+	for _, t := range row.Tags {
+		tags[t.Key.Name()] = t.Value
+	}
+	return tags
+}
+
+// findRow returns the row of a view with the given tags, or nil if there is none.
+func findRow(t *testing.T, name string, tags map[string]string) *view.Row {
+	t.Helper()
+	rows, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatalf("RetrieveData(%q) = %v", name, err)
+	}
+	for _, row := range rows {
+		got := rowTags(row)
+		match := true
+		for k, v := range tags {
+			if got[k] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			return row
+		}
+	}
+	return nil
+}
+
+func TestMetrics(t *testing.T) {
+	metrics.InitForTesting()
+
+	channel := eventingchannels.ChannelReference{Namespace: "metrics-ns", Name: "metrics-channel"}
+
+	reportPublish(channel, publishResultSuccess, 3*time.Millisecond)
+	reportPublish(channel, publishResultStreamLimitExceeded, time.Millisecond)
+	reportDispatch(channel, "sub", 503, 5*time.Millisecond)
+	reportRedelivery(channel, "sub")
+	reportRedelivery(channel, "sub")
+	reportConsumer(channel, "sub", 7, 2)
+	reportConnection("metrics-profile", true)
+
+	testCases := []struct {
+		view string
+		tags map[string]string
+		want float64
+	}{{
+		view: "nats_publish_count",
+		tags: map[string]string{"namespace_name": "metrics-ns", "channel_name": "metrics-channel", "result": "success"},
+		want: 1,
+	}, {
+		view: "nats_publish_count",
+		tags: map[string]string{"channel_name": "metrics-channel", "result": "stream_limit_exceeded"},
+		want: 1,
+	}, {
+		view: "nats_dispatch_count",
+		tags: map[string]string{"channel_name": "metrics-channel", "subscription_uid": "sub", "response_code": "503", "response_code_class": "5xx"},
+		want: 1,
+	}, {
+		view: "nats_redelivery_count",
+		tags: map[string]string{"channel_name": "metrics-channel", "subscription_uid": "sub"},
+		want: 2,
+	}, {
+		view: "nats_consumer_pending",
+		tags: map[string]string{"channel_name": "metrics-channel", "subscription_uid": "sub"},
+		want: 7,
+	}, {
+		view: "nats_consumer_ack_pending",
+		tags: map[string]string{"channel_name": "metrics-channel", "subscription_uid": "sub"},
+		want: 2,
+	}, {
+		view: "nats_connected",
+		tags: map[string]string{"connection_profile": "metrics-profile"},
+		want: 1,
+	}}
+
+	for _, tc := range testCases {
+		row := findRow(t, tc.view, tc.tags)
+		if row == nil {
+			t.Errorf("%s has no row with the tags %v", tc.view, tc.tags)
+			continue
+		}
+		var got float64
+		switch data := row.Data.(type) {
+		case *view.CountData:
+			got = float64(data.Value)
+		case *view.LastValueData:
+			got = data.Value
+		default:
+			t.Fatalf("%s has unexpected data %T", tc.view, row.Data)
+		}
+		if got != tc.want {
+			t.Errorf("%s%v = %v, want %v", tc.view, tc.tags, got, tc.want)
+		}
+	}
+
+	if row := findRow(t, "nats_publish_latencies", map[string]string{"result": "success", "channel_name": "metrics-channel"}); row == nil {
+		t.Error("nats_publish_latencies has no row for the published event")
+	}
+}
@@ -29,6 +29,7 @@ import (
 
 	natsscloudevents "github.com/cloudevents/sdk-go/protocol/stan/v2"
 	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/event"
 	"github.com/nats-io/stan.go"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -38,6 +39,7 @@ import (
 	eventingchannels "knative.dev/eventing/pkg/channel"
 	"knative.dev/eventing/pkg/kncloudevents"
 
+	"knative.dev/eventing-natss/pkg/config"
 	"knative.dev/eventing-natss/pkg/natsutil"
 )
 
@@ -51,7 +53,14 @@ var (
 	retryInterval = 1 * time.Second
 )
 
-type SubscriptionChannelMapping map[eventingchannels.ChannelReference]map[types.UID]*stan.Subscription
+// natssSubscription is the subscription of a subscriber to a channel. The subscriber is kept so that the
+// subscription can be re-established on a new connection.
+type natssSubscription struct {
+	stan.Subscription
+	ref subscriptionReference
+}
+
+type SubscriptionChannelMapping map[eventingchannels.ChannelReference]map[types.UID]*natssSubscription
 
 // subscriptionsSupervisor manages the state of NATS Streaming subscriptions
 type subscriptionsSupervisor struct {
@@ -62,13 +71,21 @@ type subscriptionsSupervisor struct {
 
 	subscriptionsMux sync.Mutex
 	subscriptions    SubscriptionChannelMapping
+	rateLimiters     *rateLimiters
+
+	// connectionStateChanged is called when the dispatcher connects to or disconnects from NATSS.
+	connectionStateChanged func(profile string)
 
-	connect        chan struct{}
+	connect    chan struct{}
+	connection natsutil.ConnectionConfig
+	clientID   string
+	// configMux protects the settings below, which are updated when the config-nats ConfigMap changes.
+	configMux      sync.RWMutex
 	natssURL       string
 	clusterID      string
-	clientID       string
 	ackWaitMinutes int
 	maxInflight    int
+	audit          *auditLogger
 	// natConnMux is used to protect natssConn and natssConnInProgress during
 	// the transition from not connected to connected states.
 	natssConnMux        sync.Mutex
@@ -80,6 +97,7 @@ type subscriptionsSupervisor struct {
 
 type Args struct {
 	NatssURL       string
+	Connection     natsutil.ConnectionConfig
 	ClusterID      string
 	ClientID       string
 	AckWaitMinutes int
@@ -87,6 +105,9 @@ type Args struct {
 	Cargs          kncloudevents.ConnectionArgs
 	Logger         *zap.Logger
 	Reporter       eventingchannels.StatsReporter
+	// ConnectionStateChanged is called when the dispatcher connects to or disconnects from NATSS, with the default
+	// connection profile.
+	ConnectionStateChanged func(profile string)
 }
 
 var _ NatsDispatcher = (*subscriptionsSupervisor)(nil)
@@ -96,17 +117,24 @@ func NewNatssDispatcher(args Args) (NatsDispatcher, error) {
 	if args.Logger == nil {
 		args.Logger = zap.NewNop()
 	}
+	if args.ConnectionStateChanged == nil {
+		args.ConnectionStateChanged = func(string) {}
+	}
 
 	d := &subscriptionsSupervisor{
-		logger:         args.Logger,
-		dispatcher:     eventingchannels.NewMessageDispatcher(args.Logger),
-		subscriptions:  make(SubscriptionChannelMapping),
-		connect:        make(chan struct{}, maxElements),
-		natssURL:       args.NatssURL,
-		clusterID:      args.ClusterID,
-		clientID:       args.ClientID,
-		ackWaitMinutes: args.AckWaitMinutes,
-		maxInflight:    args.MaxInflight,
+		logger:                 args.Logger,
+		dispatcher:             eventingchannels.NewMessageDispatcher(args.Logger),
+		subscriptions:          make(SubscriptionChannelMapping),
+		rateLimiters:           newRateLimiters(),
+		connectionStateChanged: args.ConnectionStateChanged,
+		audit:                  newAuditLogger(args.Logger),
+		connect:                make(chan struct{}, maxElements),
+		natssURL:               args.NatssURL,
+		connection:             args.Connection,
+		clusterID:              args.ClusterID,
+		clientID:               args.ClientID,
+		ackWaitMinutes:         args.AckWaitMinutes,
+		maxInflight:            args.MaxInflight,
 	}
 
 	receiver, err := eventingchannels.NewMessageReceiver(
@@ -133,7 +161,7 @@ func (s *subscriptionsSupervisor) signalReconnect() {
 
 func messageReceiverFunc(s *subscriptionsSupervisor) eventingchannels.UnbufferedMessageReceiverFunc {
 	return func(ctx context.Context, channel eventingchannels.ChannelReference, message binding.Message, transformers []binding.Transformer, header http.Header) error {
-		s.logger.Info("Received event", zap.String("channel", channel.String()))
+		s.logger.Debug("Received event", zap.String("channel", channel.String()))
 
 		s.natssConnMux.Lock()
 		currentNatssConn := s.natssConn
@@ -147,7 +175,22 @@ func messageReceiverFunc(s *subscriptionsSupervisor) eventingchannels.Unbuffered
 			s.logger.Error("could not create natss sender", zap.Error(err))
 			return errors.Wrap(err, "could not create natss sender")
 		}
+		// The message can only be read once, so the event is read before sending it when it's audited.
+		var audited *event.Event
+		if s.audit.isEnabled() {
+			e, err := binding.ToEvent(ctx, message)
+			_ = message.Finish(err)
+			if err != nil {
+				s.logger.Error("could not read the event", zap.Error(err))
+				return errors.Wrap(err, "could not read the event")
+			}
+			audited = s.audit.sample(e)
+			message = binding.ToMessage(e)
+		}
+		start := time.Now()
 		if err := sender.Send(ctx, message); err != nil {
+			reportPublish(channel, publishResultError, time.Since(start))
+			s.audit.record(audited, auditRejected, channel, "", zap.Error(err))
 			errMsg := "error during send"
 			if err.Error() == stan.ErrConnectionClosed.Error() {
 				errMsg += " - connection to NATSS has been lost, attempting to reconnect"
@@ -156,6 +199,8 @@ func messageReceiverFunc(s *subscriptionsSupervisor) eventingchannels.Unbuffered
 			s.logger.Error(errMsg, zap.Error(err))
 			return errors.Wrap(err, errMsg)
 		}
+		reportPublish(channel, publishResultSuccess, time.Since(start))
+		s.audit.record(audited, auditAccepted, channel, "")
 		s.logger.Debug("published", zap.String("channel", channel.String()))
 		return nil
 	}
@@ -166,21 +211,129 @@ func (s *subscriptionsSupervisor) Start(ctx context.Context) error {
 	go s.Connect(ctx)
 	// Trigger Connect to establish connection with NATS
 	s.signalReconnect()
+	// Reconnect with the new credentials and certificates whenever they're rotated
+	go natsutil.WatchConnectionConfig(ctx, s.connection, connectionConfigWatchInterval, s.reconnect)
+	go s.reportMetrics(ctx)
 	return s.receiver.Start(ctx)
 }
 
+// reportMetrics reports the state of the connection to NATSS periodically, until ctx is done. The changes of the
+// state of the connection are reported too.
+func (s *subscriptionsSupervisor) reportMetrics(ctx context.Context) {
+	ticker := time.NewTicker(metricsReportInterval)
+	defer ticker.Stop()
+	connected := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		isConnected := s.Ready(ctx) == nil
+		reportConnection(natsutil.DefaultConnectionProfile, isConnected)
+		if connected != isConnected {
+			connected = isConnected
+			s.connectionStateChanged(natsutil.DefaultConnectionProfile)
+		}
+	}
+}
+
+// reconnect replaces the connection to NATSS, for instance because the credentials it was established with
+// have been rotated. The subscriptions are re-established once the new connection is up.
+func (s *subscriptionsSupervisor) reconnect() {
+	s.logger.Info("NATSS connection configuration changed, reconnecting")
+	s.natssConnMux.Lock()
+	currentNatssConn := s.natssConn
+	s.natssConn = nil
+	s.natssConnMux.Unlock()
+	if currentNatssConn != nil {
+		// Closing the connection keeps the durable subscriptions on the server.
+		if err := (*currentNatssConn).Close(); err != nil {
+			s.logger.Warn("failed to close the NATSS connection", zap.Error(err))
+		}
+	}
+	s.signalReconnect()
+}
+
+// Ready returns an error unless the dispatcher is connected to NATSS.
+func (s *subscriptionsSupervisor) Ready(_ context.Context) error {
+	s.natssConnMux.Lock()
+	currentNatssConn := s.natssConn
+	s.natssConnMux.Unlock()
+	if currentNatssConn == nil {
+		return errors.New("no Connection to NATSS")
+	}
+	if nc := (*currentNatssConn).NatsConn(); nc == nil || !nc.IsConnected() {
+		return errors.New("connection to NATSS lost, reconnecting")
+	}
+	return nil
+}
+
+// UpdateConfig applies a new configuration of the connection to NATSS. The dispatcher reconnects when the server
+// URL or the cluster ID change, and re-establishes the subscriptions when their settings change.
+func (s *subscriptionsSupervisor) UpdateConfig(ctx context.Context, natsConfig *config.NatsConfig) {
+	s.configMux.Lock()
+	connectionChanged := s.natssURL != natsConfig.NatssURL || s.clusterID != natsConfig.ClusterID
+	subscriptionsChanged := s.ackWaitMinutes != natsConfig.AckWaitMinutes || s.maxInflight != natsConfig.MaxInflight
+	s.natssURL = natsConfig.NatssURL
+	s.clusterID = natsConfig.ClusterID
+	s.ackWaitMinutes = natsConfig.AckWaitMinutes
+	s.maxInflight = natsConfig.MaxInflight
+	s.configMux.Unlock()
+	s.audit.update(natsConfig.AuditLog, natsConfig.AuditLogSampleRate)
+
+	switch {
+	case connectionChanged:
+		// The subscriptions are re-established with the new settings once connected.
+		s.reconnect()
+	case subscriptionsChanged:
+		s.logger.Info("NATSS subscription configuration changed, resubscribing")
+		s.resubscribe(ctx)
+	}
+}
+
+// resubscribe re-establishes the active subscriptions on the current connection. The subscriptions are durable,
+// so the subscribers continue where they left off.
+func (s *subscriptionsSupervisor) resubscribe(ctx context.Context) {
+	s.subscriptionsMux.Lock()
+	defer s.subscriptionsMux.Unlock()
+
+	for cRef, chMap := range s.subscriptions {
+		for uid, sub := range chMap {
+			// Subscriptions of a closed connection are gone already. Closing keeps the durable subscription.
+			if err := sub.Close(); err != nil && err != stan.ErrConnectionClosed && err != stan.ErrBadSubscription {
+				s.logger.Warn("failed to close subscription", zap.String("channel", cRef.String()), zap.String("sub", string(uid)), zap.Error(err))
+			}
+			natssSub, err := s.subscribe(ctx, cRef, sub.ref)
+			if err != nil {
+				// Forgetting the subscription lets the next reconciliation of the channel subscribe again.
+				s.logger.Error("failed to re-establish subscription", zap.String("channel", cRef.String()), zap.String("sub", string(uid)), zap.Error(err))
+				delete(chMap, uid)
+				continue
+			}
+			sub.Subscription = *natssSub
+		}
+	}
+}
+
 func (s *subscriptionsSupervisor) connectWithRetry(ctx context.Context) {
 	// re-attempting evey 1 second until the connection is established.
 	ticker := time.NewTicker(retryInterval)
 	defer ticker.Stop()
 	for {
-		nConn, err := natsutil.Connect(s.clusterID, s.clientID, s.natssURL, s.logger.Sugar())
+		s.configMux.RLock()
+		clusterID, natssURL := s.clusterID, s.natssURL
+		s.configMux.RUnlock()
+
+		nConn, err := natsutil.Connect(clusterID, s.clientID, natssURL, s.connection, s.logger.Sugar())
 		if err == nil {
 			// Locking here in order to reduce time in locked state.
 			s.natssConnMux.Lock()
 			s.natssConn = nConn
 			s.natssConnInProgress = false
 			s.natssConnMux.Unlock()
+			s.resubscribe(ctx)
 			return
 		}
 		s.logger.Sugar().Errorf("Connect() failed with error: %+v, retrying in %s", err, retryInterval.String())
@@ -227,6 +380,10 @@ func (s *subscriptionsSupervisor) UpdateSubscriptions(ctx context.Context, name,
 	if len(subscribers) == 0 || isFinalizer {
 		s.logger.Sugar().Infof("Empty subscriptions for channel Ref: %v; unsubscribe all active subscriptions, if any", cRef)
 
+		if isFinalizer {
+			s.rateLimiters.update(cRef, nil)
+		}
+
 		chMap, ok := s.subscriptions[cRef]
 		if !ok {
 			// nothing to do
@@ -244,17 +401,25 @@ func (s *subscriptionsSupervisor) UpdateSubscriptions(ctx context.Context, name,
 
 	chMap, ok := s.subscriptions[cRef]
 	if !ok {
-		chMap = make(map[types.UID]*stan.Subscription)
+		chMap = make(map[types.UID]*natssSubscription)
 		s.subscriptions[cRef] = chMap
 	}
 
 	for _, sub := range subscribers {
 		// check if the subscription already exist and do nothing in this case
 		subRef := newSubscriptionReference(sub)
-		if _, ok := chMap[subRef.UID]; ok {
-			activeSubs[subRef.UID] = true
-			s.logger.Sugar().Infof("Subscription: %v already active for channel: %v", sub, cRef)
-			continue
+		if existing, ok := chMap[subRef.UID]; ok {
+			if !existing.ref.changed(subRef) {
+				activeSubs[subRef.UID] = true
+				s.logger.Sugar().Infof("Subscription: %v already active for channel: %v", sub, cRef)
+				continue
+			}
+			// Closing keeps the durable subscription, the subscriber continues where it left off.
+			s.logger.Info("Subscriber changed, resubscribing", zap.String("channel", cRef.String()), zap.String("sub", string(subRef.UID)))
+			if err := existing.Close(); err != nil && err != stan.ErrConnectionClosed && err != stan.ErrBadSubscription {
+				s.logger.Warn("failed to close subscription", zap.String("channel", cRef.String()), zap.String("sub", string(subRef.UID)), zap.Error(err))
+			}
+			delete(chMap, subRef.UID)
 		}
 		// subscribe and update failedSubscription if subscribe fails
 		natssSub, err := s.subscribe(ctx, cRef, subRef)
@@ -265,7 +430,7 @@ func (s *subscriptionsSupervisor) UpdateSubscriptions(ctx context.Context, name,
 			failedToSubscribe[eventingduckv1.SubscriberSpec(sub)] = err
 			continue
 		}
-		chMap[subRef.UID] = natssSub
+		chMap[subRef.UID] = &natssSubscription{Subscription: *natssSub, ref: subRef}
 		activeSubs[subRef.UID] = true
 	}
 	// Unsubscribe for deleted subscriptions
@@ -282,7 +447,13 @@ func (s *subscriptionsSupervisor) UpdateSubscriptions(ctx context.Context, name,
 }
 
 func (s *subscriptionsSupervisor) subscribe(ctx context.Context, channel eventingchannels.ChannelReference, subscription subscriptionReference) (*stan.Subscription, error) {
-	s.logger.Info("Subscribe to channel:", zap.Any("channel", channel), zap.Any("subscription", subscription))
+	s.logger.Info("Subscribe to channel:", zap.String("channel", channel.String()), zap.String("sub", string(subscription.UID)))
+
+	retryConfig, err := newRetryConfig(subscription)
+	if err != nil {
+		s.logger.Error("Invalid delivery spec", zap.String("sub", string(subscription.UID)), zap.Error(err))
+		return nil, fmt.Errorf("invalid delivery spec: %w", err)
+	}
 
 	mcb := func(stanMsg *stan.Msg) {
 		defer func() {
@@ -301,6 +472,11 @@ func (s *subscriptionsSupervisor) subscribe(ctx context.Context, channel eventin
 			return
 		}
 		s.logger.Debug("NATSS message received", zap.String("subject", stanMsg.Subject), zap.Uint64("sequence", stanMsg.Sequence), zap.Time("timestamp", time.Unix(stanMsg.Timestamp, 0)))
+		if stanMsg.Redelivered {
+			reportRedelivery(channel, subscription.UID)
+		}
+		audited := s.audit.sampleData(stanMsg.Data)
+		s.audit.record(audited, auditReceived, channel, subscription.UID, zap.Uint64("sequence", stanMsg.Sequence), zap.Bool("redelivered", stanMsg.Redelivered))
 
 		var destination *url.URL
 		if !subscription.SubscriberURI.IsEmpty() {
@@ -320,14 +496,38 @@ func (s *subscriptionsSupervisor) subscribe(ctx context.Context, channel eventin
 			s.logger.Debug("dispatch message", zap.String("deadLetter", deadLetter.String()))
 		}
 
-		executionInfo, err := s.dispatcher.DispatchMessage(ctx, message, nil, destination, reply, deadLetter)
-		if err != nil {
-			s.logger.Error("Failed to dispatch message: ", zap.Error(err))
+		if err := s.rateLimiters.wait(ctx, channel, subscription.UID, nil); err != nil {
+			// The message isn't acknowledged, so it's redelivered.
+			s.logger.Warn("Gave up waiting for the rate limit of the subscriber", zap.String("sub", string(subscription.UID)), zap.Error(err))
 			return
 		}
-		// TODO: Actually report the stats
-		// https://github.com/knative-sandbox/eventing-natss/issues/39
-		s.logger.Debug("Dispatch details", zap.Any("DispatchExecutionInfo", executionInfo))
+
+		var attempts int32
+		start := time.Now()
+		// The dead letter sink is sent the message separately, so that the delivery to the subscriber and to the
+		// dead letter sink can be told apart.
+		executionInfo, err := s.dispatcher.DispatchMessageWithRetries(ctx, message, nil, destination, reply, nil, countAttempts(retryConfig, &attempts))
+		reportDispatch(channel, subscription.UID, dispatchResponseCode(executionInfo), time.Since(start))
+		if err != nil {
+			s.audit.record(audited, auditFailed, channel, subscription.UID, zap.Int32("attempts", attempts), zap.Int("response_code", dispatchResponseCode(executionInfo)), zap.Error(err))
+			s.logger.Error("Failed to dispatch message: ", zap.Int32("attempts", attempts), zap.Error(err))
+			if deadLetter == nil {
+				return
+			}
+			executionInfo, err := s.dispatcher.DispatchMessageWithRetries(ctx, message, nil, deadLetter, nil, nil, retryConfig, deadLetterTransformers(executionInfo)...)
+			if err != nil {
+				// The message isn't acknowledged, so it's redelivered.
+				s.logger.Error("Failed to dispatch message to the dead letter sink", zap.Error(err))
+				return
+			}
+			s.logger.Debug("Dead letter dispatch details", zap.Any("DispatchExecutionInfo", executionInfo))
+			s.audit.record(audited, auditDeadLettered, channel, subscription.UID, zap.String("dead_letter", deadLetter.String()))
+		} else {
+			s.audit.record(audited, auditDelivered, channel, subscription.UID, zap.Int32("attempts", attempts), zap.Int("response_code", dispatchResponseCode(executionInfo)))
+			// TODO: Actually report the stats
+			// https://github.com/knative-sandbox/eventing-natss/issues/39
+			s.logger.Debug("Dispatch details", zap.Any("DispatchExecutionInfo", executionInfo), zap.Int32("attempts", attempts))
+		}
 		if err := stanMsg.Ack(); err != nil {
 			s.logger.Error("failed to acknowledge message", zap.Error(err))
 		}
@@ -346,8 +546,12 @@ func (s *subscriptionsSupervisor) subscribe(ctx context.Context, channel eventin
 		return nil, errors.New("no Connection to NATSS")
 	}
 
+	s.configMux.RLock()
+	ackWait, maxInflight := time.Duration(s.ackWaitMinutes)*time.Minute, s.maxInflight
+	s.configMux.RUnlock()
+
 	subscriber := &natsscloudevents.RegularSubscriber{}
-	natssSub, err := subscriber.Subscribe(*currentNatssConn, ch, mcb, stan.DurableName(sub), stan.SetManualAckMode(), stan.AckWait(time.Duration(s.ackWaitMinutes)*time.Minute), stan.MaxInflight(s.maxInflight))
+	natssSub, err := subscriber.Subscribe(*currentNatssConn, ch, mcb, stan.DurableName(sub), stan.SetManualAckMode(), stan.AckWait(ackWait), stan.MaxInflight(maxInflight))
 	if err != nil {
 		s.logger.Error(" Create new NATSS Subscription failed: ", zap.Error(err))
 		if err.Error() == stan.ErrConnectionClosed.Error() {
@@ -359,16 +563,22 @@ func (s *subscriptionsSupervisor) subscribe(ctx context.Context, channel eventin
 		return nil, err
 	}
 
-	s.logger.Sugar().Infof("NATSS Subscription created: %+v", natssSub)
+	s.logger.Debug("NATSS Subscription created", zap.String("channel", channel.String()), zap.String("sub", string(subscription.UID)))
 	return &natssSub, nil
 }
 
+// UpdateRateLimits sets the rate limits of the subscribers of the given channel. They apply to the messages
+// handled from now on, including the ones of existing subscriptions.
+func (s *subscriptionsSupervisor) UpdateRateLimits(name, ns string, limits map[types.UID]RateLimit) {
+	s.rateLimiters.update(eventingchannels.ChannelReference{Namespace: ns, Name: name}, limits)
+}
+
 // should be called only while holding subscriptionsMux
 func (s *subscriptionsSupervisor) unsubscribe(channel eventingchannels.ChannelReference, subscription types.UID) error {
-	s.logger.Info("Unsubscribe from channel:", zap.Any("channel", channel), zap.Any("subscription", subscription))
+	s.logger.Info("Unsubscribe from channel:", zap.String("channel", channel.String()), zap.String("sub", string(subscription)))
 
 	if stanSub, ok := s.subscriptions[channel][subscription]; ok {
-		if err := (*stanSub).Unsubscribe(); err != nil {
+		if err := stanSub.Unsubscribe(); err != nil {
 			s.logger.Error("Unsubscribing NATSS Streaming subscription failed: ", zap.Error(err))
 			return err
 		}
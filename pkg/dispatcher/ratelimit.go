@@ -0,0 +1,179 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	messagingv1 "knative.dev/eventing/pkg/apis/messaging/v1"
+	eventingchannels "knative.dev/eventing/pkg/channel"
+	messaginglisters "knative.dev/eventing/pkg/client/listers/messaging/v1"
+)
+
+const (
+	// RateLimitAnnotationKey is the annotation of a Subscription which sets the maximum number of events per second
+	// delivered to its subscriber.
+	RateLimitAnnotationKey = "messaging.knative.dev/nats-rate-limit"
+	// RateLimitBurstAnnotationKey is the annotation of a Subscription which sets the number of events delivered to
+	// its subscriber at once, above the rate limit. It defaults to the rate limit, rounded up.
+	RateLimitBurstAnnotationKey = "messaging.knative.dev/nats-rate-limit-burst"
+)
+
+// RateLimit is the rate the events of a channel are delivered to a subscriber at.
+type RateLimit struct {
+	// EventsPerSecond is the sustained number of events delivered per second.
+	EventsPerSecond float64
+	// Burst is the maximum number of events delivered at once.
+	Burst int
+}
+
+// RateLimitFromAnnotations returns the rate limit set by the annotations of a Subscription, or nil if it has none.
+func RateLimitFromAnnotations(annotations map[string]string) (*RateLimit, error) {
+	value, ok := annotations[RateLimitAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+	eventsPerSecond, err := strconv.ParseFloat(value, 64)
+	if err != nil || eventsPerSecond <= 0 || math.IsInf(eventsPerSecond, 0) {
+		return nil, fmt.Errorf("invalid %s annotation %q: must be a positive number", RateLimitAnnotationKey, value)
+	}
+
+	limit := &RateLimit{EventsPerSecond: eventsPerSecond, Burst: int(math.Ceil(eventsPerSecond))}
+	if value, ok := annotations[RateLimitBurstAnnotationKey]; ok {
+		burst, err := strconv.Atoi(value)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid %s annotation %q: must be a positive integer", RateLimitBurstAnnotationKey, value)
+		}
+		limit.Burst = burst
+	}
+	return limit, nil
+}
+
+// RateLimitsFromSubscriptions returns the rate limits of the given subscribers, set by the annotations of their
+// Subscriptions. Subscriptions with invalid annotations are logged and left without a rate limit.
+func RateLimitsFromSubscriptions(subscriptions []*messagingv1.Subscription, subscribers []eventingduckv1.SubscriberSpec, logger *zap.Logger) map[types.UID]RateLimit {
+	subscribed := make(map[types.UID]bool, len(subscribers))
+	for _, sub := range subscribers {
+		subscribed[sub.UID] = true
+	}
+
+	limits := make(map[types.UID]RateLimit)
+	for _, subscription := range subscriptions {
+		if !subscribed[subscription.UID] {
+			continue
+		}
+		limit, err := RateLimitFromAnnotations(subscription.Annotations)
+		if err != nil {
+			logger.Warn("Ignoring the rate limit of the subscription", zap.String("subscription", subscription.Name), zap.Error(err))
+			continue
+		}
+		if limit != nil {
+			limits[subscription.UID] = *limit
+		}
+	}
+	return limits
+}
+
+// SubscriberRateLimits returns the rate limits of the given subscribers of a channel in namespace ns, set by the
+// annotations of their Subscriptions.
+func SubscriberRateLimits(lister messaginglisters.SubscriptionLister, ns string, subscribers []eventingduckv1.SubscriberSpec, logger *zap.Logger) (map[types.UID]RateLimit, error) {
+	subscriptions, err := listSubscriptions(lister, ns, subscribers)
+	if err != nil {
+		return nil, err
+	}
+	return RateLimitsFromSubscriptions(subscriptions, subscribers, logger), nil
+}
+
+// rateLimiters holds the rate limiters of the subscribers of each channel. The limiters are updated in place, so
+// that a subscription doesn't have to be re-established when its rate limit changes.
+type rateLimiters struct {
+	mux      sync.RWMutex
+	limiters map[eventingchannels.ChannelReference]map[types.UID]*rate.Limiter
+}
+
+func newRateLimiters() *rateLimiters {
+	return &rateLimiters{limiters: make(map[eventingchannels.ChannelReference]map[types.UID]*rate.Limiter)}
+}
+
+// update sets the rate limits of the subscribers of channel, the other subscribers aren't rate limited.
+func (r *rateLimiters) update(channel eventingchannels.ChannelReference, limits map[types.UID]RateLimit) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if len(limits) == 0 {
+		delete(r.limiters, channel)
+		return
+	}
+	existing := r.limiters[channel]
+	limiters := make(map[types.UID]*rate.Limiter, len(limits))
+	for uid, limit := range limits {
+		if limiter, ok := existing[uid]; ok {
+			limiter.SetLimit(rate.Limit(limit.EventsPerSecond))
+			limiter.SetBurst(limit.Burst)
+			limiters[uid] = limiter
+			continue
+		}
+		limiters[uid] = rate.NewLimiter(rate.Limit(limit.EventsPerSecond), limit.Burst)
+	}
+	r.limiters[channel] = limiters
+}
+
+// wait blocks until the next event can be delivered to the subscriber, or ctx is done. progress, unless it's nil,
+// is called every progressInterval while waiting.
+func (r *rateLimiters) wait(ctx context.Context, channel eventingchannels.ChannelReference, subscriber types.UID, progress func()) error {
+	r.mux.RLock()
+	limiter := r.limiters[channel][subscriber]
+	r.mux.RUnlock()
+	if limiter == nil {
+		return nil
+	}
+	reservation := limiter.Reserve()
+	if !reservation.OK() {
+		return fmt.Errorf("the rate limit of the subscriber doesn't allow any event, its burst is %d", limiter.Burst())
+	}
+	delay := reservation.Delay()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return nil
+		case <-ticker.C:
+			if progress != nil {
+				progress()
+			}
+		case <-ctx.Done():
+			reservation.Cancel()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	messagingv1 "knative.dev/eventing/pkg/apis/messaging/v1"
+	eventingchannels "knative.dev/eventing/pkg/channel"
+	messaginglisters "knative.dev/eventing/pkg/client/listers/messaging/v1"
+)
+
+func TestRateLimitFromAnnotations(t *testing.T) {
+	testCases := map[string]struct {
+		annotations map[string]string
+		want        *RateLimit
+		wantErr     bool
+	}{
+		"no annotations": {},
+		"rate only": {
+			annotations: map[string]string{RateLimitAnnotationKey: "2.5"},
+			want:        &RateLimit{EventsPerSecond: 2.5, Burst: 3},
+		},
+		"rate and burst": {
+			annotations: map[string]string{RateLimitAnnotationKey: "10", RateLimitBurstAnnotationKey: "50"},
+			want:        &RateLimit{EventsPerSecond: 10, Burst: 50},
+		},
+		"burst only": {
+			annotations: map[string]string{RateLimitBurstAnnotationKey: "50"},
+		},
+		"invalid rate": {
+			annotations: map[string]string{RateLimitAnnotationKey: "fast"},
+			wantErr:     true,
+		},
+		"zero rate": {
+			annotations: map[string]string{RateLimitAnnotationKey: "0"},
+			wantErr:     true,
+		},
+		"invalid burst": {
+			annotations: map[string]string{RateLimitAnnotationKey: "10", RateLimitBurstAnnotationKey: "0"},
+			wantErr:     true,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, err := RateLimitFromAnnotations(tc.annotations)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("RateLimitFromAnnotations() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("RateLimitFromAnnotations() (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func newRateLimitSubscription(uid types.UID, annotations map[string]string) *messagingv1.Subscription {
+	return &messagingv1.Subscription{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: string(uid), UID: uid, Annotations: annotations}}
+}
+
+func TestRateLimitsFromSubscriptions(t *testing.T) {
+	subscription := newRateLimitSubscription
+	subscriptions := []*messagingv1.Subscription{
+		subscription("limited", map[string]string{RateLimitAnnotationKey: "5"}),
+		subscription("unlimited", nil),
+		subscription("invalid", map[string]string{RateLimitAnnotationKey: "-1"}),
+		subscription("other-channel", map[string]string{RateLimitAnnotationKey: "5"}),
+	}
+	subscribers := []eventingduckv1.SubscriberSpec{{UID: "limited"}, {UID: "unlimited"}, {UID: "invalid"}}
+
+	want := map[types.UID]RateLimit{
+		"limited": {EventsPerSecond: 5, Burst: 5},
+	}
+	if diff := cmp.Diff(want, RateLimitsFromSubscriptions(subscriptions, subscribers, zap.NewNop())); diff != "" {
+		t.Errorf("RateLimitsFromSubscriptions() (-want, +got) = %s", diff)
+	}
+}
+
+func TestRateLimiters(t *testing.T) {
+	channel := eventingchannels.ChannelReference{Namespace: "ns", Name: "channel"}
+	limiters := newRateLimiters()
+	limiters.update(channel, map[types.UID]RateLimit{"limited": {EventsPerSecond: 1, Burst: 1}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The subscribers without a rate limit never wait.
+	for i := 0; i < 10; i++ {
+		if err := limiters.wait(ctx, channel, "unlimited", nil); err != nil {
+			t.Fatalf("wait() for a subscriber without a rate limit = %v", err)
+		}
+	}
+
+	if err := limiters.wait(ctx, channel, "limited", nil); err != nil {
+		t.Fatalf("wait() within the burst = %v", err)
+	}
+	if err := limiters.wait(ctx, channel, "limited", nil); err == nil {
+		t.Error("wait() above the rate limit didn't fail before the deadline")
+	}
+
+	// The limiter is kept, and updated, when the rate limit changes.
+	limiter := limiters.limiters[channel]["limited"]
+	limiters.update(channel, map[types.UID]RateLimit{"limited": {EventsPerSecond: 1000, Burst: 10}})
+	if limiters.limiters[channel]["limited"] != limiter {
+		t.Error("update() replaced the limiter of the subscriber")
+	}
+	if got := limiter.Burst(); got != 10 {
+		t.Errorf("Burst() = %d, want 10", got)
+	}
+
+	limiters.update(channel, nil)
+	if _, ok := limiters.limiters[channel]; ok {
+		t.Error("update() without rate limits kept the limiters of the channel")
+	}
+}
+
+func TestSubscriberRateLimits(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	other := newRateLimitSubscription("other-namespace", map[string]string{RateLimitAnnotationKey: "5"})
+	other.Namespace = "other"
+	for _, subscription := range []*messagingv1.Subscription{
+		newRateLimitSubscription("limited", map[string]string{RateLimitAnnotationKey: "5"}),
+		other,
+	} {
+		if err := indexer.Add(subscription); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lister := messaginglisters.NewSubscriptionLister(indexer)
+	subscribers := []eventingduckv1.SubscriberSpec{{UID: "limited"}, {UID: "other-namespace"}}
+
+	got, err := SubscriberRateLimits(lister, "ns", subscribers, zap.NewNop())
+	if err != nil {
+		t.Fatal("SubscriberRateLimits() =", err)
+	}
+	want := map[types.UID]RateLimit{
+		"limited": {EventsPerSecond: 5, Burst: 5},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SubscriberRateLimits() (-want, +got) = %s", diff)
+	}
+}
+
+func TestRateLimitersWaitProgress(t *testing.T) {
+	defer func(interval time.Duration) { progressInterval = interval }(progressInterval)
+	progressInterval = 10 * time.Millisecond
+
+	channel := eventingchannels.ChannelReference{Namespace: "ns", Name: "channel"}
+	limiters := newRateLimiters()
+	limiters.update(channel, map[types.UID]RateLimit{"limited": {EventsPerSecond: 10, Burst: 1}})
+
+	var progress int32
+	for i := 0; i < 2; i++ {
+		if err := limiters.wait(context.Background(), channel, "limited", func() { atomic.AddInt32(&progress, 1) }); err != nil {
+			t.Fatalf("wait() = %v", err)
+		}
+	}
+	if atomic.LoadInt32(&progress) == 0 {
+		t.Error("wait() didn't report the progress of the waiting event")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiters.wait(ctx, channel, "limited", nil); err == nil {
+		t.Error("wait() with a cancelled context didn't fail")
+	}
+}
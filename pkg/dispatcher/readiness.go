@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// ReadinessPort is the port the readiness endpoint of the dispatchers listens on. The port of the receiver
+	// can't be used, since the probes sent to it are answered before reaching any handler.
+	ReadinessPort = 8081
+
+	// ReadinessPath is the path of the readiness endpoint of the dispatchers.
+	ReadinessPath = "/readyz"
+
+	// readinessShutdownTimeout is how long the readiness server waits for the pending probes when it's stopped.
+	readinessShutdownTimeout = 5 * time.Second
+)
+
+// NewReadinessHandler returns a handler answering the readiness probes of the dispatcher, with 200 if it's ready
+// and with 503 and the reason why it isn't otherwise.
+func NewReadinessHandler(d NatsDispatcher, logger *zap.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+		if err := d.Ready(r.Context()); err != nil {
+			logger.Info("Dispatcher not ready", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+// StartReadinessServer serves the readiness endpoint of the dispatcher on the given port until ctx is done.
+func StartReadinessServer(ctx context.Context, port int, d NatsDispatcher, logger *zap.Logger) error {
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: NewReadinessHandler(d, logger),
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), readinessShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
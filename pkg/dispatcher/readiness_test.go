@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// readyDispatcher is a NatsDispatcher whose readiness is set by the tests.
+type readyDispatcher struct {
+	NatsDispatcher
+	err error
+}
+
+func (d *readyDispatcher) Ready(_ context.Context) error {
+	return d.err
+}
+
+func TestReadinessHandler(t *testing.T) {
+	testCases := map[string]struct {
+		err        error
+		path       string
+		wantStatus int
+	}{
+		"ready": {
+			path:       ReadinessPath,
+			wantStatus: http.StatusOK,
+		},
+		"not ready": {
+			err:        errors.New("no Connection to NATSS"),
+			path:       ReadinessPath,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		"unknown path": {
+			path:       "/healthz",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			handler := NewReadinessHandler(&readyDispatcher{err: tc.err}, zap.NewNop())
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestJetStreamReadyWithoutConnection(t *testing.T) {
+	d, err := NewJetStreamDispatcher(JetArgs{
+		JetStreamURL:   "nats://127.0.0.1:1",
+		AckWaitMinutes: 1,
+		MaxInflight:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Ready(context.Background()); err == nil {
+		t.Error("Ready() expected an error before the connection is established")
+	}
+}
+
+func TestNatssReadyWithoutConnection(t *testing.T) {
+	d, err := NewNatssDispatcher(Args{
+		NatssURL:       "nats://127.0.0.1:1",
+		ClusterID:      "knative-nats-streaming",
+		ClientID:       "readiness-test",
+		AckWaitMinutes: 1,
+		MaxInflight:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Ready(context.Background()); err == nil {
+		t.Error("Ready() expected an error before the connection is established")
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	"knative.dev/eventing/pkg/kncloudevents"
+)
+
+// progressInterval is how often a message waiting to be dispatched is reported as in progress, so that JetStream
+// doesn't redeliver it while it waits.
+var progressInterval = 30 * time.Second
+
+// newRetryConfig creates the retry configuration of a subscriber from its DeliverySpec. Subscribers
+// without a DeliverySpec get a single delivery attempt.
+func newRetryConfig(subscription subscriptionReference) (*kncloudevents.RetryConfig, error) {
+	var delivery eventingduckv1.DeliverySpec
+	if subscription.Delivery != nil {
+		delivery = *subscription.Delivery
+	}
+	retryConfig, err := kncloudevents.RetryConfigFromDeliverySpec(delivery)
+	if err != nil {
+		return nil, err
+	}
+	return &retryConfig, nil
+}
+
+// countAttempts returns a copy of retryConfig which increments attempts on every request sent with it.
+func countAttempts(retryConfig *kncloudevents.RetryConfig, attempts *int32) *kncloudevents.RetryConfig {
+	c := *retryConfig
+	c.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		atomic.AddInt32(attempts, 1)
+		return retryConfig.CheckRetry(ctx, resp, err)
+	}
+	return &c
+}
+
+// reportProgress returns a copy of retryConfig which tells JetStream that msg is still being handled before every
+// retry, so that it isn't redelivered while the retries take longer than the ack wait.
+func reportProgress(retryConfig *kncloudevents.RetryConfig, msg *nats.Msg) *kncloudevents.RetryConfig {
+	c := *retryConfig
+	c.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		retry, checkErr := retryConfig.CheckRetry(ctx, resp, err)
+		if retry {
+			_ = msg.InProgress()
+		}
+		return retry, checkErr
+	}
+	return &c
+}
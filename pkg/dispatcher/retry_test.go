@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"k8s.io/utils/pointer"
+
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+)
+
+func TestNewRetryConfig(t *testing.T) {
+	linear := eventingduckv1.BackoffPolicyLinear
+
+	testCases := map[string]struct {
+		delivery     *eventingduckv1.DeliverySpec
+		wantRetryMax int
+		wantBackoff  time.Duration
+		wantErr      bool
+	}{
+		"no delivery": {
+			wantRetryMax: 0,
+		},
+		"linear backoff": {
+			delivery: &eventingduckv1.DeliverySpec{
+				Retry:         pointer.Int32Ptr(3),
+				BackoffPolicy: &linear,
+				BackoffDelay:  pointer.StringPtr("PT1S"),
+			},
+			wantRetryMax: 3,
+			wantBackoff:  2 * time.Second,
+		},
+		"invalid backoff delay": {
+			delivery: &eventingduckv1.DeliverySpec{
+				Retry:         pointer.Int32Ptr(3),
+				BackoffPolicy: &linear,
+				BackoffDelay:  pointer.StringPtr("1s"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, err := newRetryConfig(subscriptionReference{Delivery: tc.delivery})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("newRetryConfig() expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newRetryConfig() unexpected error: %v", err)
+			}
+			if got.RetryMax != tc.wantRetryMax {
+				t.Errorf("RetryMax = %d, want %d", got.RetryMax, tc.wantRetryMax)
+			}
+			if backoff := got.Backoff(2, nil); backoff != tc.wantBackoff {
+				t.Errorf("Backoff(2) = %v, want %v", backoff, tc.wantBackoff)
+			}
+		})
+	}
+}
+
+func TestCountAttempts(t *testing.T) {
+	retryConfig, err := newRetryConfig(subscriptionReference{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts int32
+	counting := countAttempts(retryConfig, &attempts)
+	for i := 0; i < 3; i++ {
+		retry, _ := counting.CheckRetry(context.Background(), &http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+		if !retry {
+			t.Error("CheckRetry() = false, want true")
+		}
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	messagingv1 "knative.dev/eventing/pkg/apis/messaging/v1"
+	messaginglisters "knative.dev/eventing/pkg/client/listers/messaging/v1"
+)
+
+const (
+	// PartitionKeyAnnotationKey is the annotation of a Subscription to a NatsJetStreamChannel which opts its
+	// subscriber into key ordered delivery. It names the CloudEvent extension the partition key of the events is
+	// read from. The events with the same key are delivered to the subscriber one at a time, in the order of the
+	// stream, while the events with different keys are delivered concurrently. Events without the extension share
+	// the same empty key.
+	PartitionKeyAnnotationKey = "messaging.knative.dev/nats-partition-key"
+	// PartitionsAnnotationKey sets the number of partitions the events of a key ordered subscriber are spread
+	// over by their key, which is the number of events delivered to the subscriber concurrently. It requires the
+	// partition key annotation. Defaults to 16.
+	PartitionsAnnotationKey = "messaging.knative.dev/nats-partitions"
+
+	// PullBatchSizeAnnotationKey is one of the pull annotations of a Subscription to a NatsJetStreamChannel, which
+	// make its subscriber fetch the events from a pull consumer instead of having them pushed by the server. Any
+	// of them opts the subscriber into pull mode, the others default. It sets the maximum number of events
+	// fetched at once. Defaults to 10.
+	PullBatchSizeAnnotationKey = "messaging.knative.dev/nats-pull-batch-size"
+	// PullFetchTimeoutAnnotationKey sets how long a fetch waits for events when there are none, as a duration.
+	// Defaults to 5s.
+	PullFetchTimeoutAnnotationKey = "messaging.knative.dev/nats-pull-fetch-timeout"
+	// PullWorkersAnnotationKey sets the number of events sent to the subscriber concurrently, unless it's key
+	// ordered. Defaults to the batch size.
+	PullWorkersAnnotationKey = "messaging.knative.dev/nats-pull-workers"
+)
+
+const (
+	// defaultPartitions is the number of partitions of key ordered subscribers if not specified.
+	defaultPartitions = 16
+	// defaultPullBatchSize is the number of events fetched at once by pull consumers if not specified.
+	defaultPullBatchSize = 10
+	// defaultPullFetchTimeout is how long pull consumers wait for events if not specified.
+	defaultPullFetchTimeout = 5 * time.Second
+)
+
+// extensionNameRegexp matches the names of CloudEvent extensions.
+var extensionNameRegexp = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// subscriptionAnnotationKeys are the annotations of a Subscription which affect how the events are dispatched to
+// its subscriber.
+var subscriptionAnnotationKeys = []string{
+	RateLimitAnnotationKey,
+	RateLimitBurstAnnotationKey,
+	PartitionKeyAnnotationKey,
+	PartitionsAnnotationKey,
+	PullBatchSizeAnnotationKey,
+	PullFetchTimeoutAnnotationKey,
+	PullWorkersAnnotationKey,
+}
+
+// SubscriberConfig holds the configuration of a subscriber of a NatsJetStreamChannel which affects how the events
+// are dispatched to it, set by the annotations of its Subscription.
+type SubscriberConfig struct {
+	// PartitionKeyExtension is the CloudEvent extension the partition key of the events is read from, the events
+	// aren't key ordered if it's empty.
+	PartitionKeyExtension string
+	// Partitions is the number of partitions the key ordered events are spread over.
+	Partitions int
+	// PullConsumer makes the subscriber fetch the events from a pull consumer, instead of a push consumer.
+	PullConsumer *PullConsumerConfig
+}
+
+// SubscriberConfigFromAnnotations returns the configuration of a subscriber set by the annotations of its
+// Subscription.
+func SubscriberConfigFromAnnotations(annotations map[string]string) (SubscriberConfig, error) {
+	var config SubscriberConfig
+	if value, ok := annotations[PartitionKeyAnnotationKey]; ok {
+		if !extensionNameRegexp.MatchString(value) {
+			return SubscriberConfig{}, fmt.Errorf("invalid %s annotation %q: CloudEvent extension names consist of lower case alphanumeric characters only", PartitionKeyAnnotationKey, value)
+		}
+		config.PartitionKeyExtension = value
+		config.Partitions = defaultPartitions
+	}
+	if value, ok := annotations[PartitionsAnnotationKey]; ok {
+		if config.PartitionKeyExtension == "" {
+			return SubscriberConfig{}, fmt.Errorf("the %s annotation requires the %s annotation", PartitionsAnnotationKey, PartitionKeyAnnotationKey)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return SubscriberConfig{}, fmt.Errorf("invalid %s annotation %q: must be a positive integer", PartitionsAnnotationKey, value)
+		}
+		config.Partitions = n
+	}
+	pull, err := pullConsumerFromAnnotations(annotations)
+	if err != nil {
+		return SubscriberConfig{}, err
+	}
+	config.PullConsumer = pull
+	return config, nil
+}
+
+// pullConsumerFromAnnotations returns the settings of the pull consumer set by the pull annotations of a
+// Subscription, or nil if it has none.
+func pullConsumerFromAnnotations(annotations map[string]string) (*PullConsumerConfig, error) {
+	batchSize, batchSizeOk := annotations[PullBatchSizeAnnotationKey]
+	fetchTimeout, fetchTimeoutOk := annotations[PullFetchTimeoutAnnotationKey]
+	workers, workersOk := annotations[PullWorkersAnnotationKey]
+	if !batchSizeOk && !fetchTimeoutOk && !workersOk {
+		return nil, nil
+	}
+
+	pull := &PullConsumerConfig{BatchSize: defaultPullBatchSize, FetchTimeout: defaultPullFetchTimeout}
+	if batchSizeOk {
+		n, err := strconv.Atoi(batchSize)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid %s annotation %q: must be a positive integer", PullBatchSizeAnnotationKey, batchSize)
+		}
+		pull.BatchSize = n
+	}
+	if fetchTimeoutOk {
+		d, err := time.ParseDuration(fetchTimeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s annotation %q: must be a positive duration", PullFetchTimeoutAnnotationKey, fetchTimeout)
+		}
+		pull.FetchTimeout = d
+	}
+	pull.Workers = pull.BatchSize
+	if workersOk {
+		n, err := strconv.Atoi(workers)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid %s annotation %q: must be a positive integer", PullWorkersAnnotationKey, workers)
+		}
+		pull.Workers = n
+	}
+	return pull, nil
+}
+
+// SubscriberConfigs returns the configurations of the given subscribers of a channel in namespace ns, set by the
+// annotations of their Subscriptions. Subscriptions with invalid annotations are logged and left with the default
+// configuration.
+func SubscriberConfigs(lister messaginglisters.SubscriptionLister, ns string, subscribers []eventingduckv1.SubscriberSpec, logger *zap.Logger) (map[types.UID]SubscriberConfig, error) {
+	subscriptions, err := listSubscriptions(lister, ns, subscribers)
+	if err != nil {
+		return nil, err
+	}
+	subscribed := make(map[types.UID]bool, len(subscribers))
+	for _, sub := range subscribers {
+		subscribed[sub.UID] = true
+	}
+
+	configs := make(map[types.UID]SubscriberConfig)
+	for _, subscription := range subscriptions {
+		if !subscribed[subscription.UID] {
+			continue
+		}
+		config, err := SubscriberConfigFromAnnotations(subscription.Annotations)
+		if err != nil {
+			logger.Warn("Ignoring the configuration of the subscription", zap.String("subscription", subscription.Name), zap.Error(err))
+			continue
+		}
+		if config != (SubscriberConfig{}) {
+			configs[subscription.UID] = config
+		}
+	}
+	return configs, nil
+}
+
+// listSubscriptions returns the Subscriptions in namespace ns, or none if the channel has no subscribers.
+func listSubscriptions(lister messaginglisters.SubscriptionLister, ns string, subscribers []eventingduckv1.SubscriberSpec) ([]*messagingv1.Subscription, error) {
+	if len(subscribers) == 0 {
+		return nil, nil
+	}
+	subscriptions, err := lister.Subscriptions(ns).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("listing subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+// SubscriptionHandler returns the handler of the events of the Subscriptions which enqueues the channel of the
+// given kind a Subscription subscribes to, when the annotations affecting the dispatch to its subscriber may have
+// changed. The subscribed channel may be a Channel backed by a channel of the given kind, which has the same name,
+// so Channels are enqueued too.
+func SubscriptionHandler(kind string, enqueue func(types.NamespacedName)) cache.ResourceEventHandler {
+	enqueueChannel := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		subscription, ok := obj.(*messagingv1.Subscription)
+		if !ok || (subscription.Spec.Channel.Kind != kind && subscription.Spec.Channel.Kind != "Channel") {
+			return
+		}
+		enqueue(types.NamespacedName{Namespace: subscription.Namespace, Name: subscription.Spec.Channel.Name})
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueueChannel,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSubscription, ok := oldObj.(*messagingv1.Subscription)
+			newSubscription, ok2 := newObj.(*messagingv1.Subscription)
+			if ok && ok2 && !dispatchAnnotationsChanged(oldSubscription, newSubscription) {
+				return
+			}
+			enqueueChannel(newObj)
+		},
+		DeleteFunc: enqueueChannel,
+	}
+}
+
+// dispatchAnnotationsChanged returns true if the annotations affecting the dispatch to the subscriber differ
+// between the two versions of a Subscription.
+func dispatchAnnotationsChanged(old, new *messagingv1.Subscription) bool {
+	for _, key := range subscriptionAnnotationKeys {
+		oldValue, oldOk := old.Annotations[key]
+		newValue, newOk := new.Annotations[key]
+		if oldOk != newOk || oldValue != newValue {
+			return true
+		}
+	}
+	return false
+}
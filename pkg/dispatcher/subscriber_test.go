@@ -0,0 +1,202 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	messagingv1 "knative.dev/eventing/pkg/apis/messaging/v1"
+	messaginglisters "knative.dev/eventing/pkg/client/listers/messaging/v1"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+func TestSubscriberConfigFromAnnotations(t *testing.T) {
+	testCases := map[string]struct {
+		annotations map[string]string
+		want        SubscriberConfig
+		wantErr     bool
+	}{
+		"no annotations": {},
+		"partition key": {
+			annotations: map[string]string{PartitionKeyAnnotationKey: "orderid"},
+			want:        SubscriberConfig{PartitionKeyExtension: "orderid", Partitions: defaultPartitions},
+		},
+		"partitions": {
+			annotations: map[string]string{PartitionKeyAnnotationKey: "orderid", PartitionsAnnotationKey: "4"},
+			want:        SubscriberConfig{PartitionKeyExtension: "orderid", Partitions: 4},
+		},
+		"invalid partitions": {
+			annotations: map[string]string{PartitionKeyAnnotationKey: "orderid", PartitionsAnnotationKey: "0"},
+			wantErr:     true,
+		},
+		"partitions without partition key": {
+			annotations: map[string]string{PartitionsAnnotationKey: "4"},
+			wantErr:     true,
+		},
+		"invalid partition key": {
+			annotations: map[string]string{PartitionKeyAnnotationKey: "order-id"},
+			wantErr:     true,
+		},
+		"empty partition key": {
+			annotations: map[string]string{PartitionKeyAnnotationKey: ""},
+			wantErr:     true,
+		},
+		"pull batch size": {
+			annotations: map[string]string{PullBatchSizeAnnotationKey: "50"},
+			want: SubscriberConfig{PullConsumer: &PullConsumerConfig{
+				BatchSize:    50,
+				FetchTimeout: defaultPullFetchTimeout,
+				Workers:      50,
+			}},
+		},
+		"pull consumer": {
+			annotations: map[string]string{
+				PullBatchSizeAnnotationKey:    "20",
+				PullFetchTimeoutAnnotationKey: "1s",
+				PullWorkersAnnotationKey:      "5",
+			},
+			want: SubscriberConfig{PullConsumer: &PullConsumerConfig{
+				BatchSize:    20,
+				FetchTimeout: time.Second,
+				Workers:      5,
+			}},
+		},
+		"pull workers": {
+			annotations: map[string]string{PullWorkersAnnotationKey: "5"},
+			want: SubscriberConfig{PullConsumer: &PullConsumerConfig{
+				BatchSize:    defaultPullBatchSize,
+				FetchTimeout: defaultPullFetchTimeout,
+				Workers:      5,
+			}},
+		},
+		"invalid pull batch size": {
+			annotations: map[string]string{PullBatchSizeAnnotationKey: "0"},
+			wantErr:     true,
+		},
+		"invalid pull fetch timeout": {
+			annotations: map[string]string{PullFetchTimeoutAnnotationKey: "5"},
+			wantErr:     true,
+		},
+		"invalid pull workers": {
+			annotations: map[string]string{PullWorkersAnnotationKey: "-2"},
+			wantErr:     true,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, err := SubscriberConfigFromAnnotations(tc.annotations)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("SubscriberConfigFromAnnotations() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SubscriberConfigFromAnnotations() (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestSubscriberConfigs(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, subscription := range []*messagingv1.Subscription{
+		newRateLimitSubscription("key-ordered", map[string]string{PartitionKeyAnnotationKey: "orderid"}),
+		newRateLimitSubscription("default", nil),
+		newRateLimitSubscription("invalid", map[string]string{PartitionKeyAnnotationKey: "order-id"}),
+		newRateLimitSubscription("other-channel", map[string]string{PartitionKeyAnnotationKey: "orderid"}),
+	} {
+		if err := indexer.Add(subscription); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subscribers := []eventingduckv1.SubscriberSpec{{UID: "key-ordered"}, {UID: "default"}, {UID: "invalid"}}
+
+	got, err := SubscriberConfigs(messaginglisters.NewSubscriptionLister(indexer), "ns", subscribers, zap.NewNop())
+	if err != nil {
+		t.Fatal("SubscriberConfigs() =", err)
+	}
+	want := map[types.UID]SubscriberConfig{
+		"key-ordered": {PartitionKeyExtension: "orderid", Partitions: defaultPartitions},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SubscriberConfigs() (-want, +got) = %s", diff)
+	}
+}
+
+func TestSubscriptionHandler(t *testing.T) {
+	subscription := func(kind string, annotations map[string]string) *messagingv1.Subscription {
+		s := newRateLimitSubscription("sub", annotations)
+		s.Spec.Channel = duckv1.KReference{Kind: kind, Name: "channel"}
+		return s
+	}
+	limited := subscription("NatssChannel", map[string]string{RateLimitAnnotationKey: "5"})
+	relabeled := subscription("NatssChannel", map[string]string{RateLimitAnnotationKey: "5", "other": "annotation"})
+	unlimited := subscription("NatssChannel", nil)
+
+	testCases := map[string]struct {
+		event func(cache.ResourceEventHandler)
+		want  []types.NamespacedName
+	}{
+		"added": {
+			event: func(h cache.ResourceEventHandler) { h.OnAdd(limited) },
+			want:  []types.NamespacedName{{Namespace: "ns", Name: "channel"}},
+		},
+		"added to a Channel": {
+			event: func(h cache.ResourceEventHandler) { h.OnAdd(subscription("Channel", nil)) },
+			want:  []types.NamespacedName{{Namespace: "ns", Name: "channel"}},
+		},
+		"added to a channel of another kind": {
+			event: func(h cache.ResourceEventHandler) { h.OnAdd(subscription("InMemoryChannel", nil)) },
+		},
+		"rate limit changed": {
+			event: func(h cache.ResourceEventHandler) { h.OnUpdate(limited, unlimited) },
+			want:  []types.NamespacedName{{Namespace: "ns", Name: "channel"}},
+		},
+		"partition key changed": {
+			event: func(h cache.ResourceEventHandler) {
+				h.OnUpdate(limited, subscription("NatssChannel", map[string]string{RateLimitAnnotationKey: "5", PartitionKeyAnnotationKey: "orderid"}))
+			},
+			want: []types.NamespacedName{{Namespace: "ns", Name: "channel"}},
+		},
+		"other annotation changed": {
+			event: func(h cache.ResourceEventHandler) { h.OnUpdate(limited, relabeled) },
+		},
+		"deleted": {
+			event: func(h cache.ResourceEventHandler) {
+				h.OnDelete(cache.DeletedFinalStateUnknown{Key: "ns/sub", Obj: limited})
+			},
+			want: []types.NamespacedName{{Namespace: "ns", Name: "channel"}},
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			var got []types.NamespacedName
+			tc.event(SubscriptionHandler("NatssChannel", func(key types.NamespacedName) {
+				got = append(got, key)
+			}))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("enqueued channels (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
@@ -20,6 +20,9 @@ import (
 	"context"
 	"errors"
 
+	"k8s.io/apimachinery/pkg/types"
+
+	"knative.dev/eventing-natss/pkg/config"
 	"knative.dev/eventing-natss/pkg/dispatcher"
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
 	messagingv1 "knative.dev/eventing/pkg/apis/messaging/v1"
@@ -46,6 +49,16 @@ func (s *DispatcherDoNothing) ProcessChannels(_ context.Context, _ []messagingv1
 	return nil
 }
 
+func (s *DispatcherDoNothing) UpdateConfig(_ context.Context, _ *config.NatsConfig) {
+}
+
+func (s *DispatcherDoNothing) Ready(_ context.Context) error {
+	return nil
+}
+
+func (s *DispatcherDoNothing) UpdateRateLimits(_, _ string, _ map[types.UID]dispatcher.RateLimit) {
+}
+
 // DispatcherFailNatssSubscription simulates that natss has a failed subscription
 type DispatcherFailNatssSubscription struct {
 }
@@ -79,3 +92,13 @@ func (s *DispatcherFailNatssSubscription) UpdateSubscriptions(ctx context.Contex
 func (s *DispatcherFailNatssSubscription) ProcessChannels(_ context.Context, _ []messagingv1.Channel) error {
 	return nil
 }
+
+func (s *DispatcherFailNatssSubscription) UpdateConfig(_ context.Context, _ *config.NatsConfig) {
+}
+
+func (s *DispatcherFailNatssSubscription) Ready(_ context.Context) error {
+	return nil
+}
+
+func (s *DispatcherFailNatssSubscription) UpdateRateLimits(_, _ string, _ map[types.UID]dispatcher.RateLimit) {
+}
@@ -17,6 +17,10 @@ limitations under the License.
 package dispatcher
 
 import (
+	"reflect"
+	"time"
+
+	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
 )
 
@@ -37,3 +41,69 @@ func newSubscriptionReference(spec eventingduckv1.SubscriberSpec) subscriptionRe
 func (r *subscriptionReference) String() string {
 	return string(r.UID)
 }
+
+// changed returns true if the subscriber differs from the one the subscription was established for, because the
+// Subscription was updated or the dead letter sink of the channel was resolved since, so that the subscription
+// must be established again to dispatch to the subscriber as it is now.
+func (r subscriptionReference) changed(current subscriptionReference) bool {
+	return !reflect.DeepEqual(r, current)
+}
+
+// ChannelConfig holds the configuration of a channel which affects how its events are dispatched.
+type ChannelConfig struct {
+	// DeadLetterQueue republishes the events which couldn't be delivered to a subscriber without a dead
+	// letter sink to the dead letter subject of the channel.
+	DeadLetterQueue bool
+	// ConnectionProfile is the name of the connection profile of the NATS JetStream servers the channel is
+	// served by, the default servers are used if it's empty.
+	ConnectionProfile string
+	// MessageID is what the ID of the messages published to the stream of the channel is taken from, which the
+	// stream deduplicates them by. The CloudEvent ID is used if it's empty.
+	MessageID v1alpha1.MessageIDSource
+	// DeliveryOrdering is the order the events of the channel are delivered to each subscriber in.
+	DeliveryOrdering v1alpha1.DeliveryOrdering
+}
+
+// PullConsumerConfig holds the settings of the pull consumer a subscriber fetches the events from.
+type PullConsumerConfig struct {
+	// BatchSize is the maximum number of events fetched at once.
+	BatchSize int
+	// FetchTimeout is how long a fetch waits for events when there are none.
+	FetchTimeout time.Duration
+	// Workers is the number of events sent to the subscriber concurrently.
+	Workers int
+}
+
+// dispatchSettings are the settings of a channel and of a subscriber the subscription of the subscriber is
+// established with, it's established again when the settings change.
+type dispatchSettings struct {
+	ordering v1alpha1.DeliveryOrdering
+	pull     PullConsumerConfig
+	// partitionKeyExtension is the CloudEvent extension the events are key ordered by, if any.
+	partitionKeyExtension string
+	// partitions is the number of partitions the key ordered events are spread over.
+	partitions int
+}
+
+func (c ChannelConfig) dispatchSettings(subscriber SubscriberConfig) dispatchSettings {
+	settings := dispatchSettings{ordering: c.DeliveryOrdering}
+	if subscriber.PullConsumer != nil {
+		settings.pull = *subscriber.PullConsumer
+	}
+	// The events of ordered channels are delivered one at a time already.
+	if c.DeliveryOrdering != v1alpha1.OrderedDeliveryOrdering {
+		settings.partitionKeyExtension = subscriber.PartitionKeyExtension
+		settings.partitions = subscriber.Partitions
+	}
+	return settings
+}
+
+// keyOrdered returns true if the events are delivered one at a time per partition key.
+func (s dispatchSettings) keyOrdered() bool {
+	return s.partitionKeyExtension != ""
+}
+
+// pullMode returns true if the subscriptions fetch the events from pull consumers.
+func (s dispatchSettings) pullMode() bool {
+	return s.pull != PullConsumerConfig{}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package natsutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// AuthConfig configures how to authenticate with a NATS server. The credentials are read from files, usually
+// mounted from a Secret, every time a connection is established so that rotated credentials are picked up.
+// Exactly one method must be configured.
+type AuthConfig struct {
+	// CredentialsFile is a .creds file holding a user JWT and its NKey seed.
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+	// NKeySeedFile holds the seed of an NKey user.
+	NKeySeedFile string `json:"nkeySeedFile,omitempty"`
+	// TokenFile holds an authentication token.
+	TokenFile string `json:"tokenFile,omitempty"`
+	// UsernameFile and PasswordFile hold the credentials of a user.
+	UsernameFile string `json:"usernameFile,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty"`
+}
+
+// Validate makes sure that exactly one authentication method is configured.
+func (c *AuthConfig) Validate() error {
+	methods := 0
+	for _, configured := range []bool{
+		c.CredentialsFile != "",
+		c.NKeySeedFile != "",
+		c.TokenFile != "",
+		c.UsernameFile != "" || c.PasswordFile != "",
+	} {
+		if configured {
+			methods++
+		}
+	}
+	switch {
+	case methods == 0:
+		return errors.New("no authentication method configured")
+	case methods > 1:
+		return errors.New("only one of credentials, NKey seed, token or username and password can be configured")
+	case (c.UsernameFile == "") != (c.PasswordFile == ""):
+		return errors.New("both the username and the password are required")
+	}
+	return nil
+}
+
+// files returns the files the credentials are read from.
+func (c *AuthConfig) files() []string {
+	var files []string
+	for _, f := range []string{c.CredentialsFile, c.NKeySeedFile, c.TokenFile, c.UsernameFile, c.PasswordFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// authOption returns an option authenticating the connection with c. The credentials files and tokens are also
+// read again by the client whenever it reconnects.
+func authOption(c *AuthConfig) nats.Option {
+	return func(o *nats.Options) error {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("invalid authentication configuration: %w", err)
+		}
+
+		switch {
+		case c.CredentialsFile != "":
+			return nats.UserCredentials(c.CredentialsFile)(o)
+
+		case c.NKeySeedFile != "":
+			kp, err := readNKeySeed(c.NKeySeedFile)
+			if err != nil {
+				return err
+			}
+			defer kp.Wipe()
+			pub, err := kp.PublicKey()
+			if err != nil {
+				return fmt.Errorf("invalid NKey seed: %w", err)
+			}
+			return nats.Nkey(pub, func(nonce []byte) ([]byte, error) {
+				kp, err := readNKeySeed(c.NKeySeedFile)
+				if err != nil {
+					return nil, err
+				}
+				defer kp.Wipe()
+				return kp.Sign(nonce)
+			})(o)
+
+		case c.TokenFile != "":
+			if _, err := readSecretFile(c.TokenFile); err != nil {
+				return err
+			}
+			// The error is ignored since it would already be reported above, the server rejects the
+			// connection if the token can't be read when reconnecting.
+			return nats.TokenHandler(func() string {
+				token, _ := readSecretFile(c.TokenFile)
+				return token
+			})(o)
+
+		default:
+			username, err := readSecretFile(c.UsernameFile)
+			if err != nil {
+				return err
+			}
+			password, err := readSecretFile(c.PasswordFile)
+			if err != nil {
+				return err
+			}
+			return nats.UserInfo(username, password)(o)
+		}
+	}
+}
+
+func readNKeySeed(file string) (nkeys.KeyPair, error) {
+	seed, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the NKey seed: %w", err)
+	}
+	kp, err := nkeys.FromSeed(bytes.TrimSpace(seed))
+	if err != nil {
+		return nil, fmt.Errorf("invalid NKey seed: %w", err)
+	}
+	return kp, nil
+}
+
+// readSecretFile returns the content of a file mounted from a Secret, without the trailing new line editors add.
+func readSecretFile(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return string(bytes.TrimRight(b, "\r\n")), nil
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package natsutil
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAuthConfigValidate(t *testing.T) {
+	testCases := map[string]struct {
+		config  AuthConfig
+		wantErr bool
+	}{
+		"credentials": {
+			config: AuthConfig{CredentialsFile: "user.creds"},
+		},
+		"username and password": {
+			config: AuthConfig{UsernameFile: "username", PasswordFile: "password"},
+		},
+		"nothing": {
+			wantErr: true,
+		},
+		"token and NKey seed": {
+			config:  AuthConfig{TokenFile: "token", NKeySeedFile: "seed"},
+			wantErr: true,
+		},
+		"username without password": {
+			config:  AuthConfig{UsernameFile: "username"},
+			wantErr: true,
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if err := tc.config.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthOption(t *testing.T) {
+	dir := t.TempDir()
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := user.Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := user.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedFile := writeFile(t, dir, "seed", string(seed)+"\n")
+	tokenFile := writeFile(t, dir, "token", "s3cr3t\n")
+	usernameFile := writeFile(t, dir, "username", "knative")
+	passwordFile := writeFile(t, dir, "password", "passw0rd\n")
+
+	t.Run("NKey seed", func(t *testing.T) {
+		var o nats.Options
+		if err := authOption(&AuthConfig{NKeySeedFile: seedFile})(&o); err != nil {
+			t.Fatal(err)
+		}
+		if o.Nkey != pub {
+			t.Errorf("Nkey = %q, want %q", o.Nkey, pub)
+		}
+		sig, err := o.SignatureCB([]byte("nonce"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := user.Verify([]byte("nonce"), sig); err != nil {
+			t.Errorf("invalid signature: %v", err)
+		}
+	})
+
+	t.Run("token", func(t *testing.T) {
+		var o nats.Options
+		if err := authOption(&AuthConfig{TokenFile: tokenFile})(&o); err != nil {
+			t.Fatal(err)
+		}
+		if got := o.TokenHandler(); got != "s3cr3t" {
+			t.Errorf("token = %q, want %q", got, "s3cr3t")
+		}
+		writeFile(t, dir, "token", "r0t4t3d")
+		if got := o.TokenHandler(); got != "r0t4t3d" {
+			t.Errorf("rotated token = %q, want %q", got, "r0t4t3d")
+		}
+	})
+
+	t.Run("username and password", func(t *testing.T) {
+		var o nats.Options
+		if err := authOption(&AuthConfig{UsernameFile: usernameFile, PasswordFile: passwordFile})(&o); err != nil {
+			t.Fatal(err)
+		}
+		if o.User != "knative" || o.Password != "passw0rd" {
+			t.Errorf("User, Password = %q, %q, want %q, %q", o.User, o.Password, "knative", "passw0rd")
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		var o nats.Options
+		if err := authOption(&AuthConfig{TokenFile: filepath.Join(dir, "missing")})(&o); err == nil {
+			t.Error("authOption() expected an error")
+		}
+	})
+}
+
+func TestWatchConnectionConfig(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := writeFile(t, dir, "token", "s3cr3t")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	go WatchConnectionConfig(ctx, ConnectionConfig{Auth: &AuthConfig{TokenFile: tokenFile}}, 10*time.Millisecond, func() {
+		changed <- struct{}{}
+	})
+
+	// Leave the watcher the time to read the initial content
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-changed:
+		t.Fatal("onChange called before the file changed")
+	default:
+	}
+
+	writeFile(t, dir, "token", "r0t4t3d")
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("onChange not called after the file changed")
+	}
+}
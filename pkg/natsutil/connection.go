@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package natsutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultConnectionProfile is the name of the connection profile of the channels which don't reference one.
+const DefaultConnectionProfile = ""
+
+// ConnectionConfig holds the settings used to connect to a NATS server, besides its URL.
+type ConnectionConfig struct {
+	// TLS secures the connection, a plain connection is used if it's nil.
+	TLS *TLSConfig `json:"tls,omitempty"`
+	// Auth authenticates the connection, no credentials are sent if it's nil.
+	Auth *AuthConfig `json:"auth,omitempty"`
+}
+
+// ConnectionProfile is a NATS server channels can be served by, together with the settings used to connect to it.
+type ConnectionProfile struct {
+	// URL is the URL of the server, or a comma separated list of the URLs of a cluster.
+	URL string `json:"url"`
+	ConnectionConfig
+}
+
+// options returns the NATS options applying the configuration.
+func (c ConnectionConfig) options() []nats.Option {
+	var opts []nats.Option
+	if c.TLS != nil {
+		opts = append(opts, tlsOption(c.TLS))
+	}
+	if c.Auth != nil {
+		opts = append(opts, authOption(c.Auth))
+	}
+	return opts
+}
+
+// files returns the files the configuration is read from.
+func (c ConnectionConfig) files() []string {
+	var files []string
+	if c.TLS != nil {
+		for _, f := range []string{c.TLS.CAFile, c.TLS.CertFile, c.TLS.KeyFile} {
+			if f != "" {
+				files = append(files, f)
+			}
+		}
+	}
+	if c.Auth != nil {
+		files = append(files, c.Auth.files()...)
+	}
+	return files
+}
+
+// WatchConnectionConfig calls onChange whenever the content of one of the files config is read from changes,
+// until ctx is done. The kubelet updates the files of mounted Secrets in place, so they're polled every interval
+// rather than watched.
+func WatchConnectionConfig(ctx context.Context, config ConnectionConfig, interval time.Duration, onChange func()) {
+	files := config.files()
+	if len(files) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := hashFiles(files)
+	for {
+		select {
+		case <-ticker.C:
+			if current := hashFiles(files); current != last {
+				last = current
+				onChange()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// hashFiles returns a digest of the content of files. Files that can't be read are skipped, so that a file
+// showing up or going away also changes the digest.
+func hashFiles(files []string) [sha256.Size]byte {
+	h := sha256.New()
+	for _, f := range files {
+		h.Write([]byte(f))
+		if b, err := ioutil.ReadFile(f); err == nil {
+			h.Write([]byte{1})
+			h.Write(b)
+		}
+		h.Write([]byte{0})
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
@@ -1,45 +1,125 @@
 package natsutil
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/nats-io/nats.go"
 
 	"go.uber.org/zap"
 )
 
 const (
-	//  StreamName is the name of StreamConfig for JetStream
-	StreamName = "K-ORDERS"
+	// streamNamePrefix is prepended to every stream created for a NatsJetStreamChannel, so that
+	// streams managed by Knative are easily told apart from other streams on the same server.
+	streamNamePrefix = "KN"
+
+	// deadLetterStreamNamePrefix is prepended to every dead letter stream created for a NatsJetStreamChannel. It
+	// differs from streamNamePrefix rather than being appended as a suffix, since channel names may end with any
+	// suffix once their dots are replaced.
+	deadLetterStreamNamePrefix = "KNDLQ"
+
+	// eventsSubjectToken is the last token of the subject events published to a channel, or dead lettered by its
+	// subscribers, are stored under.
+	eventsSubjectToken = "events"
 
 	// MaxPending is the maximum outstanding async publishes that can be inflight at one time.
 	MaxPending = 256
 )
 
-// JetStreamConnect creates a new NATS JetStream connection
-func JetStreamConnect(jetStreamUrl string, logger *zap.SugaredLogger) (*nats.Conn, error) {
-	logger.Infof("JetStreamConnect():  jetStreamUrl: %v", jetStreamUrl)
-	nc, err := nats.Connect(jetStreamUrl)
+// JetStreamConnect creates a new NATS JetStream connection. The options are applied on top of the ones of config.
+func JetStreamConnect(jetStreamUrl string, config ConnectionConfig, logger *zap.SugaredLogger, opts ...nats.Option) (*nats.Conn, error) {
+	logger.Infof("JetStreamConnect():  jetStreamUrl: %v; tls: %v; auth: %v", jetStreamUrl, config.TLS != nil, config.Auth != nil)
+	nc, err := nats.Connect(jetStreamUrl, append(config.options(), opts...)...)
 	if err != nil {
+		err = connectError(jetStreamUrl, err)
 		logger.Errorf("Connect(): create new connection failed: %v", err)
 		return nil, err
 	}
 	logger.Infof("Connect(): connection to NATS JetStream established!")
+	return nc, nil
+}
 
-	// Create JetStream Context
-	js, err := nc.JetStream(nats.PublishAsyncMaxPending(MaxPending))
-	if err != nil {
-		logger.Errorf("Connect(): create JetStream connection failed: %v", err)
-		return nil, err
-	}
+// ChannelStreamName returns the name of the JetStream stream backing the channel with the given namespace and name.
+// Namespaces can't contain underscores and names can't contain underscores either, so replacing the dots allowed in
+// names keeps the result unique per channel while satisfying the stream naming rules of JetStream.
+func ChannelStreamName(namespace, name string) string {
+	return streamName(streamNamePrefix, namespace, name)
+}
+
+// ChannelDeadLetterStreamName returns the name of the JetStream stream holding the events which couldn't be
+// delivered to the subscribers of the given channel, when its dead letter queue is enabled. Dead letters are kept
+// apart from the stream of the channel, so that its retention policy and limits don't apply to them.
+func ChannelDeadLetterStreamName(namespace, name string) string {
+	return streamName(deadLetterStreamNamePrefix, namespace, name)
+}
+
+func streamName(prefix, namespace, name string) string {
+	return strings.ToUpper(fmt.Sprintf("%s_%s_%s", prefix, namespace, strings.ReplaceAll(name, ".", "_")))
+}
+
+// ChannelStreamSubjects returns the subjects captured by the stream backing the given channel.
+func ChannelStreamSubjects(namespace, name string) []string {
+	return []string{ChannelStreamName(namespace, name) + ".*"}
+}
+
+// ChannelSubject returns the subject events sent to the given channel are published to.
+func ChannelSubject(namespace, name string) string {
+	return ChannelStreamName(namespace, name) + "." + eventsSubjectToken
+}
+
+// ChannelDeadLetterStreamSubjects returns the subjects captured by the dead letter stream of the given channel.
+func ChannelDeadLetterStreamSubjects(namespace, name string) []string {
+	return []string{ChannelDeadLetterStreamName(namespace, name) + ".*"}
+}
+
+// ChannelDeadLetterSubject returns the subject the events which couldn't be delivered to the subscribers of the
+// given channel are published to, when its dead letter queue is enabled.
+func ChannelDeadLetterSubject(namespace, name string) string {
+	return ChannelDeadLetterStreamName(namespace, name) + "." + eventsSubjectToken
+}
+
+// IsStreamNotFound returns true if err was returned by the JetStream API because a stream doesn't exist.
+func IsStreamNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "stream not found")
+}
+
+// IsConsumerNotFound returns true if err was returned by the JetStream API because a consumer doesn't exist.
+func IsConsumerNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "consumer not found")
+}
+
+// streamLimitErrors are the descriptions of the errors returned by the JetStream API when a stream rejects a
+// message because it reached its limits, with the Discard New policy, or because the account ran out of resources.
+var streamLimitErrors = []string{
+	"maximum messages exceeded",
+	"maximum messages per subject exceeded",
+	"maximum bytes exceeded",
+	"resource limits exceeded",
+	"insufficient resources",
+}
 
-	streamConfig := nats.StreamConfig{
-		Name:     StreamName,
-		Subjects: []string{StreamName + ".*"},
+// IsStreamLimitExceeded returns true if err was returned by the JetStream API because a stream rejected a message
+// due to its limits.
+func IsStreamLimitExceeded(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, description := range streamLimitErrors {
+		if strings.Contains(err.Error(), description) {
+			return true
+		}
 	}
+	return false
+}
 
-	_, err = js.AddStream(&streamConfig)
-	if err != nil {
-		logger.Errorf("Connect(): AddStream %#v failed: %v", streamConfig, err)
-		return nil, err
+// NakWithDelay negatively acknowledges a JetStream message, asking the server to redeliver it once delay
+// has elapsed. The vendored client doesn't support delayed NAKs yet, so the ack protocol message is sent
+// as is; servers that don't understand the delay redeliver the message right away.
+func NakWithDelay(msg *nats.Msg, delay time.Duration) error {
+	if delay <= 0 {
+		return msg.Nak()
 	}
-	return nc, nil
+	return msg.Respond([]byte(fmt.Sprintf(`-NAK {"delay": %d}`, delay.Nanoseconds())))
 }
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package natsutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestChannelStreamName(t *testing.T) {
+	testCases := map[string]struct {
+		namespace             string
+		name                  string
+		wantStream            string
+		wantSubject           string
+		wantDeadLetterStream  string
+		wantDeadLetterSubject string
+	}{
+		"simple name": {
+			namespace:             "default",
+			name:                  "my-channel",
+			wantStream:            "KN_DEFAULT_MY-CHANNEL",
+			wantSubject:           "KN_DEFAULT_MY-CHANNEL.events",
+			wantDeadLetterStream:  "KNDLQ_DEFAULT_MY-CHANNEL",
+			wantDeadLetterSubject: "KNDLQ_DEFAULT_MY-CHANNEL.events",
+		},
+		"dotted name": {
+			namespace:             "team-a",
+			name:                  "orders.v1",
+			wantStream:            "KN_TEAM-A_ORDERS_V1",
+			wantSubject:           "KN_TEAM-A_ORDERS_V1.events",
+			wantDeadLetterStream:  "KNDLQ_TEAM-A_ORDERS_V1",
+			wantDeadLetterSubject: "KNDLQ_TEAM-A_ORDERS_V1.events",
+		},
+		"name ending like a dead letter stream": {
+			namespace:             "default",
+			name:                  "my-channel.dlq",
+			wantStream:            "KN_DEFAULT_MY-CHANNEL_DLQ",
+			wantSubject:           "KN_DEFAULT_MY-CHANNEL_DLQ.events",
+			wantDeadLetterStream:  "KNDLQ_DEFAULT_MY-CHANNEL_DLQ",
+			wantDeadLetterSubject: "KNDLQ_DEFAULT_MY-CHANNEL_DLQ.events",
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if got := ChannelStreamName(tc.namespace, tc.name); got != tc.wantStream {
+				t.Errorf("ChannelStreamName() = %q, want %q", got, tc.wantStream)
+			}
+			if got := ChannelSubject(tc.namespace, tc.name); got != tc.wantSubject {
+				t.Errorf("ChannelSubject() = %q, want %q", got, tc.wantSubject)
+			}
+			if got := ChannelDeadLetterStreamName(tc.namespace, tc.name); got != tc.wantDeadLetterStream {
+				t.Errorf("ChannelDeadLetterStreamName() = %q, want %q", got, tc.wantDeadLetterStream)
+			}
+			if got := ChannelDeadLetterSubject(tc.namespace, tc.name); got != tc.wantDeadLetterSubject {
+				t.Errorf("ChannelDeadLetterSubject() = %q, want %q", got, tc.wantDeadLetterSubject)
+			}
+			if diff := cmp.Diff([]string{tc.wantStream + ".*"}, ChannelStreamSubjects(tc.namespace, tc.name)); diff != "" {
+				t.Errorf("ChannelStreamSubjects() (-want, +got) = %v", diff)
+			}
+			if diff := cmp.Diff([]string{tc.wantDeadLetterStream + ".*"}, ChannelDeadLetterStreamSubjects(tc.namespace, tc.name)); diff != "" {
+				t.Errorf("ChannelDeadLetterStreamSubjects() (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestIsStreamNotFound(t *testing.T) {
+	if !IsStreamNotFound(errors.New("stream not found")) {
+		t.Error("IsStreamNotFound() = false, want true")
+	}
+	if IsStreamNotFound(errors.New("stream name already in use")) {
+		t.Error("IsStreamNotFound() = true, want false")
+	}
+	if IsStreamNotFound(nil) {
+		t.Error("IsStreamNotFound(nil) = true, want false")
+	}
+}
+
+func TestIsConsumerNotFound(t *testing.T) {
+	if !IsConsumerNotFound(errors.New("consumer not found")) {
+		t.Error("IsConsumerNotFound() = false, want true")
+	}
+	if IsConsumerNotFound(errors.New("stream not found")) {
+		t.Error("IsConsumerNotFound() = true, want false")
+	}
+}
+
+func TestIsStreamLimitExceeded(t *testing.T) {
+	testCases := map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":              {},
+		"maximum messages": {err: errors.New("nats: maximum messages exceeded"), want: true},
+		"maximum bytes":    {err: errors.New("nats: maximum bytes exceeded"), want: true},
+		"account limits":   {err: errors.New("nats: resource limits exceeded for account"), want: true},
+		"stream not found": {err: errors.New("nats: stream not found")},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if got := IsStreamLimitExceeded(tc.err); got != tc.want {
+				t.Errorf("IsStreamLimitExceeded() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package natsutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// JetStreamPool keeps a connection to the NATS JetStream servers of every connection profile in use. Connections
+// are established on first use, and replaced once they're closed or their profile changes.
+type JetStreamPool struct {
+	logger *zap.SugaredLogger
+
+	// mux protects profiles, conns and dials. Connections are established without holding it, so that a
+	// profile whose servers are slow to answer doesn't hold up the others.
+	mux      sync.Mutex
+	profiles map[string]ConnectionProfile
+	conns    map[string]*nats.Conn
+	// dials are the connections being established per profile, shared by the callers waiting for them so
+	// that a profile is never connected to twice.
+	dials map[string]*dial
+}
+
+// dial is a connection being established to the servers of a connection profile.
+type dial struct {
+	done chan struct{}
+	nc   *nats.Conn
+	err  error
+}
+
+// NewJetStreamPool returns a JetStreamPool connecting to the given profiles.
+func NewJetStreamPool(profiles map[string]ConnectionProfile, logger *zap.SugaredLogger) *JetStreamPool {
+	return &JetStreamPool{
+		logger:   logger,
+		profiles: profiles,
+		conns:    make(map[string]*nats.Conn),
+		dials:    make(map[string]*dial),
+	}
+}
+
+// SetProfiles replaces the connection profiles. The connections of the profiles which changed or were removed
+// are closed.
+func (p *JetStreamPool) SetProfiles(profiles map[string]ConnectionProfile) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	for name, nc := range p.conns {
+		if profile, ok := profiles[name]; !ok || !reflect.DeepEqual(profile, p.profiles[name]) {
+			p.logger.Infow("Connection profile changed, closing its connection", zap.String("profile", name))
+			nc.Close()
+			delete(p.conns, name)
+		}
+	}
+	p.profiles = profiles
+}
+
+// Conn returns the connection to the servers of the named connection profile.
+func (p *JetStreamPool) Conn(name string) (*nats.Conn, error) {
+	p.mux.Lock()
+	if nc, ok := p.conns[name]; ok && !nc.IsClosed() {
+		p.mux.Unlock()
+		return nc, nil
+	}
+	if d, ok := p.dials[name]; ok {
+		p.mux.Unlock()
+		<-d.done
+		return d.nc, d.err
+	}
+	profile, ok := p.profiles[name]
+	if !ok {
+		p.mux.Unlock()
+		return nil, fmt.Errorf("unknown connection profile %q", name)
+	}
+	d := &dial{done: make(chan struct{})}
+	p.dials[name] = d
+	p.mux.Unlock()
+
+	d.nc, d.err = JetStreamConnect(profile.URL, profile.ConnectionConfig, p.logger)
+
+	p.mux.Lock()
+	delete(p.dials, name)
+	if d.err == nil {
+		if current, ok := p.profiles[name]; ok && reflect.DeepEqual(current, profile) {
+			p.conns[name] = d.nc
+		} else {
+			// SetProfiles couldn't close the connection while it was being established.
+			d.nc.Close()
+			d.nc, d.err = nil, fmt.Errorf("connection profile %q changed while connecting", name)
+		}
+	}
+	p.mux.Unlock()
+	close(d.done)
+	return d.nc, d.err
+}
+
+// JetStream returns the JetStream context of the connection to the servers of the named connection profile.
+func (p *JetStreamPool) JetStream(name string) (nats.JetStreamContext, error) {
+	nc, err := p.Conn(name)
+	if err != nil {
+		return nil, err
+	}
+	return nc.JetStream()
+}
+
+// WatchConnectionConfigs closes the connection of a profile whenever the content of one of the files its
+// configuration is read from changes, until ctx is done, so that rotated credentials and certificates are used
+// by the next connection. The files are polled every interval, like WatchConnectionConfig does.
+func (p *JetStreamPool) WatchConnectionConfigs(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := make(map[string][sha256.Size]byte)
+	for {
+		p.mux.Lock()
+		profiles := p.profiles
+		p.mux.Unlock()
+
+		current := make(map[string][sha256.Size]byte, len(profiles))
+		for name, profile := range profiles {
+			if files := profile.ConnectionConfig.files(); len(files) > 0 {
+				current[name] = hashFiles(files)
+			}
+		}
+		for name, sum := range current {
+			if previous, ok := last[name]; ok && previous != sum {
+				p.reset(name)
+			}
+		}
+		last = current
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reset closes the connection of the named profile, the next caller connects again.
+func (p *JetStreamPool) reset(name string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if nc, ok := p.conns[name]; ok {
+		p.logger.Infow("Connection configuration files changed, closing the connection", zap.String("profile", name))
+		nc.Close()
+		delete(p.conns, name)
+	}
+}
+
+// Close closes all the connections of the pool.
+func (p *JetStreamPool) Close() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	for name, nc := range p.conns {
+		nc.Close()
+		delete(p.conns, name)
+	}
+}
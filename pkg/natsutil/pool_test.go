@@ -0,0 +1,183 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package natsutil
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestJetStreamPool(t *testing.T) {
+	pool := NewJetStreamPool(map[string]ConnectionProfile{
+		DefaultConnectionProfile: {URL: "nats://127.0.0.1:1"},
+	}, zap.NewNop().Sugar())
+	defer pool.Close()
+
+	if _, err := pool.JetStream("eu-west"); err == nil || !strings.Contains(err.Error(), "unknown connection profile") {
+		t.Errorf("JetStream(eu-west) error = %v, want an unknown connection profile error", err)
+	}
+	if _, err := pool.JetStream(DefaultConnectionProfile); err == nil {
+		t.Error("JetStream() expected a connection error")
+	}
+
+	pool.SetProfiles(map[string]ConnectionProfile{
+		"eu-west": {URL: "nats://127.0.0.1:1"},
+	})
+	if _, err := pool.JetStream(DefaultConnectionProfile); err == nil || !strings.Contains(err.Error(), "unknown connection profile") {
+		t.Errorf("JetStream() error = %v, want an unknown connection profile error", err)
+	}
+	if _, err := pool.JetStream("eu-west"); err == nil || strings.Contains(err.Error(), "unknown connection profile") {
+		t.Errorf("JetStream(eu-west) error = %v, want a connection error", err)
+	}
+}
+
+func TestJetStreamPoolDialsOutsideTheLock(t *testing.T) {
+	// The server accepts connections but never answers, so connecting to it blocks until the client times out.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	pool := NewJetStreamPool(map[string]ConnectionProfile{
+		DefaultConnectionProfile: {URL: "nats://" + l.Addr().String()},
+	}, zap.NewNop().Sugar())
+	defer pool.Close()
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := pool.Conn(DefaultConnectionProfile)
+			errs <- err
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pool.SetProfiles(map[string]ConnectionProfile{
+			DefaultConnectionProfile: {URL: "nats://" + l.Addr().String()},
+		})
+		if _, err := pool.Conn("eu-west"); err == nil || !strings.Contains(err.Error(), "unknown connection profile") {
+			t.Errorf("Conn(eu-west) error = %v, want an unknown connection profile error", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the pool is locked while connecting")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			t.Error("Conn() expected a connection error")
+		}
+	}
+}
+
+// serveFakeNATS answers the handshake of the NATS clients connecting to l, and their pings.
+func serveFakeNATS(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(c net.Conn) {
+			defer c.Close()
+			if _, err := c.Write([]byte("INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")); err != nil {
+				return
+			}
+			r := bufio.NewReader(c)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if strings.HasPrefix(line, "PING") {
+					if _, err := c.Write([]byte("PONG\r\n")); err != nil {
+						return
+					}
+				}
+			}
+		}(c)
+	}
+}
+
+func TestJetStreamPoolWatchConnectionConfigs(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serveFakeNATS(l)
+
+	dir := t.TempDir()
+	tokenFile := writeFile(t, dir, "token", "s3cr3t")
+	pool := NewJetStreamPool(map[string]ConnectionProfile{
+		DefaultConnectionProfile: {
+			URL:              "nats://" + l.Addr().String(),
+			ConnectionConfig: ConnectionConfig{Auth: &AuthConfig{TokenFile: tokenFile}},
+		},
+	}, zap.NewNop().Sugar())
+	defer pool.Close()
+
+	nc, err := pool.Conn(DefaultConnectionProfile)
+	if err != nil {
+		t.Fatal("Conn() =", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pool.WatchConnectionConfigs(ctx, 10*time.Millisecond)
+
+	// Leave the watcher the time to read the initial content
+	time.Sleep(50 * time.Millisecond)
+	if nc.IsClosed() {
+		t.Fatal("connection closed before the files changed")
+	}
+
+	writeFile(t, dir, "token", "r0t4t3d")
+	deadline := time.Now().Add(5 * time.Second)
+	for !nc.IsClosed() {
+		if time.Now().After(deadline) {
+			t.Fatal("connection not closed after the files changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	reconnected, err := pool.Conn(DefaultConnectionProfile)
+	if err != nil {
+		t.Fatal("Conn() =", err)
+	}
+	if reconnected == nc {
+		t.Error("Conn() returned the closed connection")
+	}
+}
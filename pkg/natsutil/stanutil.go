@@ -17,19 +17,55 @@
 package natsutil
 
 import (
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/stan.go"
 
 	"go.uber.org/zap"
 )
 
 // Connect creates a new NATS-Streaming connection
-func Connect(clusterId string, clientId string, natsUrl string, logger *zap.SugaredLogger) (*stan.Conn, error) {
-	logger.Infof("Connect(): clusterId: %v; clientId: %v; natssUrl: %v", clusterId, clientId, natsUrl)
-	sc, err := stan.Connect(clusterId, clientId, stan.NatsURL(natsUrl))
+func Connect(clusterId string, clientId string, natsUrl string, config ConnectionConfig, logger *zap.SugaredLogger) (*stan.Conn, error) {
+	logger.Infof("Connect(): clusterId: %v; clientId: %v; natssUrl: %v; tls: %v; auth: %v", clusterId, clientId, natsUrl, config.TLS != nil, config.Auth != nil)
+	stanOpts := []stan.Option{stan.NatsURL(natsUrl)}
+	var nc *nats.Conn
+	if opts := config.options(); len(opts) > 0 {
+		// NATS-Streaming doesn't take NATS options, so the underlying connection is created here and closed
+		// together with the streaming connection.
+		var err error
+		nc, err = nats.Connect(natsUrl, append(opts, nats.Name(clientId))...)
+		if err != nil {
+			err = connectError(natsUrl, err)
+			logger.Errorf("Connect(): create new connection failed: %v", err)
+			return nil, err
+		}
+		stanOpts = append(stanOpts, stan.NatsConn(nc), stan.SetConnectionLostHandler(func(_ stan.Conn, _ error) {
+			nc.Close()
+		}))
+	}
+	sc, err := stan.Connect(clusterId, clientId, stanOpts...)
 	if err != nil {
+		if nc != nil {
+			nc.Close()
+		}
 		logger.Errorf("Connect(): create new connection failed: %v", err)
 		return nil, err
 	}
 	logger.Infof("Connect(): connection to NATSS established, natsConn=%+v", &sc)
+	if nc != nil {
+		sc = &ownedConn{Conn: sc, nc: nc}
+	}
 	return &sc, nil
 }
+
+// ownedConn is a NATS-Streaming connection over a NATS connection created by Connect. Closing a streaming
+// connection doesn't close a NATS connection it was given, so it's closed here once the streaming one is.
+type ownedConn struct {
+	stan.Conn
+	nc *nats.Conn
+}
+
+func (c *ownedConn) Close() error {
+	err := c.Conn.Close()
+	c.nc.Close()
+	return err
+}
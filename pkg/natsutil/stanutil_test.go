@@ -17,8 +17,11 @@ limitations under the License.
 package natsutil
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/stan.go"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"knative.dev/pkg/logging"
@@ -101,7 +104,7 @@ import (
 //}
 
 func TestConnect(t *testing.T) {
-	_, err := Connect("localhost", "my-client", "localhost", setupLogger())
+	_, err := Connect("localhost", "my-client", "localhost", ConnectionConfig{}, setupLogger())
 	if err == nil {
 		t.Errorf("Connect() expecting err")
 		return
@@ -138,3 +141,34 @@ func setupLogger() *zap.SugaredLogger {
 	logger, _ := logging.NewLoggerFromConfig(newLoggingConfig(), "stanutil_test")
 	return logger
 }
+
+// fakeStanConn is a NATS-Streaming connection which only records whether it was closed.
+type fakeStanConn struct {
+	stan.Conn
+	closed bool
+}
+
+func (c *fakeStanConn) Close() error {
+	c.closed = true
+	return errors.New("close failed")
+}
+
+func TestOwnedConnClose(t *testing.T) {
+	sc := &fakeStanConn{}
+	// Retrying the failed connection returns a connection without any server listening.
+	nc, err := nats.Connect("nats://127.0.0.1:1", nats.RetryOnFailedConnect(true), nats.MaxReconnects(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &ownedConn{Conn: sc, nc: nc}
+
+	if err := conn.Close(); err == nil {
+		t.Error("Close() didn't return the error of the streaming connection")
+	}
+	if !sc.closed {
+		t.Error("the streaming connection wasn't closed")
+	}
+	if !nc.IsClosed() {
+		t.Error("the NATS connection wasn't closed")
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package natsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/nats-io/nats.go"
+)
+
+// TLSConfig configures a TLS connection to a NATS server. The files are usually mounted from Secrets.
+type TLSConfig struct {
+	// CAFile is the PEM encoded CA bundle used to verify the certificate of the server. The system
+	// CAs are used if it's empty.
+	CAFile string `json:"caFile,omitempty"`
+	// CertFile and KeyFile are the PEM encoded certificate and key the client authenticates with, for
+	// mutual TLS. Both or none must be set.
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// ServerName is the name the certificate of the server is verified against, instead of the host of the URL.
+	ServerName string `json:"serverName,omitempty"`
+	// InsecureSkipVerify disables the verification of the certificate of the server.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// Build loads the files of the configuration and returns the resulting tls.Config.
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in the CA bundle %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("both the client certificate and key are required for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// tlsOption returns an option securing the connection with c. The files are loaded every time a connection is
+// established, so that renewed certificates are picked up when reconnecting.
+func tlsOption(c *TLSConfig) nats.Option {
+	return func(o *nats.Options) error {
+		tlsConfig, err := c.Build()
+		if err != nil {
+			return fmt.Errorf("invalid TLS configuration: %w", err)
+		}
+		o.Secure = true
+		o.TLSConfig = tlsConfig
+		return nil
+	}
+}
+
+// connectError adds a hint about the likely cause to the errors returned when a TLS connection can't be established.
+func connectError(url string, err error) error {
+	var (
+		unknownAuthorityErr x509.UnknownAuthorityError
+		hostnameErr         x509.HostnameError
+		invalidCertErr      x509.CertificateInvalidError
+		recordHeaderErr     tls.RecordHeaderError
+	)
+	switch {
+	case errors.Is(err, nats.ErrSecureConnRequired):
+		return fmt.Errorf("connecting to %s: the server requires TLS, configure TLS or use a tls:// URL: %w", url, err)
+	case errors.Is(err, nats.ErrSecureConnWanted):
+		return fmt.Errorf("connecting to %s: TLS is configured but the server doesn't support it: %w", url, err)
+	case errors.As(err, &unknownAuthorityErr):
+		return fmt.Errorf("TLS handshake with %s failed, the server certificate isn't signed by the configured CA bundle: %w", url, err)
+	case errors.As(err, &hostnameErr):
+		return fmt.Errorf("TLS handshake with %s failed, the server certificate isn't valid for the server name: %w", url, err)
+	case errors.As(err, &invalidCertErr):
+		return fmt.Errorf("TLS handshake with %s failed, the server certificate is invalid: %w", url, err)
+	case errors.As(err, &recordHeaderErr):
+		return fmt.Errorf("TLS handshake with %s failed, the server didn't answer with TLS: %w", url, err)
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package natsutil
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestTLSConfigBuild(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not-pem")
+	if err := ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		config  TLSConfig
+		wantErr string
+	}{
+		"system CAs": {
+			config: TLSConfig{ServerName: "nats.example.com"},
+		},
+		"missing CA bundle": {
+			config:  TLSConfig{CAFile: filepath.Join(dir, "missing")},
+			wantErr: "failed to read the CA bundle",
+		},
+		"invalid CA bundle": {
+			config:  TLSConfig{CAFile: notPEM},
+			wantErr: "no valid certificate found",
+		},
+		"client certificate without key": {
+			config:  TLSConfig{CertFile: notPEM},
+			wantErr: "both the client certificate and key are required",
+		},
+		"invalid client certificate": {
+			config:  TLSConfig{CertFile: notPEM, KeyFile: notPEM},
+			wantErr: "failed to load the client certificate",
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, err := tc.config.Build()
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Build() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() unexpected error: %v", err)
+			}
+			if got.ServerName != tc.config.ServerName {
+				t.Errorf("ServerName = %q, want %q", got.ServerName, tc.config.ServerName)
+			}
+		})
+	}
+}
+
+func TestJetStreamConnectInvalidTLS(t *testing.T) {
+	config := ConnectionConfig{TLS: &TLSConfig{CertFile: "tls.crt"}}
+	_, err := JetStreamConnect("nats://localhost:4222", config, setupLogger())
+	if err == nil || !strings.Contains(err.Error(), "invalid TLS configuration") {
+		t.Errorf("JetStreamConnect() error = %v, want an invalid TLS configuration error", err)
+	}
+}
+
+func TestConnectError(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		wantHint string
+	}{
+		"TLS required": {
+			err:      nats.ErrSecureConnRequired,
+			wantHint: "the server requires TLS",
+		},
+		"TLS not available": {
+			err:      nats.ErrSecureConnWanted,
+			wantHint: "the server doesn't support it",
+		},
+		"unknown authority": {
+			err:      x509.UnknownAuthorityError{},
+			wantHint: "isn't signed by the configured CA bundle",
+		},
+		"other error": {
+			err:      errors.New("nats: no servers available for connection"),
+			wantHint: "nats: no servers available for connection",
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got := connectError("tls://nats:4222", fmt.Errorf("wrapped: %w", tc.err))
+			if !strings.Contains(got.Error(), tc.wantHint) {
+				t.Errorf("connectError() = %v, want it to contain %q", got, tc.wantHint)
+			}
+			if !errors.Is(got, tc.err) {
+				t.Errorf("connectError() = %v, doesn't wrap %v", got, tc.err)
+			}
+		})
+	}
+}
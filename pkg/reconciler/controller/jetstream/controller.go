@@ -18,24 +18,34 @@ package jetstream
 
 import (
 	"context"
+	"time"
 
+	_ "knative.dev/pkg/client/injection/ducks/duck/v1/addressable"
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
 	deploymentinformer "knative.dev/pkg/client/injection/kube/informers/apps/v1/deployment"
 	"knative.dev/pkg/client/injection/kube/informers/core/v1/endpoints"
 	"knative.dev/pkg/client/injection/kube/informers/core/v1/service"
+	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
+	"knative.dev/pkg/resolver"
 	"knative.dev/pkg/system"
 
 	"k8s.io/client-go/tools/cache"
 
 	"knative.dev/eventing-natss/pkg/client/injection/informers/messaging/v1alpha1/natsjetstreamchannel"
 	jetstreamchannelreconciler "knative.dev/eventing-natss/pkg/client/injection/reconciler/messaging/v1alpha1/natsjetstreamchannel"
+	"knative.dev/eventing-natss/pkg/config"
+	"knative.dev/eventing-natss/pkg/natsutil"
+	"knative.dev/eventing-natss/pkg/util"
 )
 
+// connectionConfigWatchInterval is how often the files of the connection configurations are checked for changes.
+const connectionConfigWatchInterval = 10 * time.Second
+
 // NewController initializes the controller and is called by the generated code.
 // Registers event handlers to enqueue events.
-func NewController(ctx context.Context) *controller.Impl {
+func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
 
 	logger := logging.FromContext(ctx)
 	channelInformer := natsjetstreamchannel.Get(ctx)
@@ -44,6 +54,22 @@ func NewController(ctx context.Context) *controller.Impl {
 	endpointsInformer := endpoints.Get(ctx)
 	kubeClient := kubeclient.Get(ctx)
 
+	// The servers are connected to when a channel served by them is reconciled, and their connection profiles
+	// are kept up to date with the config-nats ConfigMap.
+	defaultConnection := util.GetConnectionConfig()
+	jetStreamPool := natsutil.NewJetStreamPool(map[string]natsutil.ConnectionProfile{
+		natsutil.DefaultConnectionProfile: {URL: util.GetDefaultJetStreamURL(), ConnectionConfig: defaultConnection},
+	}, logger)
+	config.Watch(cmw, logger, func(natsConfig *config.NatsConfig) {
+		jetStreamPool.SetProfiles(natsConfig.JetStreamProfiles(defaultConnection))
+	})
+	// The connections are established again with the rotated credentials and certificates of the mounted Secrets.
+	go jetStreamPool.WatchConnectionConfigs(ctx, connectionConfigWatchInterval)
+	go func() {
+		<-ctx.Done()
+		jetStreamPool.Close()
+	}()
+
 	r := &Reconciler{
 		kubeClientSet:            kubeClient,
 		dispatcherNamespace:      system.Namespace(),
@@ -52,9 +78,22 @@ func NewController(ctx context.Context) *controller.Impl {
 		deploymentLister:         deploymentInformer.Lister(),
 		serviceLister:            serviceInformer.Lister(),
 		endpointsLister:          endpointsInformer.Lister(),
+		streamManager: func(profile string) (streamManager, error) {
+			js, err := jetStreamPool.JetStream(profile)
+			if err != nil {
+				return nil, err
+			}
+			return js, nil
+		},
 	}
 
-	impl := jetstreamchannelreconciler.NewImpl(ctx, r)
+	impl := jetstreamchannelreconciler.NewImpl(ctx, r, func(impl *controller.Impl) controller.Options {
+		return controller.Options{
+			AgentName:     controllerAgentName,
+			FinalizerName: finalizerName,
+		}
+	})
+	r.uriResolver = resolver.NewURIResolverFromTracker(ctx, impl.Tracker)
 
 	logger.Info("Setting up event handlers")
 	channelInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
@@ -19,13 +19,17 @@ package jetstream
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/nats-io/nats.go"
 	"go.uber.org/zap"
 
 	"knative.dev/pkg/apis"
+	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/network"
 	"knative.dev/pkg/reconciler"
+	"knative.dev/pkg/resolver"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
@@ -36,6 +40,7 @@ import (
 
 	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
 	natssChannelReconciler "knative.dev/eventing-natss/pkg/client/injection/reconciler/messaging/v1alpha1/natsjetstreamchannel"
+	"knative.dev/eventing-natss/pkg/natsutil"
 	"knative.dev/eventing-natss/pkg/reconciler/controller/jetstream/resources"
 )
 
@@ -48,10 +53,33 @@ const (
 	dispatcherEndpointsNotFound  = "DispatcherEndpointsDoesNotExist"
 	dispatcherEndpointsFailed    = "DispatcherEndpointsFailed"
 	channelServiceFailed         = "ChannelServiceFailed"
+	streamFailed                 = "StreamFailed"
+	streamConfigDrift            = "StreamConfigDrift"
+	streamCreated                = "StreamCreated"
+	streamUpdated                = "StreamUpdated"
+	streamDeleted                = "StreamDeleted"
+	streamDeleteFailed           = "StreamDeleteFailed"
+	deadLetterSinkUnresolvable   = "DeadLetterSinkUnresolvable"
 
 	dispatcherName = "jetstream-ch-dispatcher"
+
+	// controllerAgentName is the string used by this controller to identify
+	// itself when creating events.
+	controllerAgentName = "jetstream-ch-controller"
+
+	// finalizerName is distinct from the one used by the dispatcher, so that the stream is only
+	// deleted by this controller once the channel goes away.
+	finalizerName = controllerAgentName
 )
 
+// streamManager manages the JetStream streams backing the channels. It's implemented by nats.JetStreamContext.
+type streamManager interface {
+	StreamInfo(stream string, opts ...nats.JSOpt) (*nats.StreamInfo, error)
+	AddStream(cfg *nats.StreamConfig, opts ...nats.JSOpt) (*nats.StreamInfo, error)
+	UpdateStream(cfg *nats.StreamConfig, opts ...nats.JSOpt) (*nats.StreamInfo, error)
+	DeleteStream(name string, opts ...nats.JSOpt) error
+}
+
 // Reconciler reconciles NATS JetStream Channels.
 type Reconciler struct {
 	kubeClientSet kubernetes.Interface
@@ -63,9 +91,16 @@ type Reconciler struct {
 	deploymentLister appsv1listers.DeploymentLister
 	serviceLister    corev1listers.ServiceLister
 	endpointsLister  corev1listers.EndpointsLister
+
+	// streamManager returns the stream manager of the JetStream servers of a connection profile, which hold the
+	// streams backing the channels.
+	streamManager func(profile string) (streamManager, error)
+
+	uriResolver *resolver.URIResolver
 }
 
 var _ natssChannelReconciler.Interface = (*Reconciler)(nil)
+var _ natssChannelReconciler.Finalizer = (*Reconciler)(nil)
 
 func (r *Reconciler) ReconcileKind(ctx context.Context, nc *v1alpha1.NatsJetStreamChannel) reconciler.Event {
 	logger := logging.FromContext(ctx)
@@ -75,6 +110,8 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, nc *v1alpha1.NatsJetStre
 	// 2. Dispatcher k8s Service for it's existence.
 	// 3. Dispatcher endpoints to ensure that there's something backing the Service.
 	// 4. K8s service representing the channel that will use ExternalName to point to the Dispatcher k8s service.
+	// 5. JetStream stream the channel persists its events to.
+	// 6. Dead letter sink of the channel, used by the subscribers without their own delivery spec.
 
 	// Get the Dispatcher Deployment and propagate the status to the Channel
 	if d, err := r.deploymentLister.Deployments(r.dispatcherNamespace).Get(r.dispatcherDeploymentName); err != nil {
@@ -130,11 +167,58 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, nc *v1alpha1.NatsJetStre
 		})
 	}
 
+	// Reconcile the JetStream stream the dispatcher publishes the events sent to this Channel to.
+	if err := r.reconcileStream(ctx, nc); err != nil {
+		return err
+	}
+
+	// Resolve the dead letter sink so that the dispatcher, which can't resolve references, can use it.
+	if nc.Spec.Delivery != nil && nc.Spec.Delivery.DeadLetterSink != nil {
+		deadLetterSinkURI, err := r.uriResolver.URIFromDestinationV1(ctx, *nc.Spec.Delivery.DeadLetterSink, nc)
+		if err != nil {
+			logger.Errorw("Unable to get the dead letter sink's URI", zap.Error(err))
+			nc.Status.MarkDeadLetterSinkResolvedFailed(deadLetterSinkUnresolvable, "Failed to resolve the dead letter sink: %s", err)
+			return fmt.Errorf("failed to resolve the dead letter sink URI: %w", err)
+		}
+		nc.Status.MarkDeadLetterSinkResolvedSucceeded(deadLetterSinkURI)
+	} else {
+		nc.Status.MarkDeadLetterSinkNotConfigured()
+	}
+
 	// Ok, so now the Dispatcher Deployment & Service have been created, we're golden since the
 	// dispatcher watches the Channel and where it needs to dispatch events to.
 	return nil
 }
 
+// FinalizeKind deletes the JetStream stream backing the channel, together with all the messages
+// and consumers it holds, and its dead letter stream.
+func (r *Reconciler) FinalizeKind(ctx context.Context, nc *v1alpha1.NatsJetStreamChannel) reconciler.Event {
+	logger := logging.FromContext(ctx)
+
+	js, err := r.streamManager(nc.ConnectionProfileName())
+	if err != nil {
+		logger.Errorw("Failed to connect to NATS JetStream", zap.String("profile", nc.ConnectionProfileName()), zap.Error(err))
+		return fmt.Errorf("%w", reconciler.NewEvent(corev1.EventTypeWarning, streamDeleteFailed, "Failed to connect to NATS JetStream: %v", err))
+	}
+	// The dead letter stream is deleted even if the dead letter queue is disabled, it may have been enabled before.
+	streamNames := []string{
+		natsutil.ChannelStreamName(nc.Namespace, nc.Name),
+		natsutil.ChannelDeadLetterStreamName(nc.Namespace, nc.Name),
+	}
+	for _, streamName := range streamNames {
+		if err := js.DeleteStream(streamName); err != nil {
+			if natsutil.IsStreamNotFound(err) {
+				continue
+			}
+			logger.Errorw("Failed to delete the stream", zap.String("stream", streamName), zap.Error(err))
+			return fmt.Errorf("%w", reconciler.NewEvent(corev1.EventTypeWarning, streamDeleteFailed, "Failed to delete stream %q: %v", streamName, err))
+		}
+		logger.Infow("Stream deleted", zap.String("stream", streamName))
+		controller.GetEventRecorder(ctx).Eventf(nc, corev1.EventTypeNormal, streamDeleted, "Stream %q deleted", streamName)
+	}
+	return nil
+}
+
 func (r *Reconciler) reconcileChannelService(ctx context.Context, channel *v1alpha1.NatsJetStreamChannel) (*corev1.Service, error) {
 	logger := logging.FromContext(ctx)
 	// Get the  Service and propagate the status to the Channel in case it does not exist.
@@ -165,3 +249,66 @@ func (r *Reconciler) reconcileChannelService(ctx context.Context, channel *v1alp
 	}
 	return svc, nil
 }
+
+// reconcileStream makes sure the JetStream stream backing the channel exists with the desired configuration,
+// and reports any drift which couldn't be corrected in the channel status.
+func (r *Reconciler) reconcileStream(ctx context.Context, nc *v1alpha1.NatsJetStreamChannel) error {
+	logger := logging.FromContext(ctx)
+
+	js, err := r.streamManager(nc.ConnectionProfileName())
+	if err != nil {
+		logger.Errorw("Failed to connect to NATS JetStream", zap.String("profile", nc.ConnectionProfileName()), zap.Error(err))
+		nc.Status.MarkStreamFailed(streamFailed, "Failed to connect to NATS JetStream: %s", err)
+		return fmt.Errorf("%w", reconciler.NewEvent(corev1.EventTypeWarning, streamFailed, "Failed to connect to NATS JetStream: %v", err))
+	}
+
+	wants := []*nats.StreamConfig{resources.MakeStreamConfig(nc)}
+	// Dead letters are kept in a stream of their own, so that the retention policy of the channel stream doesn't
+	// drop them and they don't count against its limits. Disabling the dead letter queue keeps the dead letter
+	// stream, until the channel is deleted, so that the events it holds can still be replayed.
+	if nc.Spec.DeadLetterQueue != nil && nc.Spec.DeadLetterQueue.Enabled {
+		wants = append(wants, resources.MakeDeadLetterStreamConfig(nc))
+	}
+	for _, want := range wants {
+		if err := r.reconcileStreamConfig(ctx, nc, js, want); err != nil {
+			return err
+		}
+	}
+	nc.Status.MarkStreamTrue()
+	return nil
+}
+
+// reconcileStreamConfig creates the stream of the channel with the desired configuration, or updates it if its
+// configuration drifted.
+func (r *Reconciler) reconcileStreamConfig(ctx context.Context, nc *v1alpha1.NatsJetStreamChannel, js streamManager, want *nats.StreamConfig) error {
+	logger := logging.FromContext(ctx)
+
+	info, err := js.StreamInfo(want.Name)
+	if natsutil.IsStreamNotFound(err) {
+		if _, err := js.AddStream(want); err != nil {
+			logger.Errorw("Failed to create the stream", zap.String("stream", want.Name), zap.Error(err))
+			nc.Status.MarkStreamFailed(streamFailed, "Failed to create stream: %s", err)
+			return fmt.Errorf("%w", reconciler.NewEvent(corev1.EventTypeWarning, streamFailed, "Failed to create stream %q: %v", want.Name, err))
+		}
+		logger.Infow("Stream created", zap.String("stream", want.Name))
+		controller.GetEventRecorder(ctx).Eventf(nc, corev1.EventTypeNormal, streamCreated, "Stream %q created", want.Name)
+		return nil
+	}
+	if err != nil {
+		logger.Errorw("Unable to get the stream", zap.String("stream", want.Name), zap.Error(err))
+		nc.Status.MarkStreamFailed(streamFailed, "Failed to get stream: %s", err)
+		return fmt.Errorf("%w", reconciler.NewEvent(corev1.EventTypeWarning, streamFailed, "Failed to get stream %q: %v", want.Name, err))
+	}
+
+	if drift := resources.StreamConfigDrift(&info.Config, want); len(drift) > 0 {
+		logger.Infow("Stream configuration drifted", zap.String("stream", want.Name), zap.Strings("fields", drift))
+		if _, err := js.UpdateStream(want); err != nil {
+			logger.Errorw("Failed to update the stream", zap.String("stream", want.Name), zap.Error(err))
+			nc.Status.MarkStreamFailed(streamConfigDrift, "Stream configuration differs from the spec in %s: %s", strings.Join(drift, ", "), err)
+			return fmt.Errorf("%w", reconciler.NewEvent(corev1.EventTypeWarning, streamConfigDrift, "Failed to update stream %q: %v", want.Name, err))
+		}
+		logger.Infow("Stream updated", zap.String("stream", want.Name))
+		controller.GetEventRecorder(ctx).Eventf(nc, corev1.EventTypeNormal, streamUpdated, "Stream %q updated, the configuration differed from the spec in %s", want.Name, strings.Join(drift, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,505 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nats-io/nats.go"
+
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/client/injection/ducks/duck/v1/addressable"
+	fakekubeclient "knative.dev/pkg/client/injection/kube/client/fake"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	. "knative.dev/pkg/reconciler/testing"
+	"knative.dev/pkg/resolver"
+	"knative.dev/pkg/tracker"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	clientgotesting "k8s.io/client-go/testing"
+
+	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
+	fakeclientset "knative.dev/eventing-natss/pkg/client/injection/client/fake"
+	"knative.dev/eventing-natss/pkg/client/injection/reconciler/messaging/v1alpha1/natsjetstreamchannel"
+	"knative.dev/eventing-natss/pkg/reconciler/controller/jetstream/resources"
+	reconciletesting "knative.dev/eventing-natss/pkg/reconciler/testing"
+)
+
+const (
+	testNS                   = "test-namespace"
+	ncName                   = "test-nc"
+	dispatcherDeploymentName = "test-deployment"
+	dispatcherServiceName    = "test-service"
+	channelServiceAddress    = "test-nc-kn-channel.test-namespace.svc.cluster.local"
+	streamName               = "KN_TEST-NAMESPACE_TEST-NC"
+	deadLetterStreamName     = "KNDLQ_TEST-NAMESPACE_TEST-NC"
+
+	// streamsKey is the key of the fake stream manager of a test in its OtherTestData.
+	streamsKey = "streams"
+)
+
+// errStreamNotFound is the error returned by the JetStream API for streams which don't exist.
+var errStreamNotFound = errors.New("nats: stream not found")
+
+func init() {
+	// Add types to scheme
+	_ = v1alpha1.AddToScheme(scheme.Scheme)
+	_ = duckv1.AddToScheme(scheme.Scheme)
+}
+
+func TestAllCases(t *testing.T) {
+	ncKey := testNS + "/" + ncName
+	deadLetterSinkURI := apis.HTTP("dead-letter.example.com")
+
+	table := TableTest{
+		{
+			Name: "bad workqueue key",
+			// Make sure Reconcile handles bad keys.
+			Key: "too/many/parts",
+		}, {
+			Name: "key not found",
+			// Make sure Reconcile handles good keys that don't exist.
+			Key: "foo/not-found",
+		}, {
+			Name: "creates the stream",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				makeReadyDeployment(),
+				makeService(),
+				makeReadyEndpoints(),
+				newChannel(),
+				makeChannelService(newChannel()),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: newFakeStreamManager()},
+			WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+				Object: newReadyChannel(reconciletesting.WithJetStreamChannelDeadLetterSinkNotConfigured()),
+			}},
+			WantEvents: []string{
+				Eventf(corev1.EventTypeNormal, streamCreated, "Stream %q created", streamName),
+			},
+			PostConditions: []func(*testing.T, *TableRow){
+				wantStream(resources.MakeStreamConfig(newChannel())),
+			},
+		}, {
+			Name: "stream exists",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				makeReadyDeployment(),
+				makeService(),
+				makeReadyEndpoints(),
+				newChannel(),
+				makeChannelService(newChannel()),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: newFakeStreamManager(resources.MakeStreamConfig(newChannel()))},
+			WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+				Object: newReadyChannel(reconciletesting.WithJetStreamChannelDeadLetterSinkNotConfigured()),
+			}},
+		}, {
+			Name: "creates the dead letter stream",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				makeReadyDeployment(),
+				makeService(),
+				makeReadyEndpoints(),
+				newChannel(reconciletesting.WithJetStreamChannelDeadLetterQueue()),
+				makeChannelService(newChannel()),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: newFakeStreamManager(resources.MakeStreamConfig(newChannel()))},
+			WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+				Object: newReadyChannel(
+					reconciletesting.WithJetStreamChannelDeadLetterQueue(),
+					reconciletesting.WithJetStreamChannelDeadLetterSinkNotConfigured(),
+				),
+			}},
+			WantEvents: []string{
+				Eventf(corev1.EventTypeNormal, streamCreated, "Stream %q created", deadLetterStreamName),
+			},
+			PostConditions: []func(*testing.T, *TableRow){
+				wantStream(resources.MakeStreamConfig(newChannel())),
+				wantStream(resources.MakeDeadLetterStreamConfig(newChannel())),
+			},
+		}, {
+			Name: "updates the stream which drifted",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				makeReadyDeployment(),
+				makeService(),
+				makeReadyEndpoints(),
+				newChannel(reconciletesting.WithJetStreamChannelStream(&v1alpha1.StreamSpec{MaxAge: &metav1.Duration{Duration: time.Hour}})),
+				makeChannelService(newChannel()),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: newFakeStreamManager(resources.MakeStreamConfig(newChannel()))},
+			WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+				Object: newReadyChannel(
+					reconciletesting.WithJetStreamChannelStream(&v1alpha1.StreamSpec{MaxAge: &metav1.Duration{Duration: time.Hour}}),
+					reconciletesting.WithJetStreamChannelDeadLetterSinkNotConfigured(),
+				),
+			}},
+			WantEvents: []string{
+				Eventf(corev1.EventTypeNormal, streamUpdated, "Stream %q updated, the configuration differed from the spec in maxAge", streamName),
+			},
+			PostConditions: []func(*testing.T, *TableRow){
+				wantStream(resources.MakeStreamConfig(newChannel(reconciletesting.WithJetStreamChannelStream(&v1alpha1.StreamSpec{MaxAge: &metav1.Duration{Duration: time.Hour}})))),
+			},
+		}, {
+			Name: "fails to create the stream",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				makeReadyDeployment(),
+				makeService(),
+				makeReadyEndpoints(),
+				newChannel(),
+				makeChannelService(newChannel()),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: &fakeStreamManager{
+				streams: map[string]*nats.StreamConfig{},
+				addErr:  errors.New("insufficient resources"),
+			}},
+			WantErr: true,
+			WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+				Object: newChannel(
+					reconciletesting.WithJetStreamInitChannelConditions,
+					reconciletesting.WithJetStreamChannelDeploymentReady(),
+					reconciletesting.WithJetStreamChannelServiceReady(),
+					reconciletesting.WithJetStreamChannelEndpointsReady(),
+					reconciletesting.WithJetStreamChannelChannelServiceReady(),
+					reconciletesting.WithJetStreamChannelAddress(channelServiceAddress),
+					reconciletesting.WithJetStreamChannelStreamFailed(streamFailed, "Failed to create stream: insufficient resources"),
+				),
+			}},
+			WantEvents: []string{
+				Eventf(corev1.EventTypeWarning, streamFailed, "Failed to create stream %q: insufficient resources", streamName),
+			},
+		}, {
+			Name: "fails to update the stream which drifted",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				makeReadyDeployment(),
+				makeService(),
+				makeReadyEndpoints(),
+				newChannel(reconciletesting.WithJetStreamChannelStream(&v1alpha1.StreamSpec{Storage: v1alpha1.MemoryStorageType})),
+				makeChannelService(newChannel()),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: &fakeStreamManager{
+				streams:   map[string]*nats.StreamConfig{streamName: resources.MakeStreamConfig(newChannel())},
+				updateErr: errors.New("can not change storage type"),
+			}},
+			WantErr: true,
+			WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+				Object: newChannel(
+					reconciletesting.WithJetStreamChannelStream(&v1alpha1.StreamSpec{Storage: v1alpha1.MemoryStorageType}),
+					reconciletesting.WithJetStreamInitChannelConditions,
+					reconciletesting.WithJetStreamChannelDeploymentReady(),
+					reconciletesting.WithJetStreamChannelServiceReady(),
+					reconciletesting.WithJetStreamChannelEndpointsReady(),
+					reconciletesting.WithJetStreamChannelChannelServiceReady(),
+					reconciletesting.WithJetStreamChannelAddress(channelServiceAddress),
+					reconciletesting.WithJetStreamChannelStreamFailed(streamConfigDrift, "Stream configuration differs from the spec in storage: can not change storage type"),
+				),
+			}},
+			WantEvents: []string{
+				Eventf(corev1.EventTypeWarning, streamConfigDrift, "Failed to update stream %q: can not change storage type", streamName),
+			},
+		}, {
+			Name: "resolves the dead letter sink",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				makeReadyDeployment(),
+				makeService(),
+				makeReadyEndpoints(),
+				newChannel(reconciletesting.WithJetStreamChannelDeadLetterSink(duckv1.Destination{URI: deadLetterSinkURI})),
+				makeChannelService(newChannel()),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: newFakeStreamManager(resources.MakeStreamConfig(newChannel()))},
+			WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+				Object: newReadyChannel(
+					reconciletesting.WithJetStreamChannelDeadLetterSink(duckv1.Destination{URI: deadLetterSinkURI}),
+					reconciletesting.WithJetStreamChannelDeadLetterSinkResolved(deadLetterSinkURI),
+				),
+			}},
+		}, {
+			Name: "fails to resolve the dead letter sink",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				makeReadyDeployment(),
+				makeService(),
+				makeReadyEndpoints(),
+				newChannel(reconciletesting.WithJetStreamChannelDeadLetterSink(duckv1.Destination{URI: &apis.URL{Path: "/dead-letter"}})),
+				makeChannelService(newChannel()),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: newFakeStreamManager(resources.MakeStreamConfig(newChannel()))},
+			WantErr:       true,
+			WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+				Object: newReadyChannel(
+					reconciletesting.WithJetStreamChannelDeadLetterSink(duckv1.Destination{URI: &apis.URL{Path: "/dead-letter"}}),
+					reconciletesting.WithJetStreamChannelDeadLetterSinkFailed(deadLetterSinkUnresolvable, `Failed to resolve the dead letter sink: URI is not absolute(both scheme and host should be non-empty): "/dead-letter"`),
+				),
+			}},
+			WantEvents: []string{
+				Eventf(corev1.EventTypeWarning, "InternalError", `failed to resolve the dead letter sink URI: URI is not absolute(both scheme and host should be non-empty): "/dead-letter"`),
+			},
+		}, {
+			Name: "deletes the stream",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				newChannel(reconciletesting.WithJetStreamChannelDeleted),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: newFakeStreamManager(resources.MakeStreamConfig(newChannel()))},
+			WantPatches: []clientgotesting.PatchActionImpl{
+				patchRemoveFinalizers(testNS, ncName),
+			},
+			WantEvents: []string{
+				Eventf(corev1.EventTypeNormal, streamDeleted, "Stream %q deleted", streamName),
+				Eventf(corev1.EventTypeNormal, "FinalizerUpdate", "Updated %q finalizers", ncName),
+			},
+			PostConditions: []func(*testing.T, *TableRow){
+				wantNoStream,
+			},
+		}, {
+			Name: "deletes the dead letter stream",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				newChannel(reconciletesting.WithJetStreamChannelDeleted),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: newFakeStreamManager(
+				resources.MakeStreamConfig(newChannel()),
+				resources.MakeDeadLetterStreamConfig(newChannel()),
+			)},
+			WantPatches: []clientgotesting.PatchActionImpl{
+				patchRemoveFinalizers(testNS, ncName),
+			},
+			WantEvents: []string{
+				Eventf(corev1.EventTypeNormal, streamDeleted, "Stream %q deleted", streamName),
+				Eventf(corev1.EventTypeNormal, streamDeleted, "Stream %q deleted", deadLetterStreamName),
+				Eventf(corev1.EventTypeNormal, "FinalizerUpdate", "Updated %q finalizers", ncName),
+			},
+			PostConditions: []func(*testing.T, *TableRow){
+				wantNoStream,
+			},
+		}, {
+			Name: "stream deleted already",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				newChannel(reconciletesting.WithJetStreamChannelDeleted),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: newFakeStreamManager()},
+			WantPatches: []clientgotesting.PatchActionImpl{
+				patchRemoveFinalizers(testNS, ncName),
+			},
+			WantEvents: []string{
+				Eventf(corev1.EventTypeNormal, "FinalizerUpdate", "Updated %q finalizers", ncName),
+			},
+		}, {
+			Name: "fails to delete the stream",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				newChannel(reconciletesting.WithJetStreamChannelDeleted),
+			},
+			OtherTestData: map[string]interface{}{streamsKey: &fakeStreamManager{
+				streams:   map[string]*nats.StreamConfig{streamName: resources.MakeStreamConfig(newChannel())},
+				deleteErr: errors.New("timeout"),
+			}},
+			WantErr: true,
+			WantEvents: []string{
+				Eventf(corev1.EventTypeWarning, streamDeleteFailed, "Failed to delete stream %q: timeout", streamName),
+			},
+		},
+	}
+
+	table.Test(t, func(t *testing.T, row *TableRow) (controller.Reconciler, ActionRecorderList, EventList) {
+		streams, _ := row.OtherTestData[streamsKey].(*fakeStreamManager)
+		return reconciletesting.MakeFactory(func(ctx context.Context, listers *reconciletesting.Listers) controller.Reconciler {
+			ctx = addressable.WithDuck(ctx)
+			r := &Reconciler{
+				dispatcherNamespace:      testNS,
+				dispatcherDeploymentName: dispatcherDeploymentName,
+				dispatcherServiceName:    dispatcherServiceName,
+				kubeClientSet:            fakekubeclient.Get(ctx),
+				deploymentLister:         listers.GetDeploymentLister(),
+				serviceLister:            listers.GetServiceLister(),
+				endpointsLister:          listers.GetEndpointsLister(),
+				streamManager: func(string) (streamManager, error) {
+					return streams, nil
+				},
+				uriResolver: resolver.NewURIResolverFromTracker(ctx, tracker.New(func(types.NamespacedName) {}, 0)),
+			}
+			return natsjetstreamchannel.NewReconciler(ctx, logging.FromContext(ctx),
+				fakeclientset.Get(ctx), listers.GetNatsJetStreamChannelLister(),
+				controller.GetEventRecorder(ctx),
+				r, controller.Options{FinalizerName: finalizerName})
+		})(t, row)
+	})
+}
+
+// fakeStreamManager keeps the configuration of the streams in memory.
+type fakeStreamManager struct {
+	streams map[string]*nats.StreamConfig
+
+	addErr    error
+	updateErr error
+	deleteErr error
+}
+
+var _ streamManager = (*fakeStreamManager)(nil)
+
+func newFakeStreamManager(streams ...*nats.StreamConfig) *fakeStreamManager {
+	m := &fakeStreamManager{streams: make(map[string]*nats.StreamConfig)}
+	for _, cfg := range streams {
+		m.streams[cfg.Name] = cfg
+	}
+	return m
+}
+
+func (m *fakeStreamManager) StreamInfo(stream string, _ ...nats.JSOpt) (*nats.StreamInfo, error) {
+	cfg, ok := m.streams[stream]
+	if !ok {
+		return nil, errStreamNotFound
+	}
+	return &nats.StreamInfo{Config: *cfg}, nil
+}
+
+func (m *fakeStreamManager) AddStream(cfg *nats.StreamConfig, _ ...nats.JSOpt) (*nats.StreamInfo, error) {
+	if m.addErr != nil {
+		return nil, m.addErr
+	}
+	m.streams[cfg.Name] = cfg
+	return &nats.StreamInfo{Config: *cfg}, nil
+}
+
+func (m *fakeStreamManager) UpdateStream(cfg *nats.StreamConfig, _ ...nats.JSOpt) (*nats.StreamInfo, error) {
+	if m.updateErr != nil {
+		return nil, m.updateErr
+	}
+	m.streams[cfg.Name] = cfg
+	return &nats.StreamInfo{Config: *cfg}, nil
+}
+
+func (m *fakeStreamManager) DeleteStream(name string, _ ...nats.JSOpt) error {
+	if m.deleteErr != nil {
+		return m.deleteErr
+	}
+	if _, ok := m.streams[name]; !ok {
+		return errStreamNotFound
+	}
+	delete(m.streams, name)
+	return nil
+}
+
+// wantStream checks that the stream of the channel has the given configuration once reconciled.
+func wantStream(want *nats.StreamConfig) func(*testing.T, *TableRow) {
+	return func(t *testing.T, row *TableRow) {
+		got := row.OtherTestData[streamsKey].(*fakeStreamManager).streams[want.Name]
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Error("unexpected stream configuration (-want, +got):", diff)
+		}
+	}
+}
+
+func wantNoStream(t *testing.T, row *TableRow) {
+	for _, name := range []string{streamName, deadLetterStreamName} {
+		if got, ok := row.OtherTestData[streamsKey].(*fakeStreamManager).streams[name]; ok {
+			t.Errorf("unexpected stream %v", got)
+		}
+	}
+}
+
+// newChannel returns the channel reconciled by the tests, with the finalizer of the controller.
+func newChannel(opts ...reconciletesting.NatsJetStreamChannelOption) *v1alpha1.NatsJetStreamChannel {
+	return reconciletesting.NewNatsJetStreamChannel(ncName, testNS, append([]reconciletesting.NatsJetStreamChannelOption{
+		reconciletesting.WithJetStreamChannelFinalizer(finalizerName),
+	}, opts...)...)
+}
+
+// newReadyChannel returns the channel once reconciled, with its dispatcher and stream ready.
+func newReadyChannel(opts ...reconciletesting.NatsJetStreamChannelOption) *v1alpha1.NatsJetStreamChannel {
+	return newChannel(append([]reconciletesting.NatsJetStreamChannelOption{
+		reconciletesting.WithJetStreamInitChannelConditions,
+		reconciletesting.WithJetStreamChannelDeploymentReady(),
+		reconciletesting.WithJetStreamChannelServiceReady(),
+		reconciletesting.WithJetStreamChannelEndpointsReady(),
+		reconciletesting.WithJetStreamChannelChannelServiceReady(),
+		reconciletesting.WithJetStreamChannelAddress(channelServiceAddress),
+		reconciletesting.WithJetStreamChannelStreamReady(),
+	}, opts...)...)
+}
+
+func patchRemoveFinalizers(namespace, name string) clientgotesting.PatchActionImpl {
+	action := clientgotesting.PatchActionImpl{}
+	action.Name = name
+	action.Namespace = namespace
+	action.Patch = []byte(`{"metadata":{"finalizers":[],"resourceVersion":""}}`)
+	return action
+}
+
+func makeReadyDeployment() *appsv1.Deployment {
+	return &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNS,
+			Name:      dispatcherDeploymentName,
+		},
+		Status: appsv1.DeploymentStatus{
+			Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+func makeService() *corev1.Service {
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNS,
+			Name:      dispatcherServiceName,
+		},
+	}
+}
+
+func makeChannelService(nc *v1alpha1.NatsJetStreamChannel) *corev1.Service {
+	svc, _ := resources.MakeK8sService(nc, resources.ExternalService(testNS, dispatcherServiceName))
+	return svc
+}
+
+func makeReadyEndpoints() *corev1.Endpoints {
+	return &corev1.Endpoints{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Endpoints",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNS,
+			Name:      dispatcherServiceName,
+		},
+		Subsets: []corev1.EndpointSubset{{Addresses: []corev1.EndpointAddress{{IP: "1.1.1.1"}}}},
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
+	"knative.dev/eventing-natss/pkg/natsutil"
+)
+
+// unlimited is the value JetStream uses for limits which aren't enforced.
+const unlimited = -1
+
+// MakeStreamConfig creates the configuration of the JetStream stream backing a NatsJetStreamChannel.
+func MakeStreamConfig(nc *v1alpha1.NatsJetStreamChannel) *nats.StreamConfig {
+	spec := streamSpec(nc)
+	cfg := &nats.StreamConfig{
+		Name:      natsutil.ChannelStreamName(nc.Namespace, nc.Name),
+		Subjects:  natsutil.ChannelStreamSubjects(nc.Namespace, nc.Name),
+		Retention: toRetentionPolicy(spec.Retention),
+		MaxMsgs:   unlimited,
+		MaxBytes:  unlimited,
+		Discard:   toDiscardPolicy(spec.Discard),
+		Storage:   toStorageType(spec.Storage),
+		Replicas:  spec.Replicas,
+	}
+	if spec.MaxMsgs != nil {
+		cfg.MaxMsgs = *spec.MaxMsgs
+	}
+	if spec.MaxBytes != nil {
+		cfg.MaxBytes = *spec.MaxBytes
+	}
+	if spec.MaxAge != nil {
+		cfg.MaxAge = spec.MaxAge.Duration
+	}
+	if spec.DuplicateWindow != nil {
+		cfg.Duplicates = spec.DuplicateWindow.Duration
+	}
+	return cfg
+}
+
+// MakeDeadLetterStreamConfig creates the configuration of the JetStream stream holding the events which couldn't
+// be delivered to the subscribers of a NatsJetStreamChannel. Dead letters are kept until they're deleted, so only
+// the storage, replicas and duplicate window of the channel stream apply.
+func MakeDeadLetterStreamConfig(nc *v1alpha1.NatsJetStreamChannel) *nats.StreamConfig {
+	spec := streamSpec(nc)
+	cfg := &nats.StreamConfig{
+		Name:      natsutil.ChannelDeadLetterStreamName(nc.Namespace, nc.Name),
+		Subjects:  natsutil.ChannelDeadLetterStreamSubjects(nc.Namespace, nc.Name),
+		Retention: nats.LimitsPolicy,
+		MaxMsgs:   unlimited,
+		MaxBytes:  unlimited,
+		Discard:   nats.DiscardOld,
+		Storage:   toStorageType(spec.Storage),
+		Replicas:  spec.Replicas,
+	}
+	if spec.DuplicateWindow != nil {
+		cfg.Duplicates = spec.DuplicateWindow.Duration
+	}
+	return cfg
+}
+
+// streamSpec returns the stream spec of the channel with its defaults. Channels created before the defaulting
+// webhook knew about streams don't have a stream section.
+func streamSpec(nc *v1alpha1.NatsJetStreamChannel) *v1alpha1.StreamSpec {
+	spec := nc.Spec.Stream.DeepCopy()
+	if spec == nil {
+		spec = &v1alpha1.StreamSpec{}
+	}
+	spec.SetDefaults(context.Background())
+	return spec
+}
+
+// StreamConfigDrift returns the names of the fields of the actual stream configuration which don't match the
+// desired one. Fields which are not managed by MakeStreamConfig are ignored.
+func StreamConfigDrift(actual, desired *nats.StreamConfig) []string {
+	var drift []string
+	if !equality.Semantic.DeepEqual(actual.Subjects, desired.Subjects) {
+		drift = append(drift, "subjects")
+	}
+	if actual.Retention != desired.Retention {
+		drift = append(drift, "retention")
+	}
+	if actual.MaxMsgs != desired.MaxMsgs {
+		drift = append(drift, "maxMsgs")
+	}
+	if actual.MaxBytes != desired.MaxBytes {
+		drift = append(drift, "maxBytes")
+	}
+	if actual.MaxAge != desired.MaxAge {
+		drift = append(drift, "maxAge")
+	}
+	if actual.Discard != desired.Discard {
+		drift = append(drift, "discard")
+	}
+	if actual.Storage != desired.Storage {
+		drift = append(drift, "storage")
+	}
+	if actual.Replicas != desired.Replicas {
+		drift = append(drift, "replicas")
+	}
+	if actual.Duplicates != desired.Duplicates {
+		drift = append(drift, "duplicateWindow")
+	}
+	return drift
+}
+
+func toRetentionPolicy(p v1alpha1.RetentionPolicy) nats.RetentionPolicy {
+	switch p {
+	case v1alpha1.InterestRetentionPolicy:
+		return nats.InterestPolicy
+	case v1alpha1.WorkQueueRetentionPolicy:
+		return nats.WorkQueuePolicy
+	default:
+		return nats.LimitsPolicy
+	}
+}
+
+func toDiscardPolicy(p v1alpha1.DiscardPolicy) nats.DiscardPolicy {
+	if p == v1alpha1.DiscardNewPolicy {
+		return nats.DiscardNew
+	}
+	return nats.DiscardOld
+}
+
+func toStorageType(t v1alpha1.StorageType) nats.StorageType {
+	if t == v1alpha1.MemoryStorageType {
+		return nats.MemoryStorage
+	}
+	return nats.FileStorage
+}
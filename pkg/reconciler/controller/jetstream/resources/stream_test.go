@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nats-io/nats.go"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
+)
+
+func TestMakeStreamConfig(t *testing.T) {
+	maxMsgs := int64(1000)
+	maxBytes := int64(1 << 20)
+
+	testCases := map[string]struct {
+		stream *v1alpha1.StreamSpec
+		want   *nats.StreamConfig
+	}{
+		"no stream spec": {
+			want: &nats.StreamConfig{
+				Name:       "KN_MY-TEST-NS_MY-TEST-NC",
+				Subjects:   []string{"KN_MY-TEST-NS_MY-TEST-NC.*"},
+				Retention:  nats.LimitsPolicy,
+				MaxMsgs:    -1,
+				MaxBytes:   -1,
+				Discard:    nats.DiscardOld,
+				Storage:    nats.FileStorage,
+				Replicas:   1,
+				Duplicates: 2 * time.Minute,
+			},
+		},
+		"full stream spec": {
+			stream: &v1alpha1.StreamSpec{
+				Retention:       v1alpha1.WorkQueueRetentionPolicy,
+				MaxAge:          &metav1.Duration{Duration: time.Hour},
+				MaxBytes:        &maxBytes,
+				MaxMsgs:         &maxMsgs,
+				Storage:         v1alpha1.MemoryStorageType,
+				Replicas:        3,
+				Discard:         v1alpha1.DiscardNewPolicy,
+				DuplicateWindow: &metav1.Duration{Duration: time.Minute},
+			},
+			want: &nats.StreamConfig{
+				Name:       "KN_MY-TEST-NS_MY-TEST-NC",
+				Subjects:   []string{"KN_MY-TEST-NS_MY-TEST-NC.*"},
+				Retention:  nats.WorkQueuePolicy,
+				MaxMsgs:    maxMsgs,
+				MaxBytes:   maxBytes,
+				MaxAge:     time.Hour,
+				Discard:    nats.DiscardNew,
+				Storage:    nats.MemoryStorage,
+				Replicas:   3,
+				Duplicates: time.Minute,
+			},
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			nc := &v1alpha1.NatsJetStreamChannel{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ncName,
+					Namespace: testNS,
+				},
+				Spec: v1alpha1.NatsJetStreamChannelSpec{
+					Stream: tc.stream,
+				},
+			}
+			if diff := cmp.Diff(tc.want, MakeStreamConfig(nc)); diff != "" {
+				t.Errorf("unexpected stream config (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestMakeDeadLetterStreamConfig(t *testing.T) {
+	maxMsgs := int64(1000)
+	nc := &v1alpha1.NatsJetStreamChannel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ncName,
+			Namespace: testNS,
+		},
+		Spec: v1alpha1.NatsJetStreamChannelSpec{
+			Stream: &v1alpha1.StreamSpec{
+				Retention: v1alpha1.InterestRetentionPolicy,
+				MaxAge:    &metav1.Duration{Duration: time.Hour},
+				MaxMsgs:   &maxMsgs,
+				Storage:   v1alpha1.MemoryStorageType,
+				Replicas:  3,
+				Discard:   v1alpha1.DiscardNewPolicy,
+			},
+		},
+	}
+	want := &nats.StreamConfig{
+		Name:       "KNDLQ_MY-TEST-NS_MY-TEST-NC",
+		Subjects:   []string{"KNDLQ_MY-TEST-NS_MY-TEST-NC.*"},
+		Retention:  nats.LimitsPolicy,
+		MaxMsgs:    -1,
+		MaxBytes:   -1,
+		Discard:    nats.DiscardOld,
+		Storage:    nats.MemoryStorage,
+		Replicas:   3,
+		Duplicates: 2 * time.Minute,
+	}
+	if diff := cmp.Diff(want, MakeDeadLetterStreamConfig(nc)); diff != "" {
+		t.Errorf("unexpected dead letter stream config (-want, +got) = %v", diff)
+	}
+}
+
+func TestStreamConfigDrift(t *testing.T) {
+	desired := &nats.StreamConfig{
+		Name:       "KN_MY-TEST-NS_MY-TEST-NC",
+		Subjects:   []string{"KN_MY-TEST-NS_MY-TEST-NC.*"},
+		MaxMsgs:    -1,
+		MaxBytes:   -1,
+		Replicas:   1,
+		Duplicates: 2 * time.Minute,
+	}
+
+	// fields not managed by the controller, like MaxConsumers, are not drift.
+	actual := *desired
+	actual.MaxConsumers = -1
+	if drift := StreamConfigDrift(&actual, desired); len(drift) != 0 {
+		t.Errorf("unexpected drift: %v", drift)
+	}
+
+	actual.Storage = nats.MemoryStorage
+	actual.MaxAge = time.Hour
+	if diff := cmp.Diff([]string{"maxAge", "storage"}, StreamConfigDrift(&actual, desired)); diff != "" {
+		t.Errorf("unexpected drift (-want, +got) = %v", diff)
+	}
+}
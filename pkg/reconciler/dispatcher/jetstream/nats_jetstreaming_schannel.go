@@ -20,8 +20,10 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
@@ -35,6 +37,8 @@ import (
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
 	messagingv1 "knative.dev/eventing/pkg/apis/messaging/v1"
 	"knative.dev/eventing/pkg/channel"
+	"knative.dev/eventing/pkg/client/injection/informers/messaging/v1/subscription"
+	messaginglisters "knative.dev/eventing/pkg/client/listers/messaging/v1"
 	"knative.dev/pkg/apis/duck"
 	duckv1 "knative.dev/pkg/apis/duck/v1"
 	"knative.dev/pkg/configmap"
@@ -42,14 +46,19 @@ import (
 	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/logging"
 	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/tracing"
+	tracingconfig "knative.dev/pkg/tracing/config"
 
 	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
+
 	clientset "knative.dev/eventing-natss/pkg/client/clientset/versioned"
 	"knative.dev/eventing-natss/pkg/client/injection/client"
 	"knative.dev/eventing-natss/pkg/client/injection/informers/messaging/v1alpha1/natsjetstreamchannel"
 	jetstreamchannelreconciler "knative.dev/eventing-natss/pkg/client/injection/reconciler/messaging/v1alpha1/natsjetstreamchannel"
 	listers "knative.dev/eventing-natss/pkg/client/listers/messaging/v1alpha1"
+	"knative.dev/eventing-natss/pkg/config"
 	"knative.dev/eventing-natss/pkg/dispatcher"
+	"knative.dev/eventing-natss/pkg/natsutil"
 	"knative.dev/eventing-natss/pkg/util"
 )
 
@@ -61,14 +70,32 @@ const (
 //finalizerName = controllerAgentName
 )
 
+const (
+	// Reasons of the corev1.Events emitted by the dispatcher, which are meant to be alerted on.
+	subscriptionCreated = "SubscriptionCreated"
+	subscriptionRemoved = "SubscriptionRemoved"
+	subscriptionFailed  = "SubscriptionFailed"
+	connectionLost      = "ConnectionLost"
+	connectionRestored  = "ConnectionRestored"
+	connectionFailed    = "ConnectionFailed"
+	streamNotFound      = "StreamNotFound"
+)
+
 // Reconciler reconciles NATS JetStream Channels.
 type Reconciler struct {
-	jetStreamDispatcher dispatcher.NatsDispatcher
+	jetStreamDispatcher dispatcher.JetStreamDispatcher
 
 	jetStreamClientSet clientset.Interface
+	// subscriptionLister lists the Subscriptions to the channels, which hold the rate limits of their subscribers.
+	subscriptionLister messaginglisters.SubscriptionLister
 
 	jetStreamchannelLister listers.NatsJetStreamChannelLister
 	impl                   *controller.Impl
+
+	// connectedMux protects connected, which tells whether the dispatcher was connected to the NATS JetStream
+	// servers of each channel when the channel was last reconciled. Channels are tracked once connected.
+	connectedMux sync.Mutex
+	connected    map[types.NamespacedName]bool
 }
 
 // Check that our Reconciler implements controller.Reconciler.
@@ -82,7 +109,7 @@ type envConfig struct {
 
 // NewController initializes the controller and is called by the generated code.
 // Registers event handlers to enqueue events.
-func NewController(ctx context.Context, _ configmap.Watcher) *controller.Impl {
+func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
 
 	logger := logging.FromContext(ctx)
 
@@ -91,16 +118,51 @@ func NewController(ctx context.Context, _ configmap.Watcher) *controller.Impl {
 		logger.Fatalw("Failed to process env var", zap.Error(err))
 	}
 
+	channelInformer := natsjetstreamchannel.Get(ctx)
+	subscriptionInformer := subscription.Get(ctx)
+	r := &Reconciler{
+		jetStreamchannelLister: channelInformer.Lister(),
+		jetStreamClientSet:     client.Get(ctx),
+		subscriptionLister:     subscriptionInformer.Lister(),
+	}
+
+	enqueueChannel := func(ref channel.ChannelReference) {
+		r.impl.EnqueueKey(types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name})
+	}
+	// The states of the consumers only change the consumer statuses of the channel, which are patched without
+	// reconciling the channel.
+	patchConsumers := func(ref channel.ChannelReference) {
+		if err := r.patchConsumerStatuses(ctx, ref); err != nil {
+			logger.Errorw("Error patching the consumer statuses", zap.String("channel", ref.String()), zap.Error(err))
+		}
+	}
+
 	//natssConfig := util.GetNatssConfig()
 	reporter := channel.NewStatsReporter(env.ContainerName, kmeta.ChildName(env.PodName, uuid.New().String()))
 	dispatcherArgs := dispatcher.JetArgs{
-		JetStreamURL: util.GetDefaultJetStreamURL(),
+		JetStreamURL:   util.GetDefaultJetStreamURL(),
+		Connection:     util.GetConnectionConfig(),
+		AckWaitMinutes: util.GetAckWaitMinutes(),
+		MaxInflight:    util.GetMaxInflight(),
 		//Cargs: kncloudevents.ConnectionArgs{
 		//	MaxIdleConns:        natssConfig.MaxIdleConns,
 		//	MaxIdleConnsPerHost: natssConfig.MaxIdleConnsPerHost,
 		//},
 		Logger:   logger.Desugar(),
 		Reporter: reporter,
+		// The subscriber statuses of the channel tell whether the circuits of the subscribers are open, and its
+		// consumer statuses how far behind the stream their consumers are.
+		CircuitStateChanged:  enqueueChannel,
+		ConsumerStateChanged: patchConsumers,
+		// The events refused because the stream of the channel doesn't exist are reported in its status.
+		StreamNotFound: enqueueChannel,
+		// The loss of the connection is reported on the channels of the connection profile.
+		ConnectionStateChanged: func(profile string) {
+			r.impl.FilteredGlobalResync(func(obj interface{}) bool {
+				nc, ok := obj.(*v1alpha1.NatsJetStreamChannel)
+				return ok && nc.ConnectionProfileName() == profile
+			}, channelInformer.Informer())
+		},
 	}
 	jetstreamDispatcher, err := dispatcher.NewJetStreamDispatcher(dispatcherArgs)
 	if err != nil {
@@ -110,18 +172,23 @@ func NewController(ctx context.Context, _ configmap.Watcher) *controller.Impl {
 	logger = logger.With(zap.String("controller/impl", "pkg"))
 	logger.Info("Starting the NATS JetStream dispatcher")
 
-	channelInformer := natsjetstreamchannel.Get(ctx)
-
-	r := &Reconciler{
-		jetStreamDispatcher:    jetstreamDispatcher,
-		jetStreamchannelLister: channelInformer.Lister(),
-		jetStreamClientSet:     client.Get(ctx),
-	}
+	r.jetStreamDispatcher = jetstreamDispatcher
 	r.impl = jetstreamchannelreconciler.NewImpl(ctx, r)
 
 	logger.Info("Setting up event handlers")
 
 	channelInformer.Informer().AddEventHandler(controller.HandleAll(r.impl.Enqueue))
+	subscriptionInformer.Informer().AddEventHandler(dispatcher.SubscriptionHandler("NatsJetStreamChannel", r.impl.EnqueueKey))
+
+	// The spans of the events going through NATS are published to the backend set in the tracing configuration.
+	if err := tracing.SetupDynamicPublishing(logger, cmw, "jetstream-ch-dispatcher", tracingconfig.ConfigName); err != nil {
+		logger.Errorw("Failed to set up the tracing of the dispatcher", zap.Error(err))
+	}
+
+	logger.Info("Watching the NATS configuration")
+	config.Watch(cmw, logger, func(natsConfig *config.NatsConfig) {
+		jetstreamDispatcher.UpdateConfig(ctx, natsConfig)
+	})
 
 	logger.Info("Starting dispatcher.")
 	go func() {
@@ -129,6 +196,11 @@ func NewController(ctx context.Context, _ configmap.Watcher) *controller.Impl {
 			logger.Errorw("Cannot start dispatcher", zap.Error(err))
 		}
 	}()
+	go func() {
+		if err := dispatcher.StartReadinessServer(ctx, dispatcher.ReadinessPort, jetstreamDispatcher, logger.Desugar()); err != nil {
+			logger.Errorw("Cannot serve the readiness endpoint", zap.Error(err))
+		}
+	}()
 	return r.impl
 }
 
@@ -137,19 +209,39 @@ func NewController(ctx context.Context, _ configmap.Watcher) *controller.Impl {
 // - set NatsJetStreamChannel SubscribableStatus
 // - update host2channel map
 func (r *Reconciler) ReconcileKind(ctx context.Context, natsJetStreamChannel *v1alpha1.NatsJetStreamChannel) pkgreconciler.Event {
+	state := r.jetStreamDispatcher.ConnectionStates()[natsJetStreamChannel.ConnectionProfileName()]
+	r.reportConnection(ctx, natsJetStreamChannel, state == dispatcher.ConnectionStateConnected)
+
+	r.jetStreamDispatcher.UpdateChannelConfig(natsJetStreamChannel.Name, natsJetStreamChannel.Namespace, toChannelConfig(natsJetStreamChannel))
+	streamMissing := r.checkStream(ctx, natsJetStreamChannel, state)
+	rateLimits, err := dispatcher.SubscriberRateLimits(r.subscriptionLister, natsJetStreamChannel.Namespace, natsJetStreamChannel.Spec.Subscribers, logging.FromContext(ctx).Desugar())
+	if err != nil {
+		logging.FromContext(ctx).Errorw("Error updating the rate limits of the subscribers", zap.Any("channel", natsJetStreamChannel), zap.Error(err))
+		return err
+	}
+	r.jetStreamDispatcher.UpdateRateLimits(natsJetStreamChannel.Name, natsJetStreamChannel.Namespace, rateLimits)
+	subscriberConfigs, err := dispatcher.SubscriberConfigs(r.subscriptionLister, natsJetStreamChannel.Namespace, natsJetStreamChannel.Spec.Subscribers, logging.FromContext(ctx).Desugar())
+	if err != nil {
+		logging.FromContext(ctx).Errorw("Error updating the configurations of the subscribers", zap.Any("channel", natsJetStreamChannel), zap.Error(err))
+		return err
+	}
+	r.jetStreamDispatcher.UpdateSubscriberConfigs(natsJetStreamChannel.Name, natsJetStreamChannel.Namespace, subscriberConfigs)
+
 	// Try to subscribe.
-	logging.FromContext(ctx).Infof("ReconcileKind() jetstream:%s/%s 's subscriber %#v", natsJetStreamChannel.Namespace, natsJetStreamChannel.Name, natsJetStreamChannel.Spec.Subscribers)
-	failedSubscriptions, err := r.jetStreamDispatcher.UpdateSubscriptions(ctx, natsJetStreamChannel.Name, natsJetStreamChannel.Namespace, natsJetStreamChannel.Spec.Subscribers, false)
+	logging.FromContext(ctx).Debugw("Updating the subscriptions", zap.Any("subscribers", natsJetStreamChannel.Spec.Subscribers))
+	failedSubscriptions, err := r.jetStreamDispatcher.UpdateSubscriptions(ctx, natsJetStreamChannel.Name, natsJetStreamChannel.Namespace, subscribersWithChannelDelivery(natsJetStreamChannel), false)
 	if err != nil {
 		logging.FromContext(ctx).Errorw("Error updating subscriptions", zap.Any("channel", natsJetStreamChannel), zap.Error(err))
-		return err
+		return fmt.Errorf("%w", pkgreconciler.NewEvent(corev1.EventTypeWarning, subscriptionFailed, "Failed to update the subscriptions: %v", err))
 	}
-	logging.FromContext(ctx).Infof("ReconcileKind() jetstream:%s/%s failedSubscriptions %#v", natsJetStreamChannel.Namespace, natsJetStreamChannel.Name, failedSubscriptions)
 
-	if err := r.patchSubscriberStatus(ctx, natsJetStreamChannel, failedSubscriptions); err != nil {
+	openCircuits := r.jetStreamDispatcher.OpenCircuits(natsJetStreamChannel.Name, natsJetStreamChannel.Namespace)
+	consumers := r.jetStreamDispatcher.ConsumerStates(natsJetStreamChannel.Name, natsJetStreamChannel.Namespace)
+	if err := r.patchSubscriberStatus(ctx, natsJetStreamChannel, failedSubscriptions, openCircuits, consumers, streamMissing); err != nil {
 		logging.FromContext(ctx).Errorw("Error patching subscription statuses", zap.Any("channel", natsJetStreamChannel), zap.Error(err))
 		return err
 	}
+	recordSubscriptionEvents(ctx, natsJetStreamChannel, natsJetStreamChannel.Status.Subscribers, failedSubscriptions)
 
 	natsJetStreamChannels, err := r.jetStreamchannelLister.List(labels.Everything())
 	if err != nil {
@@ -176,12 +268,16 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, natsJetStreamChannel *v1
 		}
 		errMsg := b.String()
 		logging.FromContext(ctx).Error(errMsg)
-		return fmt.Errorf(errMsg)
+		return fmt.Errorf("%w", pkgreconciler.NewEvent(corev1.EventTypeWarning, subscriptionFailed, "%s", errMsg))
 	}
 	return nil
 }
 
 func (r *Reconciler) FinalizeKind(ctx context.Context, c *v1alpha1.NatsJetStreamChannel) pkgreconciler.Event {
+	r.connectedMux.Lock()
+	delete(r.connected, types.NamespacedName{Namespace: c.Namespace, Name: c.Name})
+	r.connectedMux.Unlock()
+
 	if _, err := r.jetStreamDispatcher.UpdateSubscriptions(ctx, c.Name, c.Namespace, c.Spec.Subscribers, true); err != nil {
 		logging.FromContext(ctx).Errorw("Error updating subscriptions", zap.Any("channel", c), zap.Error(err))
 		return err
@@ -189,10 +285,116 @@ func (r *Reconciler) FinalizeKind(ctx context.Context, c *v1alpha1.NatsJetStream
 	return nil
 }
 
-// createSubscribableStatus creates the SubscribableStatus based on the failedSubscriptions
+// reportConnection records an Event on the channel when the connection of the dispatcher to the NATS JetStream
+// servers of the channel was lost or restored since the channel was last reconciled.
+func (r *Reconciler) reportConnection(ctx context.Context, nc *v1alpha1.NatsJetStreamChannel, connected bool) {
+	key := types.NamespacedName{Namespace: nc.Namespace, Name: nc.Name}
+	r.connectedMux.Lock()
+	if r.connected == nil {
+		r.connected = make(map[types.NamespacedName]bool)
+	}
+	wasConnected, tracked := r.connected[key]
+	if connected || tracked {
+		r.connected[key] = connected
+	}
+	r.connectedMux.Unlock()
+
+	switch {
+	case tracked && wasConnected && !connected:
+		controller.GetEventRecorder(ctx).Eventf(nc, corev1.EventTypeWarning, connectionLost,
+			"The dispatcher lost its connection to the NATS JetStream servers of connection profile %q", nc.ConnectionProfileName())
+	case tracked && !wasConnected && connected:
+		controller.GetEventRecorder(ctx).Eventf(nc, corev1.EventTypeNormal, connectionRestored,
+			"The dispatcher reconnected to the NATS JetStream servers of connection profile %q", nc.ConnectionProfileName())
+	}
+}
+
+// checkStream returns true if the stream of the channel doesn't exist, so that it's reported in the status of the
+// channel until the controller creates it again. The connection profiles of the channel which can't be connected
+// to are reported with an Event, unless they were connected to before, which is reported by reportConnection.
+func (r *Reconciler) checkStream(ctx context.Context, nc *v1alpha1.NatsJetStreamChannel, state dispatcher.ConnectionState) bool {
+	exists, err := r.jetStreamDispatcher.StreamExists(nc.Name, nc.Namespace)
+	if err != nil {
+		logging.FromContext(ctx).Debugw("Unable to check the stream of the channel", zap.Error(err))
+		if state == "" {
+			controller.GetEventRecorder(ctx).Eventf(nc, corev1.EventTypeWarning, connectionFailed,
+				"The dispatcher can't connect to the NATS JetStream servers of connection profile %q: %v", nc.ConnectionProfileName(), err)
+		}
+		return false
+	}
+	if !exists {
+		if cond := nc.Status.GetCondition(v1alpha1.NatssChannelConditionStreamReady); cond == nil || cond.Reason != streamNotFound {
+			controller.GetEventRecorder(ctx).Eventf(nc, corev1.EventTypeWarning, streamNotFound,
+				"Stream %q not found, the events sent to the channel are refused", natsutil.ChannelStreamName(nc.Namespace, nc.Name))
+		}
+	}
+	return !exists
+}
+
+// recordSubscriptionEvents records an Event on the channel for every subscription established or removed, based on
+// the subscriber statuses set by the previous reconciliation.
+func recordSubscriptionEvents(ctx context.Context, nc *v1alpha1.NatsJetStreamChannel, previous []eventingduckv1.SubscriberStatus, failedSubscriptions map[eventingduckv1.SubscriberSpec]error) {
+	recorder := controller.GetEventRecorder(ctx)
+	wasReady := make(map[types.UID]bool, len(previous))
+	for _, status := range previous {
+		wasReady[status.UID] = status.Ready == corev1.ConditionTrue
+	}
+
+	subscribed := make(map[types.UID]bool, len(nc.Spec.Subscribers))
+	for _, sub := range nc.Spec.Subscribers {
+		subscribed[sub.UID] = true
+		if !wasReady[sub.UID] && getFailedSub(sub, failedSubscriptions) == nil {
+			recorder.Eventf(nc, corev1.EventTypeNormal, subscriptionCreated, "Subscription %s created", sub.UID)
+		}
+	}
+	for _, status := range previous {
+		if !subscribed[status.UID] {
+			recorder.Eventf(nc, corev1.EventTypeNormal, subscriptionRemoved, "Subscription %s removed", status.UID)
+		}
+	}
+}
+
+// toChannelConfig returns the configuration of the channel the dispatcher needs.
+func toChannelConfig(nc *v1alpha1.NatsJetStreamChannel) dispatcher.ChannelConfig {
+	config := dispatcher.ChannelConfig{
+		DeadLetterQueue:   nc.Spec.DeadLetterQueue != nil && nc.Spec.DeadLetterQueue.Enabled,
+		ConnectionProfile: nc.ConnectionProfileName(),
+		DeliveryOrdering:  nc.Ordering(),
+	}
+	if nc.Spec.Deduplication != nil {
+		config.MessageID = nc.Spec.Deduplication.MessageID
+	}
+	return config
+}
+
+// subscribersWithChannelDelivery returns the subscribers of the channel, where the ones without their own
+// delivery spec get the delivery spec of the channel. The dead letter sink of the channel is taken from the
+// status, as it was resolved by the controller; it's left out until it has been resolved.
+func subscribersWithChannelDelivery(nc *v1alpha1.NatsJetStreamChannel) []eventingduckv1.SubscriberSpec {
+	if nc.Spec.Delivery == nil {
+		return nc.Spec.Subscribers
+	}
+
+	delivery := nc.Spec.Delivery.DeepCopy()
+	delivery.DeadLetterSink = nil
+	if nc.Status.DeadLetterSinkURI != nil {
+		delivery.DeadLetterSink = &duckv1.Destination{URI: nc.Status.DeadLetterSinkURI.DeepCopy()}
+	}
+
+	subscribers := make([]eventingduckv1.SubscriberSpec, 0, len(nc.Spec.Subscribers))
+	for _, sub := range nc.Spec.Subscribers {
+		if sub.Delivery == nil {
+			sub.Delivery = delivery
+		}
+		subscribers = append(subscribers, sub)
+	}
+	return subscribers
+}
+
+// createSubscribableStatus creates the SubscribableStatus based on the failedSubscriptions and the open circuits
 // checks for each subscriber on the nats jetstream channel if there is a failed subscription on nats jetstream side
 // if there is no failed subscription => set ready status
-func (r *Reconciler) createSubscribableStatus(subscribers []eventingduckv1.SubscriberSpec, failedSubscriptions map[eventingduckv1.SubscriberSpec]error) eventingduckv1.SubscribableStatus {
+func (r *Reconciler) createSubscribableStatus(subscribers []eventingduckv1.SubscriberSpec, failedSubscriptions map[eventingduckv1.SubscriberSpec]error, openCircuits map[types.UID]string) eventingduckv1.SubscribableStatus {
 	subscriberStatus := make([]eventingduckv1.SubscriberStatus, 0)
 	for _, sub := range subscribers {
 		status := eventingduckv1.SubscriberStatus{
@@ -204,6 +406,9 @@ func (r *Reconciler) createSubscribableStatus(subscribers []eventingduckv1.Subsc
 		if err := getFailedSub(sub, failedSubscriptions); err != nil {
 			status.Ready = corev1.ConditionFalse
 			status.Message = err.Error()
+		} else if msg, ok := openCircuits[sub.UID]; ok {
+			// The subscription is in place, the events are held until the subscriber recovers.
+			status.Message = msg
 		}
 		subscriberStatus = append(subscriberStatus, status)
 	}
@@ -212,6 +417,26 @@ func (r *Reconciler) createSubscribableStatus(subscribers []eventingduckv1.Subsc
 	}
 }
 
+// createConsumerStatuses returns the states of the consumers of the subscribers, in the order of the subscribers.
+// Subscribers whose consumer wasn't read yet are left out.
+func createConsumerStatuses(subscribers []eventingduckv1.SubscriberSpec, consumers map[types.UID]dispatcher.ConsumerState) []v1alpha1.ConsumerStatus {
+	var statuses []v1alpha1.ConsumerStatus
+	for _, sub := range subscribers {
+		state, ok := consumers[sub.UID]
+		if !ok {
+			continue
+		}
+		statuses = append(statuses, v1alpha1.ConsumerStatus{
+			UID:                   sub.UID,
+			Pending:               state.Pending,
+			AckPending:            state.AckPending,
+			Redelivered:           state.Redelivered,
+			LastDeliveredSequence: state.LastDeliveredSequence,
+		})
+	}
+	return statuses
+}
+
 // TODO: We should really look at not using the sub as the key since it has
 // pointers in it. This is inefficient, but at least it's correct.
 func getFailedSub(sub eventingduckv1.SubscriberSpec, failedSubscriptions map[eventingduckv1.SubscriberSpec]error) error {
@@ -223,13 +448,34 @@ func getFailedSub(sub eventingduckv1.SubscriberSpec, failedSubscriptions map[eve
 	return nil
 }
 
-func (r *Reconciler) patchSubscriberStatus(ctx context.Context, nc *v1alpha1.NatsJetStreamChannel, failedSubscriptions map[eventingduckv1.SubscriberSpec]error) error {
+func (r *Reconciler) patchSubscriberStatus(ctx context.Context, nc *v1alpha1.NatsJetStreamChannel, failedSubscriptions map[eventingduckv1.SubscriberSpec]error, openCircuits map[types.UID]string, consumers map[types.UID]dispatcher.ConsumerState, streamMissing bool) error {
 	after := nc.DeepCopy()
-	logging.FromContext(ctx).Infof("Subscribers %#v  failedSubscriptions %#v", after.Spec.Subscribers, failedSubscriptions)
-	after.Status.SubscribableStatus = r.createSubscribableStatus(after.Spec.Subscribers, failedSubscriptions)
-	jsonPatch, err := duck.CreatePatch(nc, after)
+	if streamMissing {
+		// Patching the status makes the controller reconcile the channel, which creates the stream again.
+		after.Status.MarkStreamFailed(streamNotFound, "Stream %q not found", natsutil.ChannelStreamName(nc.Namespace, nc.Name))
+	}
+	after.Status.SubscribableStatus = r.createSubscribableStatus(after.Spec.Subscribers, failedSubscriptions, openCircuits)
+	after.Status.Consumers = createConsumerStatuses(after.Spec.Subscribers, consumers)
+	return r.patchStatus(ctx, nc, after)
+}
+
+// patchConsumerStatuses patches the consumer statuses of the channel with the current states of the consumers of
+// its subscribers.
+func (r *Reconciler) patchConsumerStatuses(ctx context.Context, ref channel.ChannelReference) error {
+	nc, err := r.jetStreamchannelLister.NatsJetStreamChannels(ref.Namespace).Get(ref.Name)
+	if apierrs.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	after := nc.DeepCopy()
+	after.Status.Consumers = createConsumerStatuses(after.Spec.Subscribers, r.jetStreamDispatcher.ConsumerStates(nc.Name, nc.Namespace))
+	return r.patchStatus(ctx, nc, after)
+}
 
-	logging.FromContext(ctx).Infof("patchSubscriberStatus %s/%s  Patched resource %#v", nc.Namespace, nc.Name, jsonPatch)
+// patchStatus patches the status of the channel from nc to after.
+func (r *Reconciler) patchStatus(ctx context.Context, nc, after *v1alpha1.NatsJetStreamChannel) error {
+	jsonPatch, err := duck.CreatePatch(nc, after)
 	if err != nil {
 		return fmt.Errorf("creating JSON patch: %w", err)
 	}
@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+
+	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
+	"knative.dev/eventing-natss/pkg/dispatcher"
+)
+
+func TestSubscribersWithChannelDelivery(t *testing.T) {
+	deadLetterSinkURI := apis.HTTP("dead-letter.default.svc.cluster.local")
+	subscriberDelivery := &eventingduckv1.DeliverySpec{Retry: pointer.Int32Ptr(1)}
+	channelDelivery := &eventingduckv1.DeliverySpec{
+		DeadLetterSink: &duckv1.Destination{Ref: &duckv1.KReference{Kind: "Service", Name: "dead-letter"}},
+		Retry:          pointer.Int32Ptr(3),
+	}
+
+	testCases := map[string]struct {
+		delivery          *eventingduckv1.DeliverySpec
+		deadLetterSinkURI *apis.URL
+		want              []*eventingduckv1.DeliverySpec
+	}{
+		"no channel delivery": {
+			want: []*eventingduckv1.DeliverySpec{nil, subscriberDelivery},
+		},
+		"dead letter sink not resolved yet": {
+			delivery: channelDelivery,
+			want:     []*eventingduckv1.DeliverySpec{{Retry: pointer.Int32Ptr(3)}, subscriberDelivery},
+		},
+		"dead letter sink resolved": {
+			delivery:          channelDelivery,
+			deadLetterSinkURI: deadLetterSinkURI,
+			want: []*eventingduckv1.DeliverySpec{{
+				DeadLetterSink: &duckv1.Destination{URI: deadLetterSinkURI},
+				Retry:          pointer.Int32Ptr(3),
+			}, subscriberDelivery},
+		},
+	}
+
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			nc := &v1alpha1.NatsJetStreamChannel{
+				Spec: v1alpha1.NatsJetStreamChannelSpec{
+					ChannelableSpec: eventingduckv1.ChannelableSpec{
+						SubscribableSpec: eventingduckv1.SubscribableSpec{
+							Subscribers: []eventingduckv1.SubscriberSpec{
+								{UID: "without-delivery"},
+								{UID: "with-delivery", Delivery: subscriberDelivery},
+							},
+						},
+						Delivery: tc.delivery,
+					},
+				},
+				Status: v1alpha1.NatsJetStreamChannelStatus{DeadLetterSinkURI: tc.deadLetterSinkURI},
+			}
+
+			subscribers := subscribersWithChannelDelivery(nc)
+			got := make([]*eventingduckv1.DeliverySpec, 0, len(subscribers))
+			for _, sub := range subscribers {
+				got = append(got, sub.Delivery)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected delivery specs (-want, +got) = %v", diff)
+			}
+			if nc.Spec.Subscribers[0].Delivery != nil {
+				t.Error("subscribersWithChannelDelivery() modified the channel spec")
+			}
+		})
+	}
+}
+
+func TestCreateConsumerStatuses(t *testing.T) {
+	subscribers := []eventingduckv1.SubscriberSpec{{UID: "first"}, {UID: "not-read-yet"}, {UID: "second"}}
+	consumers := map[types.UID]dispatcher.ConsumerState{
+		"second":       {Pending: 10, AckPending: 2, Redelivered: 1, LastDeliveredSequence: 42},
+		"first":        {LastDeliveredSequence: 52},
+		"unsubscribed": {Pending: 3},
+	}
+
+	want := []v1alpha1.ConsumerStatus{
+		{UID: "first", LastDeliveredSequence: 52},
+		{UID: "second", Pending: 10, AckPending: 2, Redelivered: 1, LastDeliveredSequence: 42},
+	}
+	if diff := cmp.Diff(want, createConsumerStatuses(subscribers, consumers)); diff != "" {
+		t.Error("unexpected consumer statuses (-want, +got):", diff)
+	}
+	if got := createConsumerStatuses(subscribers, nil); got != nil {
+		t.Errorf("expected no consumer statuses, got %v", got)
+	}
+}
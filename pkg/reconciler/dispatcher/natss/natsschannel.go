@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/kelseyhightower/envconfig"
@@ -38,6 +39,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	"knative.dev/eventing/pkg/client/injection/informers/messaging/v1/subscription"
+	messaginglisters "knative.dev/eventing/pkg/client/listers/messaging/v1"
 	"knative.dev/eventing/pkg/kncloudevents"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
@@ -49,6 +52,7 @@ import (
 	"knative.dev/eventing-natss/pkg/client/injection/informers/messaging/v1beta1/natsschannel"
 	natsschannelreconciler "knative.dev/eventing-natss/pkg/client/injection/reconciler/messaging/v1beta1/natsschannel"
 	listers "knative.dev/eventing-natss/pkg/client/listers/messaging/v1beta1"
+	"knative.dev/eventing-natss/pkg/config"
 	"knative.dev/eventing-natss/pkg/dispatcher"
 	"knative.dev/eventing-natss/pkg/util"
 )
@@ -59,6 +63,13 @@ const (
 	controllerAgentName = "natss-ch-dispatcher"
 
 	finalizerName = controllerAgentName
+
+	// Reasons of the corev1.Events emitted by the dispatcher, which are meant to be alerted on.
+	subscriptionCreated = "SubscriptionCreated"
+	subscriptionRemoved = "SubscriptionRemoved"
+	subscriptionFailed  = "SubscriptionFailed"
+	connectionLost      = "ConnectionLost"
+	connectionRestored  = "ConnectionRestored"
 )
 
 // Reconciler reconciles NATSS Channels.
@@ -66,9 +77,16 @@ type Reconciler struct {
 	natssDispatcher dispatcher.NatsDispatcher
 
 	natssClientSet clientset.Interface
+	// subscriptionLister lists the Subscriptions to the channels, which hold the rate limits of their subscribers.
+	subscriptionLister messaginglisters.SubscriptionLister
 
 	natsschannelLister listers.NatssChannelLister
 	impl               *controller.Impl
+
+	// connectedMux protects connected, which tells whether the dispatcher was connected to NATSS when each channel
+	// was last reconciled. Channels are tracked once connected.
+	connectedMux sync.Mutex
+	connected    map[types.NamespacedName]bool
 }
 
 // Check that our Reconciler implements controller.Reconciler.
@@ -82,7 +100,7 @@ type envConfig struct {
 
 // NewController initializes the controller and is called by the generated code.
 // Registers event handlers to enqueue events.
-func NewController(ctx context.Context, _ configmap.Watcher) *controller.Impl {
+func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
 
 	logger := logging.FromContext(ctx)
 
@@ -91,10 +109,19 @@ func NewController(ctx context.Context, _ configmap.Watcher) *controller.Impl {
 		logger.Fatalw("Failed to process env var", zap.Error(err))
 	}
 
+	channelInformer := natsschannel.Get(ctx)
+	subscriptionInformer := subscription.Get(ctx)
+	r := &Reconciler{
+		natsschannelLister: channelInformer.Lister(),
+		natssClientSet:     client.Get(ctx),
+		subscriptionLister: subscriptionInformer.Lister(),
+	}
+
 	natssConfig := util.GetNatssConfig()
 	reporter := channel.NewStatsReporter(env.ContainerName, kmeta.ChildName(env.PodName, uuid.New().String()))
 	dispatcherArgs := dispatcher.Args{
 		NatssURL:       util.GetDefaultNatssURL(),
+		Connection:     util.GetConnectionConfig(),
 		ClusterID:      util.GetDefaultClusterID(),
 		ClientID:       natssConfig.ClientID,
 		AckWaitMinutes: util.GetAckWaitMinutes(),
@@ -105,6 +132,10 @@ func NewController(ctx context.Context, _ configmap.Watcher) *controller.Impl {
 		},
 		Logger:   logger.Desugar(),
 		Reporter: reporter,
+		// The loss of the connection is reported on every channel.
+		ConnectionStateChanged: func(string) {
+			r.impl.GlobalResync(channelInformer.Informer())
+		},
 	}
 	natssDispatcher, err := dispatcher.NewNatssDispatcher(dispatcherArgs)
 	if err != nil {
@@ -114,18 +145,18 @@ func NewController(ctx context.Context, _ configmap.Watcher) *controller.Impl {
 	logger = logger.With(zap.String("controller/impl", "pkg"))
 	logger.Info("Starting the NATSS dispatcher")
 
-	channelInformer := natsschannel.Get(ctx)
-
-	r := &Reconciler{
-		natssDispatcher:    natssDispatcher,
-		natsschannelLister: channelInformer.Lister(),
-		natssClientSet:     client.Get(ctx),
-	}
+	r.natssDispatcher = natssDispatcher
 	r.impl = natsschannelreconciler.NewImpl(ctx, r)
 
 	logger.Info("Setting up event handlers")
 
 	channelInformer.Informer().AddEventHandler(controller.HandleAll(r.impl.Enqueue))
+	subscriptionInformer.Informer().AddEventHandler(dispatcher.SubscriptionHandler("NatssChannel", r.impl.EnqueueKey))
+
+	logger.Info("Watching the NATS configuration")
+	config.Watch(cmw, logger, func(natsConfig *config.NatsConfig) {
+		natssDispatcher.UpdateConfig(ctx, natsConfig)
+	})
 
 	logger.Info("Starting dispatcher.")
 	go func() {
@@ -133,6 +164,11 @@ func NewController(ctx context.Context, _ configmap.Watcher) *controller.Impl {
 			logger.Errorw("Cannot start dispatcher", zap.Error(err))
 		}
 	}()
+	go func() {
+		if err := dispatcher.StartReadinessServer(ctx, dispatcher.ReadinessPort, natssDispatcher, logger.Desugar()); err != nil {
+			logger.Errorw("Cannot serve the readiness endpoint", zap.Error(err))
+		}
+	}()
 	return r.impl
 }
 
@@ -141,17 +177,27 @@ func NewController(ctx context.Context, _ configmap.Watcher) *controller.Impl {
 // - set NatssChannel SubscribableStatus
 // - update host2channel map
 func (r *Reconciler) ReconcileKind(ctx context.Context, natssChannel *v1beta1.NatssChannel) pkgreconciler.Event {
+	r.reportConnection(ctx, natssChannel, r.natssDispatcher.Ready(ctx) == nil)
+
+	rateLimits, err := dispatcher.SubscriberRateLimits(r.subscriptionLister, natssChannel.Namespace, natssChannel.Spec.Subscribers, logging.FromContext(ctx).Desugar())
+	if err != nil {
+		logging.FromContext(ctx).Errorw("Error updating the rate limits of the subscribers", zap.Any("channel", natssChannel), zap.Error(err))
+		return err
+	}
+	r.natssDispatcher.UpdateRateLimits(natssChannel.Name, natssChannel.Namespace, rateLimits)
+
 	// Try to subscribe.
 	failedSubscriptions, err := r.natssDispatcher.UpdateSubscriptions(ctx, natssChannel.Name, natssChannel.Namespace, natssChannel.Spec.Subscribers, false)
 	if err != nil {
 		logging.FromContext(ctx).Errorw("Error updating subscriptions", zap.Any("channel", natssChannel), zap.Error(err))
-		return err
+		return fmt.Errorf("%w", pkgreconciler.NewEvent(corev1.EventTypeWarning, subscriptionFailed, "Failed to update the subscriptions: %v", err))
 	}
 
 	if err := r.patchSubscriberStatus(ctx, natssChannel, failedSubscriptions); err != nil {
 		logging.FromContext(ctx).Errorw("Error patching subscription statuses", zap.Any("channel", natssChannel), zap.Error(err))
 		return err
 	}
+	recordSubscriptionEvents(ctx, natssChannel, natssChannel.Status.Subscribers, failedSubscriptions)
 
 	natssChannels, err := r.natsschannelLister.List(labels.Everything())
 	if err != nil {
@@ -178,12 +224,16 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, natssChannel *v1beta1.Na
 		}
 		errMsg := b.String()
 		logging.FromContext(ctx).Error(errMsg)
-		return fmt.Errorf(errMsg)
+		return fmt.Errorf("%w", pkgreconciler.NewEvent(corev1.EventTypeWarning, subscriptionFailed, "%s", errMsg))
 	}
 	return nil
 }
 
 func (r *Reconciler) FinalizeKind(ctx context.Context, c *v1beta1.NatssChannel) pkgreconciler.Event {
+	r.connectedMux.Lock()
+	delete(r.connected, types.NamespacedName{Namespace: c.Namespace, Name: c.Name})
+	r.connectedMux.Unlock()
+
 	if _, err := r.natssDispatcher.UpdateSubscriptions(ctx, c.Name, c.Namespace, c.Spec.Subscribers, true); err != nil {
 		logging.FromContext(ctx).Errorw("Error updating subscriptions", zap.Any("channel", c), zap.Error(err))
 		return err
@@ -191,6 +241,51 @@ func (r *Reconciler) FinalizeKind(ctx context.Context, c *v1beta1.NatssChannel)
 	return nil
 }
 
+// reportConnection records an Event on the channel when the connection of the dispatcher to NATSS was lost or
+// restored since the channel was last reconciled.
+func (r *Reconciler) reportConnection(ctx context.Context, nc *v1beta1.NatssChannel, connected bool) {
+	key := types.NamespacedName{Namespace: nc.Namespace, Name: nc.Name}
+	r.connectedMux.Lock()
+	if r.connected == nil {
+		r.connected = make(map[types.NamespacedName]bool)
+	}
+	wasConnected, tracked := r.connected[key]
+	if connected || tracked {
+		r.connected[key] = connected
+	}
+	r.connectedMux.Unlock()
+
+	switch {
+	case tracked && wasConnected && !connected:
+		controller.GetEventRecorder(ctx).Event(nc, corev1.EventTypeWarning, connectionLost, "The dispatcher lost its connection to NATSS")
+	case tracked && !wasConnected && connected:
+		controller.GetEventRecorder(ctx).Event(nc, corev1.EventTypeNormal, connectionRestored, "The dispatcher reconnected to NATSS")
+	}
+}
+
+// recordSubscriptionEvents records an Event on the channel for every subscription established or removed, based on
+// the subscriber statuses set by the previous reconciliation.
+func recordSubscriptionEvents(ctx context.Context, nc *v1beta1.NatssChannel, previous []eventingduckv1.SubscriberStatus, failedSubscriptions map[eventingduckv1.SubscriberSpec]error) {
+	recorder := controller.GetEventRecorder(ctx)
+	wasReady := make(map[types.UID]bool, len(previous))
+	for _, status := range previous {
+		wasReady[status.UID] = status.Ready == corev1.ConditionTrue
+	}
+
+	subscribed := make(map[types.UID]bool, len(nc.Spec.Subscribers))
+	for _, sub := range nc.Spec.Subscribers {
+		subscribed[sub.UID] = true
+		if !wasReady[sub.UID] && getFailedSub(sub, failedSubscriptions) == nil {
+			recorder.Eventf(nc, corev1.EventTypeNormal, subscriptionCreated, "Subscription %s created", sub.UID)
+		}
+	}
+	for _, status := range previous {
+		if !subscribed[status.UID] {
+			recorder.Eventf(nc, corev1.EventTypeNormal, subscriptionRemoved, "Subscription %s removed", status.UID)
+		}
+	}
+}
+
 // createSubscribableStatus creates the SubscribableStatus based on the failedSubscriptions
 // checks for each subscriber on the natss channel if there is a failed subscription on natss side
 // if there is no failed subscription => set ready status
@@ -22,15 +22,19 @@ import (
 	"os"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"go.uber.org/zap"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 	clientgotesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
 	fakeeventingclient "knative.dev/eventing/pkg/client/injection/client/fake"
+	_ "knative.dev/eventing/pkg/client/injection/informers/messaging/v1/subscription/fake"
 	"knative.dev/pkg/apis"
 	fakekubeclient "knative.dev/pkg/client/injection/kube/client/fake"
 	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/service/fake"
@@ -45,6 +49,7 @@ import (
 	fakeclientset "knative.dev/eventing-natss/pkg/client/injection/client/fake"
 	_ "knative.dev/eventing-natss/pkg/client/injection/informers/messaging/v1beta1/natsschannel/fake"
 	natsschannelreconciler "knative.dev/eventing-natss/pkg/client/injection/reconciler/messaging/v1beta1/natsschannel"
+	"knative.dev/eventing-natss/pkg/config"
 	"knative.dev/eventing-natss/pkg/dispatcher"
 	dispatchertesting "knative.dev/eventing-natss/pkg/dispatcher/testing"
 	reconciletesting "knative.dev/eventing-natss/pkg/reconciler/testing"
@@ -140,6 +145,33 @@ func TestAllCases(t *testing.T) {
 			},
 			WantEvents: []string{
 				finalizerUpdatedEvent,
+				Eventf(corev1.EventTypeNormal, subscriptionCreated, "Subscription %s created", subscriber1UID),
+				Eventf(corev1.EventTypeNormal, subscriptionCreated, "Subscription %s created", subscriber2UID),
+			},
+		},
+		{
+			Name: "with a subscriber removed",
+			Key:  ncKey,
+			Objects: []runtime.Object{
+				reconciletesting.NewNatssChannel(ncName, testNS,
+					reconciletesting.WithNatssChannelChannelServiceReady(),
+					reconciletesting.WithNatssChannelServiceReady(),
+					reconciletesting.WithNatssChannelEndpointsReady(),
+					reconciletesting.WithNatssChannelDeploymentReady(),
+					reconciletesting.Addressable(),
+					reconciletesting.WithReady,
+					reconciletesting.WithNatssChannelSubscribers([]eventingduckv1.SubscriberSpec{subscriber1}),
+					reconciletesting.WithNatssChannelReadySubscriberAndGeneration(string(subscriber1UID), subscriber1Generation),
+					reconciletesting.WithNatssChannelReadySubscriberAndGeneration(string(subscriber2UID), subscriber2Generation),
+				),
+			},
+			WantPatches: []clientgotesting.PatchActionImpl{
+				makeFinalizerPatch(testNS, ncName),
+				makePatch(testNS, ncName, `[{"op":"remove","path":"/status/subscribers/1"}]`),
+			},
+			WantEvents: []string{
+				finalizerUpdatedEvent,
+				Eventf(corev1.EventTypeNormal, subscriptionRemoved, "Subscription %s removed", subscriber2UID),
 			},
 		},
 		{
@@ -208,7 +240,9 @@ func TestNewController(t *testing.T) {
 	ctx = injection.WithConfig(ctx, cfg)
 	ctx, _ = injection.Fake.SetupInformers(ctx, cfg)
 
-	NewController(ctx, configmap.NewStaticWatcher())
+	NewController(ctx, configmap.NewStaticWatcher(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: config.ConfigMapName},
+	}))
 }
 
 func TestFailedNatssSubscription(t *testing.T) {
@@ -235,7 +269,7 @@ func TestFailedNatssSubscription(t *testing.T) {
 			Key: ncKey,
 			WantEvents: []string{
 				finalizerUpdatedEvent,
-				Eventf(corev1.EventTypeWarning, "InternalError", "\nups\nups"),
+				Eventf(corev1.EventTypeWarning, subscriptionFailed, "\nups\nups"),
 			},
 			WantPatches: []clientgotesting.PatchActionImpl{
 				makeFinalizerPatch(testNS, ncName),
@@ -282,9 +316,36 @@ func createReconciler(
 			natssDispatcher:    dispatcherFactory(),
 			natsschannelLister: listers.GetNatssChannelLister(),
 			natssClientSet:     client.Get(ctx),
+			subscriptionLister: listers.GetSubscriptionLister(),
 		},
 		controller.Options{
 			FinalizerName: finalizerName,
 		},
 	)
 }
+
+// TestReportConnection checks that the loss and the recovery of the connection are reported once, and only once the
+// dispatcher was connected.
+func TestReportConnection(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	ctx := controller.WithEventRecorder(context.Background(), recorder)
+	nc := reconciletesting.NewNatssChannel(ncName, testNS)
+
+	r := &Reconciler{}
+	for _, connected := range []bool{false, true, true, false, false, true} {
+		r.reportConnection(ctx, nc, connected)
+	}
+	close(recorder.Events)
+
+	var got []string
+	for event := range recorder.Events {
+		got = append(got, event)
+	}
+	want := []string{
+		Eventf(corev1.EventTypeWarning, connectionLost, "The dispatcher lost its connection to NATSS"),
+		Eventf(corev1.EventTypeNormal, connectionRestored, "The dispatcher reconnected to NATSS"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("unexpected events (-want, +got):", diff)
+	}
+}
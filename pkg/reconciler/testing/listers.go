@@ -25,12 +25,16 @@ import (
 	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 
+	messagingv1 "knative.dev/eventing/pkg/apis/messaging/v1"
 	fakeeventingclientset "knative.dev/eventing/pkg/client/clientset/versioned/fake"
 	fakeeventsclientset "knative.dev/eventing/pkg/client/clientset/versioned/fake"
+	messaginglisters "knative.dev/eventing/pkg/client/listers/messaging/v1"
 	"knative.dev/pkg/reconciler/testing"
 
+	natssv1alpha1 "knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
 	natssv1beta1 "knative.dev/eventing-natss/pkg/apis/messaging/v1beta1"
 	fakenatsslientset "knative.dev/eventing-natss/pkg/client/clientset/versioned/fake"
+	jetstreamlisters "knative.dev/eventing-natss/pkg/client/listers/messaging/v1alpha1"
 	natsslisters "knative.dev/eventing-natss/pkg/client/listers/messaging/v1beta1"
 )
 
@@ -100,6 +104,14 @@ func (l *Listers) GetNatssChannelLister() natsslisters.NatssChannelLister {
 	return natsslisters.NewNatssChannelLister(l.indexerFor(&natssv1beta1.NatssChannel{}))
 }
 
+func (l *Listers) GetNatsJetStreamChannelLister() jetstreamlisters.NatsJetStreamChannelLister {
+	return jetstreamlisters.NewNatsJetStreamChannelLister(l.indexerFor(&natssv1alpha1.NatsJetStreamChannel{}))
+}
+
 func (l *Listers) GetDeploymentLister() appsv1listers.DeploymentLister {
 	return appsv1listers.NewDeploymentLister(l.indexerFor(&appsv1.Deployment{}))
 }
+
+func (l *Listers) GetSubscriptionLister() messaginglisters.SubscriptionLister {
+	return messaginglisters.NewSubscriptionLister(l.indexerFor(&messagingv1.Subscription{}))
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testing
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+
+	"knative.dev/eventing-natss/pkg/apis/messaging/v1alpha1"
+)
+
+// NatsJetStreamChannelOption enables further configuration of a NatsJetStreamChannel.
+type NatsJetStreamChannelOption func(*v1alpha1.NatsJetStreamChannel)
+
+// NewNatsJetStreamChannel creates a NatsJetStreamChannel with NatsJetStreamChannelOptions.
+func NewNatsJetStreamChannel(name, namespace string, opts ...NatsJetStreamChannelOption) *v1alpha1.NatsJetStreamChannel {
+	nc := &v1alpha1.NatsJetStreamChannel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+	for _, opt := range opts {
+		opt(nc)
+	}
+	nc.SetDefaults(context.Background())
+	return nc
+}
+
+func WithJetStreamInitChannelConditions(nc *v1alpha1.NatsJetStreamChannel) {
+	nc.Status.InitializeConditions()
+}
+
+func WithJetStreamChannelFinalizer(finalizer string) NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Finalizers = []string{finalizer}
+	}
+}
+
+func WithJetStreamChannelDeleted(nc *v1alpha1.NatsJetStreamChannel) {
+	deleteTime := metav1.NewTime(time.Unix(1e9, 0))
+	nc.ObjectMeta.SetDeletionTimestamp(&deleteTime)
+}
+
+func WithJetStreamChannelStream(stream *v1alpha1.StreamSpec) NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Spec.Stream = stream
+	}
+}
+
+func WithJetStreamChannelDeadLetterSink(sink duckv1.Destination) NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Spec.Delivery = &eventingduckv1.DeliverySpec{DeadLetterSink: &sink}
+	}
+}
+
+func WithJetStreamChannelDeadLetterQueue() NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Spec.DeadLetterQueue = &v1alpha1.DeadLetterQueueSpec{Enabled: true}
+	}
+}
+
+func WithJetStreamChannelDeploymentReady() NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Status.PropagateDispatcherStatus(&appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue}}})
+	}
+}
+
+func WithJetStreamChannelServiceReady() NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Status.MarkServiceTrue()
+	}
+}
+
+func WithJetStreamChannelEndpointsReady() NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Status.MarkEndpointsTrue()
+	}
+}
+
+func WithJetStreamChannelChannelServiceReady() NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Status.MarkChannelServiceTrue()
+	}
+}
+
+func WithJetStreamChannelAddress(a string) NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Status.SetAddress(&apis.URL{
+			Scheme: "http",
+			Host:   a,
+		})
+	}
+}
+
+func WithJetStreamChannelStreamReady() NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Status.MarkStreamTrue()
+	}
+}
+
+func WithJetStreamChannelStreamFailed(reason, message string) NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Status.MarkStreamFailed(reason, message)
+	}
+}
+
+func WithJetStreamChannelDeadLetterSinkNotConfigured() NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Status.MarkDeadLetterSinkNotConfigured()
+	}
+}
+
+func WithJetStreamChannelDeadLetterSinkResolved(uri *apis.URL) NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Status.MarkDeadLetterSinkResolvedSucceeded(uri)
+	}
+}
+
+func WithJetStreamChannelDeadLetterSinkFailed(reason, message string) NatsJetStreamChannelOption {
+	return func(nc *v1alpha1.NatsJetStreamChannel) {
+		nc.Status.MarkDeadLetterSinkResolvedFailed(reason, message)
+	}
+}
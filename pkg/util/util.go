@@ -6,6 +6,8 @@ import (
 	"strconv"
 
 	"knative.dev/pkg/network"
+
+	"knative.dev/eventing-natss/pkg/natsutil"
 )
 
 const (
@@ -15,6 +17,20 @@ const (
 	ackWaitMinutesVar   = "ACK_WAIT_MINUTES"
 	maxInflightVar      = "MAX_INFLIGHT"
 
+	// Environment variables configuring TLS for the connections to NATS
+	tlsCAFileVar             = "NATS_TLS_CA_FILE"
+	tlsCertFileVar           = "NATS_TLS_CERT_FILE"
+	tlsKeyFileVar            = "NATS_TLS_KEY_FILE"
+	tlsServerNameVar         = "NATS_TLS_SERVER_NAME"
+	tlsInsecureSkipVerifyVar = "NATS_TLS_INSECURE_SKIP_VERIFY"
+
+	// Environment variables configuring the authentication with NATS
+	credentialsFileVar = "NATS_CREDENTIALS_FILE"
+	nkeySeedFileVar    = "NATS_NKEY_SEED_FILE"
+	tokenFileVar       = "NATS_TOKEN_FILE"
+	usernameFileVar    = "NATS_USERNAME_FILE"
+	passwordFileVar    = "NATS_PASSWORD_FILE"
+
 	fallbackDefaultNatssURLTmpl = "nats://nats-streaming.natss.svc.%s:4222"
 	fallbackDefaultClusterID    = "knative-nats-streaming"
 	fallbackAckWaitMinutes      = 1
@@ -83,3 +99,41 @@ func getEnvAsInt(envKey string, fallback int) int {
 	}
 	return fallback
 }
+
+// GetConnectionConfig returns the configuration used to connect to NATS, besides the URL. TLS and authentication
+// are configured with the paths of files mounted from Secrets, and are only enabled when one of their variables
+// is set.
+func GetConnectionConfig() natsutil.ConnectionConfig {
+	tlsConfig := natsutil.TLSConfig{
+		CAFile:             getEnv(tlsCAFileVar, ""),
+		CertFile:           getEnv(tlsCertFileVar, ""),
+		KeyFile:            getEnv(tlsKeyFileVar, ""),
+		ServerName:         getEnv(tlsServerNameVar, ""),
+		InsecureSkipVerify: getEnvAsBool(tlsInsecureSkipVerifyVar, false),
+	}
+
+	authConfig := natsutil.AuthConfig{
+		CredentialsFile: getEnv(credentialsFileVar, ""),
+		NKeySeedFile:    getEnv(nkeySeedFileVar, ""),
+		TokenFile:       getEnv(tokenFileVar, ""),
+		UsernameFile:    getEnv(usernameFileVar, ""),
+		PasswordFile:    getEnv(passwordFileVar, ""),
+	}
+
+	var config natsutil.ConnectionConfig
+	if tlsConfig != (natsutil.TLSConfig{}) {
+		config.TLS = &tlsConfig
+	}
+	if authConfig != (natsutil.AuthConfig{}) {
+		config.Auth = &authConfig
+	}
+	return config
+}
+
+func getEnvAsBool(envKey string, fallback bool) bool {
+	valueStr := getEnv(envKey, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+	return fallback
+}